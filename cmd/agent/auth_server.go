@@ -19,21 +19,54 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	stdlog "log"
+	"net"
 	"net/http"
+	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/ettle/strcase"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/audit"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/auth"
 	hubclientset "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/hub/clientset/versioned"
 	hubinformer "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/hub/informers/externalversions"
 	"github.com/traefik/hub-agent-kubernetes/pkg/kube"
 	"github.com/traefik/hub-agent-kubernetes/pkg/logger"
+	"github.com/traefik/hub-agent-kubernetes/pkg/tlsreload"
 	"github.com/traefik/hub-agent-kubernetes/pkg/version"
 	"github.com/urfave/cli/v2"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	flagTLSCert     = "tls.cert"
+	flagTLSKey      = "tls.key"
+	flagTLSClientCA = "tls.client-ca"
+
+	flagMetricsListenAddr = "metrics.listen-addr"
+
+	flagDrainDelay   = "drain.delay"
+	flagDrainTimeout = "drain.timeout"
+
+	flagAuditStdout            = "audit.stdout"
+	flagAuditFile              = "audit.file"
+	flagAuditFileMaxSize       = "audit.file-max-size"
+	flagAuditFileMaxBackups    = "audit.file-max-backups"
+	flagAuditWebhookURL        = "audit.webhook-url"
+	flagAuditSampleRate        = "audit.sample-rate"
+	flagAuditRedact            = "audit.redact"
+	flagAuditBufferSize        = "audit.buffer-size"
+	flagAuditTrustedProxyDepth = "audit.trusted-proxy-depth"
 )
 
 type authServerCmd struct {
@@ -48,6 +81,88 @@ func newAuthServerCmd() authServerCmd {
 			EnvVars: []string{"AUTH_SERVER_LISTEN_ADDR"},
 			Value:   "0.0.0.0:80",
 		},
+		&cli.StringFlag{
+			Name:    flagTLSCert,
+			Usage:   "Certificate used for TLS by the auth server, which serves plain HTTP if not set. It is reloaded when it changes",
+			EnvVars: []string{authServerEnvVar(flagTLSCert)},
+		},
+		&cli.StringFlag{
+			Name:    flagTLSKey,
+			Usage:   "Key used for TLS by the auth server. It is reloaded when it changes",
+			EnvVars: []string{authServerEnvVar(flagTLSKey)},
+		},
+		&cli.StringFlag{
+			Name:    flagTLSClientCA,
+			Usage:   "CA certificates auth requests must present a client certificate signed by. It is reloaded when it changes",
+			EnvVars: []string{authServerEnvVar(flagTLSClientCA)},
+		},
+		&cli.StringFlag{
+			Name:    flagMetricsListenAddr,
+			Usage:   "Address on which the auth server exposes its Prometheus metrics, which must not be reachable through Traefik",
+			EnvVars: []string{authServerEnvVar(flagMetricsListenAddr)},
+			Value:   "0.0.0.0:9090",
+		},
+		&cli.DurationFlag{
+			Name:    flagDrainDelay,
+			Usage:   "Time during which the auth server keeps serving requests while being reported as not ready, once asked to stop, so it is removed from its Service endpoints before it stops",
+			EnvVars: []string{authServerEnvVar(flagDrainDelay)},
+			Value:   5 * time.Second,
+		},
+		&cli.DurationFlag{
+			Name:    flagDrainTimeout,
+			Usage:   "Maximum time given to pending auth requests to complete once the drain delay is over",
+			EnvVars: []string{authServerEnvVar(flagDrainTimeout)},
+			Value:   15 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:    flagAuditStdout,
+			Usage:   "Write the audit records of authorization decisions to stdout",
+			EnvVars: []string{authServerEnvVar(flagAuditStdout)},
+		},
+		&cli.StringFlag{
+			Name:    flagAuditFile,
+			Usage:   "Path of the file the audit records of authorization decisions are written to",
+			EnvVars: []string{authServerEnvVar(flagAuditFile)},
+		},
+		&cli.Int64Flag{
+			Name:    flagAuditFileMaxSize,
+			Usage:   "Size in megabytes above which the audit file is rotated",
+			EnvVars: []string{authServerEnvVar(flagAuditFileMaxSize)},
+			Value:   100,
+		},
+		&cli.IntFlag{
+			Name:    flagAuditFileMaxBackups,
+			Usage:   "Number of rotated audit files to keep",
+			EnvVars: []string{authServerEnvVar(flagAuditFileMaxBackups)},
+			Value:   5,
+		},
+		&cli.StringFlag{
+			Name:    flagAuditWebhookURL,
+			Usage:   "URL of the webhook the audit records of authorization decisions are sent to",
+			EnvVars: []string{authServerEnvVar(flagAuditWebhookURL)},
+		},
+		&cli.Float64Flag{
+			Name:    flagAuditSampleRate,
+			Usage:   "Fraction of the allowed requests which are audited, denied requests are always audited",
+			EnvVars: []string{authServerEnvVar(flagAuditSampleRate)},
+			Value:   1,
+		},
+		&cli.StringSliceFlag{
+			Name:    flagAuditRedact,
+			Usage:   "Audit record fields to redact (subject, host, uri or clientIp)",
+			EnvVars: []string{authServerEnvVar(flagAuditRedact)},
+		},
+		&cli.IntFlag{
+			Name:    flagAuditBufferSize,
+			Usage:   "Number of audit records which can wait to be written to each sink before new ones are dropped",
+			EnvVars: []string{authServerEnvVar(flagAuditBufferSize)},
+			Value:   1000,
+		},
+		&cli.IntFlag{
+			Name:    flagAuditTrustedProxyDepth,
+			Usage:   "Number of trusted proxies in front of Traefik, used to find the client IP of audit records",
+			EnvVars: []string{authServerEnvVar(flagAuditTrustedProxyDepth)},
+		},
 	}
 
 	flgs = append(flgs, globalFlags()...)
@@ -71,43 +186,91 @@ func (c authServerCmd) run(cliCtx *cli.Context) error {
 
 	version.Log()
 
+	auditor, err := newAuditor(cliCtx)
+	if err != nil {
+		return fmt.Errorf("create auditor: %w", err)
+	}
+
+	tlsConfig, err := newAuthServerTLSConfig(cliCtx)
+	if err != nil {
+		return fmt.Errorf("create TLS configuration: %w", err)
+	}
+
 	config, err := kube.InClusterConfigWithRetrier(2)
 	if err != nil {
 		return fmt.Errorf("create Kubernetes in-cluster configuration: %w", err)
 	}
 
+	clientSet, err := clientset.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("create Kubernetes client set: %w", err)
+	}
+
 	hubClientSet, err := hubclientset.NewForConfig(config)
 	if err != nil {
 		return fmt.Errorf("create Hub client set: %w", err)
 	}
 
 	switcher := auth.NewHandlerSwitcher()
-	acpWatcher := auth.NewWatcher(switcher)
-
-	hubInformer := hubinformer.NewSharedInformerFactory(hubClientSet, 5*time.Minute)
-	hubInformer.Hub().V1alpha1().AccessControlPolicies().Informer().AddEventHandler(acpWatcher)
-	hubInformer.Start(cliCtx.Context.Done())
+	acpWatcher := auth.NewWatcher(switcher, hubClientSet)
 
-	for t, ok := range hubInformer.WaitForCacheSync(cliCtx.Context.Done()) {
-		if !ok {
-			return fmt.Errorf("wait for cache sync: %s: %w", t, cliCtx.Context.Err())
+	// The server starts before the ACP handlers are built, so it can be probed meanwhile: it is reported as ready once
+	// they are.
+	errCh := make(chan error, 2)
+	go func() {
+		watchErr := watchACPs(cliCtx.Context, acpWatcher, clientSet, hubClientSet)
+		if watchErr != nil && cliCtx.Context.Err() == nil {
+			errCh <- fmt.Errorf("watch ACPs: %w", watchErr)
+		}
+	}()
+	go func() {
+		statusErr := runStatusUpdates(cliCtx.Context, acpWatcher, clientSet)
+		if statusErr != nil && cliCtx.Context.Err() == nil {
+			errCh <- fmt.Errorf("update ACP statuses: %w", statusErr)
 		}
+	}()
+
+	var handler http.Handler = switcher
+	if cliCtx.String(flagTLSClientCA) != "" {
+		handler = requireClientCert(handler)
 	}
 
-	go acpWatcher.Run(cliCtx.Context)
+	if auditor != nil {
+		// The auditor is stopped once the server is, so the decisions taken while shutting down are audited too.
+		auditCtx, stopAudit := context.WithCancel(context.Background())
+		auditDone := make(chan struct{})
+		go func() {
+			auditor.Run(auditCtx)
+			close(auditDone)
+		}()
+		defer func() {
+			stopAudit()
+			<-auditDone
+		}()
+
+		handler = auditor.Middleware(handler)
+	}
 
 	listenAddr := cliCtx.String("listen-addr")
 
+	// draining is set once the server is shutting down, so it is not reported as ready anymore and stops receiving new
+	// requests before it stops.
+	var draining int32
+
 	mux := http.NewServeMux()
 
 	mux.Handle("/_live", http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
 		rw.WriteHeader(http.StatusOK)
 	}))
 	mux.Handle("/_ready", http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&draining) == 1 || !acpWatcher.Ready() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		rw.WriteHeader(http.StatusOK)
 	}))
 
-	mux.Handle("/", switcher)
+	mux.Handle("/", handler)
 
 	server := &http.Server{
 		Addr:     listenAddr,
@@ -115,30 +278,239 @@ func (c authServerCmd) run(cliCtx *cli.Context) error {
 		ErrorLog: stdlog.New(log.Logger.Level(zerolog.DebugLevel), "", 0),
 	}
 
+	metricsListenAddr := cliCtx.String(flagMetricsListenAddr)
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", promhttp.Handler())
+
+	metricsServer := &http.Server{
+		Addr:     metricsListenAddr,
+		Handler:  metricsMux,
+		ErrorLog: stdlog.New(log.Logger.Level(zerolog.DebugLevel), "", 0),
+	}
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("listen on %q: %w", listenAddr, err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
 	srvDone := make(chan struct{})
+	metricsSrvDone := make(chan struct{})
 
 	go func() {
-		log.Info().Str("addr", listenAddr).Msg("Starting auth server")
-		if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			log.Err(err).Msg("Unable to listen and serve auth requests")
+		log.Info().Str("addr", listenAddr).Bool("tls", tlsConfig != nil).Msg("Starting auth server")
+		if srvErr := server.Serve(ln); !errors.Is(srvErr, http.ErrServerClosed) {
+			log.Err(srvErr).Msg("Unable to listen and serve auth requests")
 		}
 		close(srvDone)
 	}()
 
+	go func() {
+		log.Info().Str("addr", metricsListenAddr).Msg("Starting metrics server")
+		if srvErr := metricsServer.ListenAndServe(); !errors.Is(srvErr, http.ErrServerClosed) {
+			log.Err(srvErr).Msg("Unable to listen and serve metrics requests")
+		}
+		close(metricsSrvDone)
+	}()
+
 	select {
 	case <-cliCtx.Context.Done():
-		gracefulCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		atomic.StoreInt32(&draining, 1)
+
+		drainDelay := cliCtx.Duration(flagDrainDelay)
+		log.Info().Dur("delay", drainDelay).Msg("Draining auth server")
+
+		select {
+		case <-time.After(drainDelay):
+		case <-srvDone:
+			_ = metricsServer.Close()
+			return errors.New("auth server stopped")
+		}
+
+		gracefulCtx, cancel := context.WithTimeout(context.Background(), cliCtx.Duration(flagDrainTimeout))
 		defer cancel()
 
-		if err = server.Shutdown(gracefulCtx); err != nil {
-			log.Error().Err(err).Msg("Failed to shutdown auth server gracefully")
-			if err = server.Close(); err != nil {
-				return fmt.Errorf("close auth server: %w", err)
-			}
+		if err = shutdown(gracefulCtx, server); err != nil {
+			return fmt.Errorf("close auth server: %w", err)
+		}
+		if err = shutdown(gracefulCtx, metricsServer); err != nil {
+			return fmt.Errorf("close metrics server: %w", err)
 		}
 	case <-srvDone:
+		_ = metricsServer.Close()
 		return errors.New("auth server stopped")
+	case <-metricsSrvDone:
+		_ = server.Close()
+		return errors.New("metrics server stopped")
+	case err = <-errCh:
+		_ = server.Close()
+		_ = metricsServer.Close()
+		return err
 	}
 
 	return nil
 }
+
+// watchACPs keeps the handlers of the given watcher up to date with the ACPs, and the Secrets and ConfigMaps they
+// reference, until the given context is done.
+func watchACPs(ctx context.Context, acpWatcher *auth.Watcher, clientSet clientset.Interface, hubClientSet hubclientset.Interface) error {
+	// Secrets and ConfigMaps referenced by ACPs are looked up in the namespace of the auth server only.
+	kubeInformer := informers.NewSharedInformerFactoryWithOptions(clientSet, 5*time.Minute, informers.WithNamespace(currentNamespace()))
+	kubeInformer.Core().V1().Secrets().Informer().AddEventHandler(acpWatcher)
+	kubeInformer.Core().V1().ConfigMaps().Informer().AddEventHandler(acpWatcher)
+	kubeInformer.Start(ctx.Done())
+
+	for t, ok := range kubeInformer.WaitForCacheSync(ctx.Done()) {
+		if !ok {
+			return fmt.Errorf("wait for Kubernetes cache sync: %s: %w", t, ctx.Err())
+		}
+	}
+
+	hubInformer := hubinformer.NewSharedInformerFactory(hubClientSet, 5*time.Minute)
+	hubInformer.Hub().V1alpha1().AccessControlPolicies().Informer().AddEventHandler(acpWatcher)
+	hubInformer.Start(ctx.Done())
+
+	for t, ok := range hubInformer.WaitForCacheSync(ctx.Done()) {
+		if !ok {
+			return fmt.Errorf("wait for cache sync: %s: %w", t, ctx.Err())
+		}
+	}
+
+	acpWatcher.Run(ctx)
+
+	return nil
+}
+
+// runStatusUpdates writes the Ready condition of the ACPs of the given watcher while this replica of the auth server
+// is the leader, so that a single replica writes them at a time, until the given context is done.
+func runStatusUpdates(ctx context.Context, acpWatcher *auth.Watcher, clientSet clientset.Interface) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("get hostname: %w", err)
+	}
+
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, currentNamespace(), "hub-agent-auth-server",
+		clientSet.CoreV1(), clientSet.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return fmt.Errorf("create leader election lock: %w", err)
+	}
+
+	for ctx.Err() == nil {
+		var elector *leaderelection.LeaderElector
+		elector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					log.Info().Msg("Elected as leader, writing ACP statuses")
+					acpWatcher.RunStatusUpdates(leaderCtx)
+				},
+				OnStoppedLeading: func() {
+					log.Info().Msg("Not leader anymore, no longer writing ACP statuses")
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("create leader elector: %w", err)
+		}
+
+		// Run returns once the leadership is lost, another election is then run.
+		elector.Run(ctx)
+	}
+
+	return nil
+}
+
+// shutdown gracefully shuts down the given server, closing it if it cannot be shut down gracefully.
+func shutdown(ctx context.Context, server *http.Server) error {
+	if err := server.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Str("addr", server.Addr).Msg("Failed to shutdown server gracefully")
+		return server.Close()
+	}
+
+	return nil
+}
+
+// newAuthServerTLSConfig returns the TLS configuration of the auth server configured by the TLS flags, or nil if the
+// auth server serves plain HTTP.
+func newAuthServerTLSConfig(cliCtx *cli.Context) (*tls.Config, error) {
+	certFile := cliCtx.String(flagTLSCert)
+	keyFile := cliCtx.String(flagTLSKey)
+	clientCAFile := cliCtx.String(flagTLSClientCA)
+
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("a client CA requires a TLS certificate and key")
+		}
+		return nil, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a TLS certificate and key are required")
+	}
+
+	reloader, err := tlsreload.NewReloader(certFile, keyFile, clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader.TLSConfig(), nil
+}
+
+// requireClientCert denies the auth requests made without a client certificate. Certificates are verified when the
+// TLS connection is established, but are not required then so probes can be served.
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+			log.Debug().Str("remote_addr", req.RemoteAddr).Msg("Auth request denied: no client certificate")
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// newAuditor returns the auditor of authorization decisions configured by the audit flags, or nil if no audit sink is
+// configured.
+func newAuditor(cliCtx *cli.Context) (*audit.Auditor, error) {
+	var sinks []audit.Sink
+
+	if cliCtx.Bool(flagAuditStdout) {
+		sinks = append(sinks, audit.NewWriterSink(os.Stdout))
+	}
+
+	if path := cliCtx.String(flagAuditFile); path != "" {
+		sink, err := audit.NewFileSink(path, cliCtx.Int64(flagAuditFileMaxSize)*1024*1024, cliCtx.Int(flagAuditFileMaxBackups))
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if webhookURL := cliCtx.String(flagAuditWebhookURL); webhookURL != "" {
+		sinks = append(sinks, audit.NewWebhookSink(webhookURL))
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	return audit.NewAuditor(audit.Config{
+		Sinks:             sinks,
+		SampleRate:        cliCtx.Float64(flagAuditSampleRate),
+		Redact:            cliCtx.StringSlice(flagAuditRedact),
+		BufferSize:        cliCtx.Int(flagAuditBufferSize),
+		TrustedProxyDepth: cliCtx.Int(flagAuditTrustedProxyDepth),
+	})
+}
+
+func authServerEnvVar(flag string) string {
+	return "AUTH_SERVER_" + strcase.ToSNAKE(flag)
+}
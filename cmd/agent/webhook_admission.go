@@ -36,6 +36,7 @@ import (
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/admission"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/admission/ingclass"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/admission/reviewer"
+	traefikv1alpha1 "github.com/traefik/hub-agent-kubernetes/pkg/crd/api/traefik/v1alpha1"
 	hubclientset "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/hub/clientset/versioned"
 	hubinformer "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/hub/informers/externalversions"
 	traefikclientset "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/traefik/clientset/versioned"
@@ -58,6 +59,8 @@ const (
 	flagACPServerCertificate    = "acp-server.cert"
 	flagACPServerKey            = "acp-server.key"
 	flagACPServerAuthServerAddr = "acp-server.auth-server-addr"
+	flagACPServerAuthServerCA   = "acp-server.auth-server-ca-secret"
+	flagACPServerAuthServerCert = "acp-server.auth-server-cert-secret"
 	flagIngressClassName        = "ingress-class-name"
 	flagTraefikEntryPoint       = "traefik.entryPoint"
 )
@@ -88,6 +91,16 @@ func acpFlags() []cli.Flag {
 			EnvVars: []string{strcase.ToSNAKE(flagACPServerAuthServerAddr)},
 			Value:   "http://hub-agent-auth-server.hub.svc.cluster.local",
 		},
+		&cli.StringFlag{
+			Name:    flagACPServerAuthServerCA,
+			Usage:   "Name of the Secret holding the CA Traefik verifies the certificate of the auth server with. It must exist in the namespaces of the protected Ingresses",
+			EnvVars: []string{strcase.ToSNAKE(flagACPServerAuthServerCA)},
+		},
+		&cli.StringFlag{
+			Name:    flagACPServerAuthServerCert,
+			Usage:   "Name of the Secret holding the client certificate Traefik presents to the auth server. It must exist in the namespaces of the protected Ingresses",
+			EnvVars: []string{strcase.ToSNAKE(flagACPServerAuthServerCert)},
+		},
 		&cli.StringFlag{
 			Name:    flagIngressClassName,
 			Usage:   "The ingress class name used for ingresses managed by Hub",
@@ -108,6 +121,8 @@ func webhookAdmission(ctx context.Context, cliCtx *cli.Context, platformClient *
 		certFile       = cliCtx.String(flagACPServerCertificate)
 		keyFile        = cliCtx.String(flagACPServerKey)
 		authServerAddr = cliCtx.String(flagACPServerAuthServerAddr)
+		authServerCA   = cliCtx.String(flagACPServerAuthServerCA)
+		authServerCert = cliCtx.String(flagACPServerAuthServerCert)
 	)
 
 	if _, err := url.Parse(authServerAddr); err != nil {
@@ -116,7 +131,15 @@ func webhookAdmission(ctx context.Context, cliCtx *cli.Context, platformClient *
 
 	ingressClassName := cliCtx.String(flagIngressClassName)
 	traefikEntryPoint := cliCtx.String(flagTraefikEntryPoint)
-	acpAdmission, edgeIngressAdmission, err := setupAdmissionHandlers(ctx, platformClient, authServerAddr, ingressClassName, traefikEntryPoint)
+	var authServerTLS *traefikv1alpha1.ClientTLS
+	if authServerCA != "" || authServerCert != "" {
+		authServerTLS = &traefikv1alpha1.ClientTLS{
+			CASecret:   authServerCA,
+			CertSecret: authServerCert,
+		}
+	}
+
+	acpAdmission, edgeIngressAdmission, err := setupAdmissionHandlers(ctx, platformClient, authServerAddr, authServerTLS, ingressClassName, traefikEntryPoint)
 	if err != nil {
 		return fmt.Errorf("create admission handler: %w", err)
 	}
@@ -162,7 +185,7 @@ func webhookAdmission(ctx context.Context, cliCtx *cli.Context, platformClient *
 	return nil
 }
 
-func setupAdmissionHandlers(ctx context.Context, platformClient *platform.Client, authServerAddr, ingressClassName, traefikEntryPoint string) (acpHdl, edgeIngressHdl http.Handler, err error) {
+func setupAdmissionHandlers(ctx context.Context, platformClient *platform.Client, authServerAddr string, authServerTLS *traefikv1alpha1.ClientTLS, ingressClassName, traefikEntryPoint string) (acpHdl, edgeIngressHdl http.Handler, err error) {
 	config, err := kube.InClusterConfigWithRetrier(2)
 	if err != nil {
 		return nil, nil, fmt.Errorf("create Kubernetes in-cluster configuration: %w", err)
@@ -245,7 +268,7 @@ func setupAdmissionHandlers(ctx context.Context, platformClient *platform.Client
 
 	polGetter := reviewer.NewPolGetter(hubInformer)
 
-	fwdAuthMdlwrs := reviewer.NewFwdAuthMiddlewares(authServerAddr, polGetter, traefikClientSet.TraefikV1alpha1())
+	fwdAuthMdlwrs := reviewer.NewFwdAuthMiddlewares(authServerAddr, authServerTLS, polGetter, traefikClientSet.TraefikV1alpha1())
 
 	reviewers := []admission.Reviewer{
 		reviewer.NewTraefikIngress(ingClassWatcher, fwdAuthMdlwrs),
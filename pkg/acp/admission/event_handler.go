@@ -20,6 +20,8 @@ package admission
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	hubv1alpha1 "github.com/traefik/hub-agent-kubernetes/pkg/crd/api/hub/v1alpha1"
@@ -31,14 +33,20 @@ type Updatable interface {
 }
 
 // EventHandler watches ACP resources and calls its set Updatable when they are modified.
+// When an ACP is modified, the composite ACPs referencing it are considered modified too.
 type EventHandler struct {
 	listener Updatable
+
+	compositesMu sync.Mutex
+	// composites holds the ACPs referenced by each composite ACP.
+	composites map[string][]string
 }
 
 // NewEventHandler returns a new event handler meant to listen for ACP changes. It calls the given Updatable when an ACP is modified.
 func NewEventHandler(listener Updatable) *EventHandler {
 	return &EventHandler{
-		listener: listener,
+		listener:   listener,
+		composites: make(map[string][]string),
 	}
 }
 
@@ -53,7 +61,8 @@ func (w *EventHandler) OnAdd(obj interface{}) {
 		return
 	}
 
-	w.listener.Update(v.ObjectMeta.Name)
+	w.trackComposite(v)
+	w.update(v.ObjectMeta.Name)
 }
 
 // OnUpdate implements Kubernetes cache.ResourceEventHandler so it can be used as an informer event handler.
@@ -76,11 +85,13 @@ func (w *EventHandler) OnUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
+	w.trackComposite(newACP)
+
 	if !headersChanged(oldACP.Spec, newACP.Spec) {
 		return
 	}
 
-	w.listener.Update(newACP.ObjectMeta.Name)
+	w.update(newACP.ObjectMeta.Name)
 }
 
 // OnDelete implements Kubernetes cache.ResourceEventHandler so it can be used as an informer event handler.
@@ -94,7 +105,81 @@ func (w *EventHandler) OnDelete(obj interface{}) {
 		return
 	}
 
-	w.listener.Update(v.ObjectMeta.Name)
+	w.compositesMu.Lock()
+	delete(w.composites, v.ObjectMeta.Name)
+	w.compositesMu.Unlock()
+
+	w.update(v.ObjectMeta.Name)
+}
+
+// trackComposite records the ACPs referenced by the given ACP if it is a composite one.
+func (w *EventHandler) trackComposite(policy *hubv1alpha1.AccessControlPolicy) {
+	w.compositesMu.Lock()
+	defer w.compositesMu.Unlock()
+
+	if policy.Spec.Composite == nil {
+		delete(w.composites, policy.ObjectMeta.Name)
+		return
+	}
+
+	var refs []string
+	refs = append(refs, policy.Spec.Composite.AllOf...)
+	refs = append(refs, policy.Spec.Composite.AnyOf...)
+
+	w.composites[policy.ObjectMeta.Name] = refs
+}
+
+// update notifies the listener that the given ACP and all the composite ACPs referencing it, directly or not, have
+// been modified.
+func (w *EventHandler) update(polName string) {
+	w.listener.Update(polName)
+
+	for _, name := range w.referencingComposites(polName) {
+		w.listener.Update(name)
+	}
+}
+
+func (w *EventHandler) referencingComposites(polName string) []string {
+	w.compositesMu.Lock()
+	defer w.compositesMu.Unlock()
+
+	var names []string
+	seen := map[string]struct{}{polName: {}}
+	queue := []string{polName}
+
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+
+		for name, refs := range w.composites {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+
+			for _, ref := range refs {
+				if ref == child {
+					seen[name] = struct{}{}
+					names = append(names, name)
+					queue = append(queue, name)
+					break
+				}
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// lockoutTrustsProxies returns whether the given basic auth lockout needs the X-Forwarded-For chain to find client IPs.
+func lockoutTrustsProxies(lockout *hubv1alpha1.BasicAuthLockout) bool {
+	return lockout != nil && lockout.TrustedProxyDepth > 0
+}
+
+// jwtReadsRequest returns whether the given JWT policy authorizes requests based on their forwarded method, host or URI.
+func jwtReadsRequest(cfg *hubv1alpha1.AccessControlPolicyJWT) bool {
+	return cfg.Claims != "" || len(cfg.Rules) > 0
 }
 
 func headersChanged(oldCfg, newCfg hubv1alpha1.AccessControlPolicySpec) bool {
@@ -105,7 +190,8 @@ func headersChanged(oldCfg, newCfg hubv1alpha1.AccessControlPolicySpec) bool {
 		}
 
 		return !reflect.DeepEqual(oldCfg.JWT.ForwardHeaders, newCfg.JWT.ForwardHeaders) ||
-			oldCfg.JWT.StripAuthorizationHeader != newCfg.JWT.StripAuthorizationHeader
+			oldCfg.JWT.StripAuthorizationHeader != newCfg.JWT.StripAuthorizationHeader ||
+			jwtReadsRequest(oldCfg.JWT) != jwtReadsRequest(newCfg.JWT)
 
 	case newCfg.BasicAuth != nil:
 		if oldCfg.BasicAuth == nil {
@@ -113,7 +199,52 @@ func headersChanged(oldCfg, newCfg hubv1alpha1.AccessControlPolicySpec) bool {
 		}
 
 		return newCfg.BasicAuth.ForwardUsernameHeader != oldCfg.BasicAuth.ForwardUsernameHeader ||
-			newCfg.BasicAuth.StripAuthorizationHeader != oldCfg.BasicAuth.StripAuthorizationHeader
+			newCfg.BasicAuth.StripAuthorizationHeader != oldCfg.BasicAuth.StripAuthorizationHeader ||
+			lockoutTrustsProxies(oldCfg.BasicAuth.Lockout) != lockoutTrustsProxies(newCfg.BasicAuth.Lockout)
+
+	case newCfg.OIDC != nil:
+		if oldCfg.OIDC == nil {
+			return true
+		}
+
+		return !reflect.DeepEqual(oldCfg.OIDC.ForwardHeaders, newCfg.OIDC.ForwardHeaders)
+
+	case newCfg.APIKey != nil:
+		if oldCfg.APIKey == nil {
+			return true
+		}
+
+		return !reflect.DeepEqual(oldCfg.APIKey.ForwardHeaders, newCfg.APIKey.ForwardHeaders)
+
+	case newCfg.MTLS != nil:
+		if oldCfg.MTLS == nil {
+			return true
+		}
+
+		return !reflect.DeepEqual(oldCfg.MTLS.ForwardHeaders, newCfg.MTLS.ForwardHeaders)
+
+	case newCfg.Introspection != nil:
+		if oldCfg.Introspection == nil {
+			return true
+		}
+
+		return !reflect.DeepEqual(oldCfg.Introspection.ForwardHeaders, newCfg.Introspection.ForwardHeaders) ||
+			oldCfg.Introspection.StripAuthorizationHeader != newCfg.Introspection.StripAuthorizationHeader ||
+			(oldCfg.Introspection.Claims != "") != (newCfg.Introspection.Claims != "")
+
+	case newCfg.IPAllowList != nil:
+		if oldCfg.IPAllowList == nil {
+			return true
+		}
+
+		return (oldCfg.IPAllowList.TrustedProxyDepth > 0) != (newCfg.IPAllowList.TrustedProxyDepth > 0)
+
+	case newCfg.Composite != nil:
+		if oldCfg.Composite == nil {
+			return true
+		}
+
+		return !reflect.DeepEqual(oldCfg.Composite, newCfg.Composite)
 
 	default:
 		return false
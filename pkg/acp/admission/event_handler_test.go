@@ -91,3 +91,115 @@ func TestEventHandler_OnUpdate(t *testing.T) {
 
 	assert.Equal(t, expected, updater.policies)
 }
+
+func TestEventHandler_OnUpdate_basicAuthLockout(t *testing.T) {
+	updater := fakeUpdater{}
+
+	handler := NewEventHandler(&updater)
+
+	handler.OnUpdate(
+		createLockoutPolicy("1", "my-policy-1", 0),
+		createLockoutPolicy("1", "my-policy-1", 1),
+	)
+
+	handler.OnUpdate(
+		createLockoutPolicy("2", "my-policy-2", 1),
+		createLockoutPolicy("2", "my-policy-2", 2),
+	)
+
+	expected := []string{"my-policy-1"}
+
+	assert.Equal(t, expected, updater.policies)
+}
+
+func createLockoutPolicy(uid, name string, trustedProxyDepth int) *hubv1alpha1.AccessControlPolicy {
+	return &hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{UID: ktypes.UID(uid), Name: name},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			BasicAuth: &hubv1alpha1.AccessControlPolicyBasicAuth{
+				Users: []string{"test:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"},
+				Lockout: &hubv1alpha1.BasicAuthLockout{
+					MaxFailures:       5,
+					TrustedProxyDepth: trustedProxyDepth,
+				},
+			},
+		},
+	}
+}
+
+func TestEventHandler_OnUpdate_jwtClaims(t *testing.T) {
+	updater := fakeUpdater{}
+
+	handler := NewEventHandler(&updater)
+
+	handler.OnUpdate(
+		createJWTClaimsPolicy("1", "my-policy-1", ""),
+		createJWTClaimsPolicy("1", "my-policy-1", `Equals("group", "dev")`),
+	)
+
+	handler.OnUpdate(
+		createJWTClaimsPolicy("2", "my-policy-2", `Equals("group", "dev")`),
+		createJWTClaimsPolicy("2", "my-policy-2", `Equals("group", "ops")`),
+	)
+
+	expected := []string{"my-policy-1"}
+
+	assert.Equal(t, expected, updater.policies)
+}
+
+func createJWTClaimsPolicy(uid, name, claims string) *hubv1alpha1.AccessControlPolicy {
+	return &hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{UID: ktypes.UID(uid), Name: name},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			JWT: &hubv1alpha1.AccessControlPolicyJWT{
+				SigningSecret: "secret",
+				Claims:        claims,
+			},
+		},
+	}
+}
+
+func TestEventHandler_OnUpdate_composite(t *testing.T) {
+	updater := fakeUpdater{}
+
+	handler := NewEventHandler(&updater)
+
+	handler.OnAdd(createPolicy("1", "my-policy-1", false))
+	handler.OnAdd(createCompositePolicy("2", "my-composite", "my-policy-1"))
+	handler.OnAdd(createCompositePolicy("3", "my-parent-composite", "my-composite"))
+	handler.OnAdd(createCompositePolicy("4", "my-other-composite", "my-policy-4"))
+
+	updater.policies = nil
+
+	handler.OnUpdate(
+		createPolicy("1", "my-policy-1", false),
+		createPolicy("1", "my-policy-1", true),
+	)
+
+	expected := []string{"my-policy-1", "my-composite", "my-parent-composite"}
+
+	assert.Equal(t, expected, updater.policies)
+
+	updater.policies = nil
+
+	handler.OnDelete(createCompositePolicy("2", "my-composite", "my-policy-1"))
+	handler.OnUpdate(
+		createPolicy("1", "my-policy-1", true),
+		createPolicy("1", "my-policy-1", false),
+	)
+
+	expected = []string{"my-composite", "my-parent-composite", "my-policy-1"}
+
+	assert.Equal(t, expected, updater.policies)
+}
+
+func createCompositePolicy(uid, name string, policies ...string) *hubv1alpha1.AccessControlPolicy {
+	return &hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{UID: ktypes.UID(uid), Name: name},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			Composite: &hubv1alpha1.AccessControlPolicyComposite{
+				AnyOf: policies,
+			},
+		},
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"fmt"
 
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/mtls"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -102,12 +103,86 @@ func headerToForward(cfg *acp.Config) ([]string, error) {
 		if cfg.BasicAuth.StripAuthorizationHeader {
 			headerToFwd = append(headerToFwd, "Authorization")
 		}
+	case cfg.OIDC != nil:
+		for headerName := range cfg.OIDC.ForwardHeaders {
+			headerToFwd = append(headerToFwd, headerName)
+		}
+	case cfg.APIKey != nil:
+		for headerName := range cfg.APIKey.ForwardHeaders {
+			headerToFwd = append(headerToFwd, headerName)
+		}
+	case cfg.MTLS != nil:
+		for headerName := range cfg.MTLS.ForwardHeaders {
+			headerToFwd = append(headerToFwd, headerName)
+		}
+	case cfg.Introspection != nil:
+		for headerName := range cfg.Introspection.ForwardHeaders {
+			headerToFwd = append(headerToFwd, headerName)
+		}
+		if cfg.Introspection.StripAuthorizationHeader {
+			headerToFwd = append(headerToFwd, "Authorization")
+		}
+	case cfg.IPAllowList != nil:
 	default:
 		return nil, errors.New("unsupported ACP type")
 	}
 	return headerToFwd, nil
 }
 
+// authRequestHeaders returns the request headers to forward to the auth server. A nil slice means all headers are
+// forwarded.
+func authRequestHeaders(cfg *acp.Config) []string {
+	if cfg.MTLS != nil {
+		// Only the client certificate is needed to authenticate the request.
+		return []string{mtls.CertHeader}
+	}
+
+	return nil
+}
+
+// requiresClientCert returns whether one of the given policies authenticates client certificates, which Traefik must
+// then pass to the auth server.
+func requiresClientCert(cfgs []*acp.Config) bool {
+	for _, cfg := range cfgs {
+		if cfg.MTLS != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trustForwardHeader returns whether the X-Forwarded-* headers of the request should be forwarded to the auth server.
+func trustForwardHeader(cfg *acp.Config) bool {
+	// The source IP can only be found behind trusted proxies if the whole X-Forwarded-For chain is forwarded.
+	switch {
+	case cfg.IPAllowList != nil:
+		return cfg.IPAllowList.TrustedProxyDepth > 0
+	case cfg.BasicAuth != nil:
+		return cfg.BasicAuth.Lockout != nil && cfg.BasicAuth.Lockout.TrustedProxyDepth > 0
+	default:
+		return false
+	}
+}
+
+// readsForwardedRequest returns whether the given policy authorizes requests based on their method, host or URI, read
+// from the X-Forwarded-Method, X-Forwarded-Host and X-Forwarded-Uri headers set by Traefik. When the forwardAuth
+// middleware trusts forwarded headers, Traefik keeps the values of these headers sent by clients instead of setting
+// them, unless the entry point is configured to remove them.
+func readsForwardedRequest(cfg *acp.Config) bool {
+	switch {
+	case cfg.JWT != nil:
+		return cfg.JWT.Claims != "" || len(cfg.JWT.Rules) > 0
+	case cfg.Introspection != nil:
+		return cfg.Introspection.Claims != ""
+	case cfg.OIDC != nil:
+		// Redirections and callbacks are built from the forwarded request URL.
+		return true
+	default:
+		return false
+	}
+}
+
 func isDefaultIngressClassValue(value string) bool {
 	switch value {
 	case defaultAnnotationTraefik:
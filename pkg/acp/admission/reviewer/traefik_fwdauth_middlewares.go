@@ -19,6 +19,7 @@ package reviewer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 
@@ -33,14 +34,17 @@ import (
 // FwdAuthMiddlewares manages Traefik forwardAuth middlewares.
 type FwdAuthMiddlewares struct {
 	agentAddress     string
+	agentTLS         *traefikv1alpha1.ClientTLS
 	policies         PolicyGetter
 	traefikClientSet v1alpha1.TraefikV1alpha1Interface
 }
 
-// NewFwdAuthMiddlewares returns a new FwdAuthMiddlewares.
-func NewFwdAuthMiddlewares(agentAddr string, policies PolicyGetter, traefikClientSet v1alpha1.TraefikV1alpha1Interface) FwdAuthMiddlewares {
+// NewFwdAuthMiddlewares returns a new FwdAuthMiddlewares. The given TLS configuration, if any, is used by the
+// middlewares to reach the agent over TLS.
+func NewFwdAuthMiddlewares(agentAddr string, agentTLS *traefikv1alpha1.ClientTLS, policies PolicyGetter, traefikClientSet v1alpha1.TraefikV1alpha1Interface) FwdAuthMiddlewares {
 	return FwdAuthMiddlewares{
 		agentAddress:     agentAddr,
+		agentTLS:         agentTLS,
 		policies:         policies,
 		traefikClientSet: traefikClientSet,
 	}
@@ -49,6 +53,8 @@ func NewFwdAuthMiddlewares(agentAddr string, policies PolicyGetter, traefikClien
 // Setup first checks if there is already a middleware for this policy.
 // If one is found, it makes sure it has the correct spec and if it's not the case, it updates it.
 // If no middleware is found, a new one is created for this policy.
+// Policies authenticating client certificates get a chain middleware instead, which passes the client certificate
+// of the TLS connection to the forwardAuth middleware.
 // NOTE: forward auth middlewares deletion is to be done elsewhere, when ACPs are deleted.
 func (m FwdAuthMiddlewares) Setup(ctx context.Context, polName, namespace string) (string, error) {
 	logger := log.Ctx(ctx).With().
@@ -63,15 +69,56 @@ func (m FwdAuthMiddlewares) Setup(ctx context.Context, polName, namespace string
 		return "", err
 	}
 
+	cfgs, err := m.resolvePolicies(acpCfg, map[string]struct{}{polName: {}})
+	if err != nil {
+		return "", err
+	}
+
+	fwdAuthSpec, err := m.newMiddlewareSpec(polName, cfgs)
+	if err != nil {
+		return "", fmt.Errorf("new middleware spec: %w", err)
+	}
+
 	name := middlewareName(polName)
-	if err = m.setupMiddleware(ctx, name, namespace, polName, acpCfg); err != nil {
+	if !requiresClientCert(cfgs) {
+		if err = m.setupMiddleware(ctx, name, namespace, fwdAuthSpec); err != nil {
+			return "", fmt.Errorf("setup ForwardAuth middleware: %w", err)
+		}
+
+		return name, nil
+	}
+
+	// Traefik removes the client certificate header sent by clients and sets it from the TLS connection only if the
+	// passTLSClientCert middleware runs before the forwardAuth one. Otherwise, clients could send any certificate.
+	clientCertName := name + "-client-cert"
+	clientCertSpec := traefikv1alpha1.MiddlewareSpec{
+		PassTLSClientCert: &traefikv1alpha1.PassTLSClientCert{PEM: true},
+	}
+	if err = m.setupMiddleware(ctx, clientCertName, namespace, clientCertSpec); err != nil {
+		return "", fmt.Errorf("setup PassTLSClientCert middleware: %w", err)
+	}
+
+	fwdAuthName := name + "-forward-auth"
+	if err = m.setupMiddleware(ctx, fwdAuthName, namespace, fwdAuthSpec); err != nil {
 		return "", fmt.Errorf("setup ForwardAuth middleware: %w", err)
 	}
 
+	chainSpec := traefikv1alpha1.MiddlewareSpec{
+		Chain: &traefikv1alpha1.Chain{
+			Middlewares: []traefikv1alpha1.MiddlewareRef{
+				{Name: clientCertName, Namespace: namespace},
+				{Name: fwdAuthName, Namespace: namespace},
+			},
+		},
+	}
+	if err = m.setupMiddleware(ctx, name, namespace, chainSpec); err != nil {
+		return "", fmt.Errorf("setup Chain middleware: %w", err)
+	}
+
 	return name, nil
 }
 
-func (m *FwdAuthMiddlewares) setupMiddleware(ctx context.Context, name, namespace, canonicalPolName string, cfg *acp.Config) error {
+func (m *FwdAuthMiddlewares) setupMiddleware(ctx context.Context, name, namespace string, newSpec traefikv1alpha1.MiddlewareSpec) error {
 	logger := log.Ctx(ctx).With().Str("middleware_name", name).Logger()
 	ctx = logger.WithContext(ctx)
 
@@ -81,21 +128,16 @@ func (m *FwdAuthMiddlewares) setupMiddleware(ctx context.Context, name, namespac
 	}
 
 	if currentMiddleware == nil {
-		logger.Debug().Msg("No ForwardAuth middleware found, creating a new one")
-		return m.createMiddleware(ctx, name, namespace, canonicalPolName, cfg)
-	}
-
-	newSpec, err := m.newMiddlewareSpec(canonicalPolName, cfg)
-	if err != nil {
-		return err
+		logger.Debug().Msg("No middleware found, creating a new one")
+		return m.createMiddleware(ctx, name, namespace, newSpec)
 	}
 
 	if reflect.DeepEqual(currentMiddleware.Spec, newSpec) {
-		logger.Debug().Msg("Existing ForwardAuth middleware is up do date")
+		logger.Debug().Msg("Existing middleware is up do date")
 		return nil
 	}
 
-	logger.Debug().Msg("Existing ForwardAuth middleware is outdated, updating it")
+	logger.Debug().Msg("Existing middleware is outdated, updating it")
 
 	currentMiddleware.Spec = newSpec
 
@@ -119,26 +161,105 @@ func (m *FwdAuthMiddlewares) findMiddleware(ctx context.Context, name, namespace
 	return mdlwr, nil
 }
 
-func (m *FwdAuthMiddlewares) newMiddlewareSpec(canonicalPolName string, cfg *acp.Config) (traefikv1alpha1.MiddlewareSpec, error) {
-	authResponseHeaders, err := headerToForward(cfg)
-	if err != nil {
-		return traefikv1alpha1.MiddlewareSpec{}, err
+// newMiddlewareSpec returns the spec of the forwardAuth middleware of the given policy, made of the given
+// non-composite policies.
+func (m *FwdAuthMiddlewares) newMiddlewareSpec(canonicalPolName string, cfgs []*acp.Config) (traefikv1alpha1.MiddlewareSpec, error) {
+	var (
+		authResponseHeaders []string
+		authReqHeaders      []string
+		forwardAllHeaders   bool
+		trustFwdHeader      bool
+		readsFwdRequest     bool
+	)
+	for _, c := range cfgs {
+		hdrs, err := headerToForward(c)
+		if err != nil {
+			return traefikv1alpha1.MiddlewareSpec{}, err
+		}
+		authResponseHeaders = appendUnique(authResponseHeaders, hdrs...)
+
+		// Request headers are restricted only if all policies restrict them.
+		reqHdrs := authRequestHeaders(c)
+		if reqHdrs == nil {
+			forwardAllHeaders = true
+		}
+		authReqHeaders = appendUnique(authReqHeaders, reqHdrs...)
+
+		trustFwdHeader = trustFwdHeader || trustForwardHeader(c)
+		readsFwdRequest = readsFwdRequest || readsForwardedRequest(c)
+	}
+
+	// Trusting forwarded headers would let clients choose the method, host and URI the policies authorize.
+	if trustFwdHeader && readsFwdRequest {
+		return traefikv1alpha1.MiddlewareSpec{}, errors.New("policies with a trusted proxy depth cannot be combined " +
+			"with policies authorizing requests on their method, host or URI")
+	}
+
+	if forwardAllHeaders {
+		authReqHeaders = nil
 	}
 
 	return traefikv1alpha1.MiddlewareSpec{
 		ForwardAuth: &traefikv1alpha1.ForwardAuth{
 			Address:             m.agentAddress + "/" + canonicalPolName,
 			AuthResponseHeaders: authResponseHeaders,
+			AuthRequestHeaders:  authReqHeaders,
+			TrustForwardHeader:  trustFwdHeader,
+			TLS:                 m.agentTLS.DeepCopy(),
 		},
 	}, nil
 }
 
-func (m *FwdAuthMiddlewares) createMiddleware(ctx context.Context, name, namespace, canonicalPolName string, cfg *acp.Config) error {
-	spec, err := m.newMiddlewareSpec(canonicalPolName, cfg)
-	if err != nil {
-		return fmt.Errorf("new middleware spec: %w", err)
+// resolvePolicies returns the configurations of the non-composite policies the given policy is made of. visited holds
+// the composite policies being resolved, to detect policies referencing themselves.
+func (m *FwdAuthMiddlewares) resolvePolicies(cfg *acp.Config, visited map[string]struct{}) ([]*acp.Config, error) {
+	if cfg.Composite == nil {
+		return []*acp.Config{cfg}, nil
+	}
+
+	var cfgs []*acp.Config
+	for _, polName := range cfg.Composite.Policies() {
+		if _, ok := visited[polName]; ok {
+			return nil, fmt.Errorf("ACP %q references itself", polName)
+		}
+
+		polCfg, err := m.policies.GetConfig(polName)
+		if err != nil {
+			return nil, err
+		}
+
+		visited[polName] = struct{}{}
+		resolved, err := m.resolvePolicies(polCfg, visited)
+		delete(visited, polName)
+		if err != nil {
+			return nil, err
+		}
+
+		cfgs = append(cfgs, resolved...)
+	}
+
+	return cfgs, nil
+}
+
+func appendUnique(values []string, newValues ...string) []string {
+	for _, nv := range newValues {
+		var found bool
+		for _, v := range values {
+			if v == nv {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			values = append(values, nv)
+		}
 	}
 
+	return values
+}
+
+func (m *FwdAuthMiddlewares) createMiddleware(ctx context.Context, name, namespace string, spec traefikv1alpha1.MiddlewareSpec) error {
 	mdlwr := &traefikv1alpha1.Middleware{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
@@ -147,7 +268,7 @@ func (m *FwdAuthMiddlewares) createMiddleware(ctx context.Context, name, namespa
 		Spec: spec,
 	}
 
-	_, err = m.traefikClientSet.Middlewares(namespace).Create(ctx, mdlwr, metav1.CreateOptions{FieldManager: "hub-auth"})
+	_, err := m.traefikClientSet.Middlewares(namespace).Create(ctx, mdlwr, metav1.CreateOptions{FieldManager: "hub-auth"})
 	if err != nil {
 		return fmt.Errorf("create middleware: %w", err)
 	}
@@ -121,7 +121,7 @@ func TestTraefikIngressRoute_CanReviewChecksKind(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			t.Parallel()
 
-			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, nil)
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, nil, nil)
 			review := NewTraefikIngressRoute(fwdAuthMdlwrs)
 
 			var ing netv1.Ingress
@@ -300,7 +300,7 @@ func TestTraefikIngressRoute_ReviewAddsAuthentication(t *testing.T) {
 			policies := newPolicyGetterMock(t)
 			policies.OnGetConfig("my-policy@test").TypedReturns(test.config, nil).Once()
 
-			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", policies, traefikClientSet.TraefikV1alpha1())
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, policies, traefikClientSet.TraefikV1alpha1())
 			rev := NewTraefikIngressRoute(fwdAuthMdlwrs)
 
 			oldB, err := json.Marshal(test.oldIng)
@@ -397,7 +397,7 @@ func TestTraefikIngressRoute_ReviewUpdatesExistingMiddleware(t *testing.T) {
 			policies := newPolicyGetterMock(t)
 			policies.OnGetConfig("my-policy@test").TypedReturns(test.config, nil).Once()
 
-			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", policies, traefikClientSet.TraefikV1alpha1())
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, policies, traefikClientSet.TraefikV1alpha1())
 			rev := NewTraefikIngressRoute(fwdAuthMdlwrs)
 
 			ing := traefikv1alpha1.IngressRoute{
@@ -453,3 +453,49 @@ func TestTraefikIngressRoute_ReviewUpdatesExistingMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestTraefikIngressRoute_ReviewConfiguresAgentTLS(t *testing.T) {
+	traefikClientSet := traefikkubemock.NewSimpleClientset()
+
+	policies := newPolicyGetterMock(t)
+	policies.OnGetConfig("my-policy@test").TypedReturns(&acp.Config{BasicAuth: &basicauth.Config{}}, nil).Once()
+
+	agentTLS := &traefikv1alpha1.ClientTLS{
+		CASecret:   "auth-server-ca",
+		CertSecret: "auth-server-client-cert",
+	}
+	fwdAuthMdlwrs := NewFwdAuthMiddlewares("https://hub-agent-auth-server", agentTLS, policies, traefikClientSet.TraefikV1alpha1())
+	rev := NewTraefikIngressRoute(fwdAuthMdlwrs)
+
+	ing := traefikv1alpha1.IngressRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "name",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"hub.traefik.io/access-control-policy": "my-policy@test",
+			},
+		},
+		Spec: traefikv1alpha1.IngressRouteSpec{
+			Routes: []traefikv1alpha1.Route{{Match: "match", Kind: "kind"}},
+		},
+	}
+	b, err := json.Marshal(ing)
+	require.NoError(t, err)
+
+	ar := admv1.AdmissionReview{
+		Request: &admv1.AdmissionRequest{
+			Object: runtime.RawExtension{
+				Raw: b,
+			},
+		},
+	}
+
+	_, err = rev.Review(context.Background(), ar)
+	require.NoError(t, err)
+
+	m, err := traefikClientSet.TraefikV1alpha1().Middlewares("test").Get(context.Background(), "zz-my-policy-test", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://hub-agent-auth-server/my-policy@test", m.Spec.ForwardAuth.Address)
+	assert.Equal(t, agentTLS, m.Spec.ForwardAuth.TLS)
+}
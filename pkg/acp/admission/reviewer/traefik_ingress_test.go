@@ -22,13 +22,19 @@ import (
 	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/admission/ingclass"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/basicauth"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/composite"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/introspection"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/ipallowlist"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/mtls"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/oidc"
 	traefikv1alpha1 "github.com/traefik/hub-agent-kubernetes/pkg/crd/api/traefik/v1alpha1"
 	traefikkubemock "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/traefik/clientset/versioned/fake"
 	admv1 "k8s.io/api/admission/v1"
@@ -125,7 +131,7 @@ func TestTraefikIngress_CanReviewChecksKind(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			t.Parallel()
 
-			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, nil)
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, nil, nil)
 			review := NewTraefikIngress(ingClasses, fwdAuthMdlwrs)
 
 			var ing netv1.Ingress
@@ -271,7 +277,7 @@ func TestTraefikIngress_CanReviewChecksIngressClass(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			t.Parallel()
 
-			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, nil)
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, nil, nil)
 			review := NewTraefikIngress(test.ingressClassesMock(t), fwdAuthMdlwrs)
 
 			ing := netv1.Ingress{
@@ -372,7 +378,7 @@ func TestTraefikIngress_ReviewAddsAuthentication(t *testing.T) {
 			policies := newPolicyGetterMock(t)
 			policies.OnGetConfig("my-policy@test").TypedReturns(test.config, nil).Once()
 
-			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", policies, traefikClientSet.TraefikV1alpha1())
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, policies, traefikClientSet.TraefikV1alpha1())
 
 			rev := NewTraefikIngress(newIngressClassesMock(t), fwdAuthMdlwrs)
 
@@ -437,7 +443,11 @@ func TestTraefikIngress_ReviewUpdatesExistingMiddleware(t *testing.T) {
 	tests := []struct {
 		desc                    string
 		config                  *acp.Config
+		children                map[string]*acp.Config
 		wantAuthResponseHeaders []string
+		wantAuthRequestHeaders  []string
+		wantTrustForwardHeader  bool
+		wantClientCert          bool
 	}{
 		{
 			desc: "Update middleware with JWT configuration",
@@ -457,6 +467,85 @@ func TestTraefikIngress_ReviewUpdatesExistingMiddleware(t *testing.T) {
 			},
 			wantAuthResponseHeaders: []string{"Authorization"},
 		},
+		{
+			desc: "Update middleware with mTLS configuration",
+			config: &acp.Config{
+				MTLS: &mtls.Config{
+					ForwardHeaders: map[string]string{"Subject": "subject"},
+				},
+			},
+			wantAuthResponseHeaders: []string{"Subject"},
+			wantAuthRequestHeaders:  []string{"X-Forwarded-Tls-Client-Cert"},
+			wantClientCert:          true,
+		},
+		{
+			desc: "Update middleware with IP allow list configuration",
+			config: &acp.Config{
+				IPAllowList: &ipallowlist.Config{
+					Allow:             []string{"10.0.0.0/8"},
+					TrustedProxyDepth: 1,
+				},
+			},
+			wantTrustForwardHeader: true,
+		},
+		{
+			desc: "Update middleware with basic auth lockout configuration",
+			config: &acp.Config{
+				BasicAuth: &basicauth.Config{
+					Lockout: &basicauth.LockoutConfig{
+						MaxFailures:       5,
+						Duration:          time.Minute,
+						TrustedProxyDepth: 1,
+					},
+				},
+			},
+			wantTrustForwardHeader: true,
+		},
+		{
+			desc: "Update middleware with basic auth lockout configuration without trusted proxies",
+			config: &acp.Config{
+				BasicAuth: &basicauth.Config{
+					Lockout: &basicauth.LockoutConfig{
+						MaxFailures: 5,
+						Duration:    time.Minute,
+					},
+				},
+			},
+		},
+		{
+			desc: "Update middleware with composite configuration",
+			config: &acp.Config{
+				Composite: &composite.Config{
+					AllOf: []string{"ip", "jwt-or-mtls"},
+				},
+			},
+			children: map[string]*acp.Config{
+				"ip": {
+					IPAllowList: &ipallowlist.Config{
+						Allow:             []string{"10.0.0.0/8"},
+						TrustedProxyDepth: 1,
+					},
+				},
+				"jwt-or-mtls": {
+					Composite: &composite.Config{
+						AnyOf: []string{"jwt", "mtls"},
+					},
+				},
+				"jwt": {
+					JWT: &jwt.Config{
+						ForwardHeaders: map[string]string{"Subject": "sub"},
+					},
+				},
+				"mtls": {
+					MTLS: &mtls.Config{
+						ForwardHeaders: map[string]string{"Subject": "subject"},
+					},
+				},
+			},
+			wantAuthResponseHeaders: []string{"Subject"},
+			wantTrustForwardHeader:  true,
+			wantClientCert:          true,
+		},
 	}
 
 	for _, test := range tests {
@@ -480,8 +569,11 @@ func TestTraefikIngress_ReviewUpdatesExistingMiddleware(t *testing.T) {
 
 			policies := newPolicyGetterMock(t)
 			policies.OnGetConfig("my-policy@test").TypedReturns(test.config, nil).Once()
+			for name, cfg := range test.children {
+				policies.OnGetConfig(name).TypedReturns(cfg, nil).Once()
+			}
 
-			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", policies, traefikClientSet.TraefikV1alpha1())
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, policies, traefikClientSet.TraefikV1alpha1())
 			rev := NewTraefikIngress(newIngressClassesMock(t), fwdAuthMdlwrs)
 
 			ing := struct {
@@ -514,10 +606,105 @@ func TestTraefikIngress_ReviewUpdatesExistingMiddleware(t *testing.T) {
 
 			m, err = traefikClientSet.TraefikV1alpha1().Middlewares("test").
 				Get(context.Background(), "zz-my-policy-test", metav1.GetOptions{})
-			assert.NoError(t, err)
-			assert.NotNil(t, m)
+			require.NoError(t, err)
 
+			if test.wantClientCert {
+				// The client certificate header sent by clients must be replaced by the one of the TLS connection
+				// before reaching the auth server.
+				assert.Nil(t, m.Spec.ForwardAuth)
+				require.NotNil(t, m.Spec.Chain)
+				assert.Equal(t, []traefikv1alpha1.MiddlewareRef{
+					{Name: "zz-my-policy-test-client-cert", Namespace: "test"},
+					{Name: "zz-my-policy-test-forward-auth", Namespace: "test"},
+				}, m.Spec.Chain.Middlewares)
+
+				m, err = traefikClientSet.TraefikV1alpha1().Middlewares("test").
+					Get(context.Background(), "zz-my-policy-test-client-cert", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, &traefikv1alpha1.PassTLSClientCert{PEM: true}, m.Spec.PassTLSClientCert)
+
+				m, err = traefikClientSet.TraefikV1alpha1().Middlewares("test").
+					Get(context.Background(), "zz-my-policy-test-forward-auth", metav1.GetOptions{})
+				require.NoError(t, err)
+			}
+
+			require.NotNil(t, m.Spec.ForwardAuth)
 			assert.Equal(t, test.wantAuthResponseHeaders, m.Spec.ForwardAuth.AuthResponseHeaders)
+			assert.Equal(t, test.wantAuthRequestHeaders, m.Spec.ForwardAuth.AuthRequestHeaders)
+			assert.Equal(t, test.wantTrustForwardHeader, m.Spec.ForwardAuth.TrustForwardHeader)
+		})
+	}
+}
+
+func TestTraefikIngress_ReviewRejectsSpoofableForwardedRequests(t *testing.T) {
+	ipAllowList := &acp.Config{
+		IPAllowList: &ipallowlist.Config{
+			Allow:             []string{"10.0.0.0/8"},
+			TrustedProxyDepth: 1,
+		},
+	}
+
+	tests := []struct {
+		desc    string
+		child   *acp.Config
+		wantErr bool
+	}{
+		{
+			desc:  "JWT without claims",
+			child: &acp.Config{JWT: &jwt.Config{}},
+		},
+		{
+			desc:    "JWT with claims",
+			child:   &acp.Config{JWT: &jwt.Config{Claims: `Equals("group", "dev")`}},
+			wantErr: true,
+		},
+		{
+			desc: "JWT with rules",
+			child: &acp.Config{JWT: &jwt.Config{
+				Rules: []jwt.Rule{{Match: `Method("GET")`}},
+			}},
+			wantErr: true,
+		},
+		{
+			desc:    "OIDC",
+			child:   &acp.Config{OIDC: &oidc.Config{}},
+			wantErr: true,
+		},
+		{
+			desc:    "introspection with claims",
+			child:   &acp.Config{Introspection: &introspection.Config{Claims: `Equals("group", "dev")`}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			traefikClientSet := traefikkubemock.NewSimpleClientset()
+
+			policies := newPolicyGetterMock(t)
+			policies.OnGetConfig("my-policy@test").TypedReturns(&acp.Config{
+				Composite: &composite.Config{AllOf: []string{"ip", "child"}},
+			}, nil).Once()
+			policies.OnGetConfig("ip").TypedReturns(ipAllowList, nil).Once()
+			policies.OnGetConfig("child").TypedReturns(test.child, nil).Once()
+
+			fwdAuthMdlwrs := NewFwdAuthMiddlewares("", nil, policies, traefikClientSet.TraefikV1alpha1())
+
+			_, err := fwdAuthMdlwrs.Setup(context.Background(), "my-policy@test", "test")
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			m, err := traefikClientSet.TraefikV1alpha1().Middlewares("test").
+				Get(context.Background(), "zz-my-policy-test", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.NotNil(t, m.Spec.ForwardAuth)
+			assert.True(t, m.Spec.ForwardAuth.TrustForwardHeader)
 		})
 	}
 }
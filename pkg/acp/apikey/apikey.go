@@ -0,0 +1,176 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const defaultKeyHeader = "X-Api-Key"
+
+// SecretHashKey is the key of the Secret data entry holding the hex-encoded SHA-256 hash of an API key.
+// All other entries of the Secret are metadata about the key, which can be forwarded as headers.
+const SecretHashKey = "hash"
+
+// Config configures an API key ACP handler.
+type Config struct {
+	KeyHeader string
+	KeyQuery  string
+	// SecretSelector is a label selector selecting the Secrets holding the API keys. Each Secret holds a single key.
+	SecretSelector string
+	// ForwardHeaders maps header names to key metadata names.
+	ForwardHeaders map[string]string
+}
+
+// Handler is an API key ACP Handler.
+type Handler struct {
+	name string
+
+	keyHeader string
+	keyQuery  string
+
+	keys       map[string]map[string]string
+	fwdHeaders map[string]string
+}
+
+// NewHandler returns a new API key ACP Handler. Keys are loaded from the given Secrets matching the configured selector.
+func NewHandler(cfg *Config, polName string, secrets []*corev1.Secret) (*Handler, error) {
+	if cfg.SecretSelector == "" {
+		return nil, errors.New("a secret selector is required")
+	}
+
+	selector, err := labels.Parse(cfg.SecretSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parse secret selector: %w", err)
+	}
+
+	keyHeader := cfg.KeyHeader
+	if keyHeader == "" && cfg.KeyQuery == "" {
+		keyHeader = defaultKeyHeader
+	}
+
+	return &Handler{
+		name:       polName,
+		keyHeader:  keyHeader,
+		keyQuery:   cfg.KeyQuery,
+		keys:       loadKeys(polName, selector, secrets),
+		fwdHeaders: cfg.ForwardHeaders,
+	}, nil
+}
+
+// loadKeys returns the metadata of the keys held by the selected secrets, indexed by key hash.
+func loadKeys(polName string, selector labels.Selector, secrets []*corev1.Secret) map[string]map[string]string {
+	keys := make(map[string]map[string]string)
+
+	for _, secret := range secrets {
+		if !selector.Matches(labels.Set(secret.Labels)) {
+			continue
+		}
+
+		logger := log.With().Str("acp_name", polName).Str("secret_name", secret.Name).Logger()
+
+		hash, err := hex.DecodeString(strings.TrimSpace(string(secret.Data[SecretHashKey])))
+		if err != nil || len(hash) != sha256.Size {
+			logger.Error().Msgf("Ignoring Secret, %q must hold an hex-encoded SHA-256 hash", SecretHashKey)
+			continue
+		}
+
+		if _, ok := keys[string(hash)]; ok {
+			logger.Warn().Msg("Ignoring Secret, key already defined by another Secret")
+			continue
+		}
+
+		metadata := make(map[string]string, len(secret.Data)-1)
+		for k, v := range secret.Data {
+			if k == SecretHashKey {
+				continue
+			}
+			metadata[k] = string(v)
+		}
+
+		keys[string(hash)] = metadata
+	}
+
+	return keys
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	l := log.With().Str("handler_type", "APIKey").Str("handler_name", h.name).Logger()
+
+	key := h.extractKey(req)
+	if key == "" {
+		l.Debug().Msg("No API key found in request")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	hash := sha256.Sum256([]byte(key))
+
+	metadata, ok := h.keys[string(hash[:])]
+	if !ok {
+		l.Debug().Msg("Unknown API key")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	for name, field := range h.fwdHeaders {
+		if val, ok := metadata[field]; ok {
+			rw.Header().Set(name, val)
+		}
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// extractKey extracts the API key from the request. It first looks in the configured header then in the configured
+// query parameter.
+func (h *Handler) extractKey(req *http.Request) string {
+	if h.keyHeader != "" {
+		if key := req.Header.Get(h.keyHeader); key != "" {
+			return key
+		}
+	}
+
+	if h.keyQuery != "" {
+		return queryParam(req, h.keyQuery)
+	}
+
+	return ""
+}
+
+// queryParam returns the value of the given query parameter of the authenticated request. It reads it from the
+// X-Forwarded-Uri header set by Traefik, and falls back to the request URL.
+func queryParam(req *http.Request, name string) string {
+	if uri := req.Header.Get("X-Forwarded-Uri"); uri != "" {
+		if u, err := url.ParseRequestURI(uri); err == nil {
+			return u.Query().Get(name)
+		}
+	}
+
+	return req.URL.Query().Get(name)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewHandler(t *testing.T) {
+	tests := []struct {
+		desc    string
+		cfg     Config
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			desc:    "missing selector",
+			cfg:     Config{},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "invalid selector",
+			cfg:     Config{SecretSelector: "app in (foo"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "valid",
+			cfg:     Config{SecretSelector: "app=foo"},
+			wantErr: assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&test.cfg, "my-policy", nil)
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	secrets := []*corev1.Secret{
+		createSecret("alice", map[string]string{"app": "foo"}, map[string]string{
+			SecretHashKey: hashKey("alice-key"),
+			"owner":       "alice",
+		}),
+		createSecret("bob", map[string]string{"app": "bar"}, map[string]string{
+			SecretHashKey: hashKey("bob-key"),
+			"owner":       "bob",
+		}),
+		createSecret("invalid", map[string]string{"app": "foo"}, map[string]string{
+			SecretHashKey: "not-a-hash",
+		}),
+	}
+
+	tests := []struct {
+		desc           string
+		cfg            Config
+		header         http.Header
+		uri            string
+		wantStatusCode int
+		wantOwner      string
+	}{
+		{
+			desc:           "no key",
+			cfg:            Config{SecretSelector: "app=foo"},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "valid key in default header",
+			cfg:            Config{SecretSelector: "app=foo", ForwardHeaders: map[string]string{"X-Owner": "owner"}},
+			header:         http.Header{"X-Api-Key": []string{"alice-key"}},
+			wantStatusCode: http.StatusOK,
+			wantOwner:      "alice",
+		},
+		{
+			desc:           "valid key in custom header",
+			cfg:            Config{KeyHeader: "X-Token", SecretSelector: "app=foo", ForwardHeaders: map[string]string{"X-Owner": "owner"}},
+			header:         http.Header{"X-Token": []string{"alice-key"}},
+			wantStatusCode: http.StatusOK,
+			wantOwner:      "alice",
+		},
+		{
+			desc:           "valid key in query",
+			cfg:            Config{KeyQuery: "api_key", SecretSelector: "app=foo", ForwardHeaders: map[string]string{"X-Owner": "owner"}},
+			uri:            "/foo?api_key=alice-key",
+			wantStatusCode: http.StatusOK,
+			wantOwner:      "alice",
+		},
+		{
+			desc:           "key from a non selected secret",
+			cfg:            Config{SecretSelector: "app=foo"},
+			header:         http.Header{"X-Api-Key": []string{"bob-key"}},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "unknown key",
+			cfg:            Config{SecretSelector: "app=foo"},
+			header:         http.Header{"X-Api-Key": []string{"unknown"}},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHandler(&test.cfg, "my-policy", secrets)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			for k, v := range test.header {
+				req.Header[k] = v
+			}
+			if test.uri != "" {
+				req.Header.Set("X-Forwarded-Uri", test.uri)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+			assert.Equal(t, test.wantOwner, rw.Header().Get("X-Owner"))
+		})
+	}
+}
+
+func createSecret(name string, lbls, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "hub-agent", Labels: lbls},
+		Data:       make(map[string][]byte),
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+
+	return secret
+}
+
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
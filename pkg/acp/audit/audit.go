@@ -0,0 +1,364 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/forwarded"
+)
+
+// Decisions of ACPs.
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+)
+
+// Record fields which can be redacted.
+const (
+	FieldSubject  = "subject"
+	FieldHost     = "host"
+	FieldURI      = "uri"
+	FieldClientIP = "clientIp"
+)
+
+const redacted = "redacted"
+
+var droppedRecords = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "hub_agent",
+	Subsystem: "audit",
+	Name:      "dropped_records_total",
+	Help:      "Number of audit records dropped because the buffer of an audit sink was full.",
+})
+
+// Record is the audit record of an authorization decision.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Policy     string    `json:"policy"`
+	Decision   string    `json:"decision"`
+	StatusCode int       `json:"statusCode"`
+	Reason     string    `json:"reason,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	Host       string    `json:"host,omitempty"`
+	URI        string    `json:"uri,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+}
+
+// Sink writes audit records somewhere. Sinks implementing io.Closer are closed when the auditor stops.
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// Config configures an Auditor.
+type Config struct {
+	Sinks []Sink
+	// SampleRate is the fraction of allowed decisions which are recorded, between 0 and 1. Denials are always recorded.
+	SampleRate float64
+	// Redact is the list of record fields whose value is replaced by "redacted".
+	Redact []string
+	// BufferSize is the number of records which can wait to be written to each sink. Records are dropped for a sink
+	// when its buffer is full, so decisions are never delayed by sinks and a slow sink does not delay the others.
+	BufferSize int
+	// TrustedProxyDepth is the number of trusted proxies in front of Traefik. The client IP is the one found at this
+	// depth in the X-Forwarded-For header, starting from the right.
+	TrustedProxyDepth int
+}
+
+// Auditor records the decisions of ACP handlers and writes them to sinks.
+type Auditor struct {
+	queues     []*sinkQueue
+	sampleRate float64
+	redact     map[string]struct{}
+	depth      int
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// NewAuditor returns a new Auditor.
+func NewAuditor(cfg Config) (*Auditor, error) {
+	if len(cfg.Sinks) == 0 {
+		return nil, errors.New("at least one sink is required")
+	}
+
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate must be between 0 and 1, got %v", cfg.SampleRate)
+	}
+
+	if cfg.BufferSize <= 0 {
+		return nil, errors.New("buffer size must be positive")
+	}
+
+	if cfg.TrustedProxyDepth < 0 {
+		return nil, errors.New("trusted proxy depth must not be negative")
+	}
+
+	redact := make(map[string]struct{})
+	for _, field := range cfg.Redact {
+		switch field {
+		case FieldSubject, FieldHost, FieldURI, FieldClientIP:
+			redact[field] = struct{}{}
+		default:
+			return nil, fmt.Errorf("unknown redacted field %q", field)
+		}
+	}
+
+	queues := make([]*sinkQueue, 0, len(cfg.Sinks))
+	for _, sink := range cfg.Sinks {
+		queues = append(queues, &sinkQueue{sink: sink, records: make(chan Record, cfg.BufferSize)})
+	}
+
+	return &Auditor{
+		queues:     queues,
+		sampleRate: cfg.SampleRate,
+		redact:     redact,
+		depth:      cfg.TrustedProxyDepth,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Run writes the recorded decisions to the sinks until the given context is done. Pending records are then written
+// and sinks closed.
+func (a *Auditor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, q := range a.queues {
+		wg.Add(1)
+		go func(q *sinkQueue) {
+			defer wg.Done()
+
+			q.run(ctx)
+		}(q)
+	}
+
+	wg.Wait()
+}
+
+// sinkQueue holds the records waiting to be written to a sink. Each sink is written to from its own goroutine, so a
+// slow sink does not delay the others.
+type sinkQueue struct {
+	sink    Sink
+	records chan Record
+}
+
+func (q *sinkQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			q.drain()
+			q.close()
+			return
+		case record := <-q.records:
+			q.write(ctx, record)
+		}
+	}
+}
+
+func (q *sinkQueue) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for {
+		select {
+		case record := <-q.records:
+			q.write(ctx, record)
+		default:
+			return
+		}
+	}
+}
+
+func (q *sinkQueue) write(ctx context.Context, record Record) {
+	if err := q.sink.Write(ctx, record); err != nil {
+		log.Error().Err(err).Str("acp_name", record.Policy).Msg("Unable to write audit record")
+	}
+}
+
+func (q *sinkQueue) close() {
+	closer, ok := q.sink.(io.Closer)
+	if !ok {
+		return
+	}
+
+	if err := closer.Close(); err != nil {
+		log.Error().Err(err).Msg("Unable to close audit sink")
+	}
+}
+
+// Middleware records the decisions of the given handler, which serves ACPs on paths named after them.
+func (a *Auditor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		d := &decision{}
+		req = req.WithContext(context.WithValue(req.Context(), decisionKey{}, d))
+
+		rec := &statusRecorder{ResponseWriter: rw, code: http.StatusOK}
+		next.ServeHTTP(rec, req)
+
+		a.record(req, rec, d)
+	})
+}
+
+func (a *Auditor) record(req *http.Request, rec *statusRecorder, d *decision) {
+	record := Record{
+		Time:       time.Now().UTC(),
+		Policy:     strings.TrimPrefix(req.URL.Path, "/"),
+		Decision:   DecisionAllow,
+		StatusCode: rec.code,
+		Subject:    d.subject,
+		Host:       req.Header.Get("X-Forwarded-Host"),
+		URI:        req.Header.Get("X-Forwarded-Uri"),
+		Method:     req.Header.Get("X-Forwarded-Method"),
+		ClientIP:   a.clientIP(req),
+		Reason:     d.reason,
+	}
+
+	if rec.code < 200 || rec.code >= 300 {
+		record.Decision = DecisionDeny
+		if record.Reason == "" {
+			record.Reason = denialReason(rec)
+		}
+	} else if !a.sample() {
+		return
+	}
+
+	for field := range a.redact {
+		switch field {
+		case FieldSubject:
+			record.Subject = redactValue(record.Subject)
+		case FieldHost:
+			record.Host = redactValue(record.Host)
+		case FieldURI:
+			record.URI = redactValue(record.URI)
+		case FieldClientIP:
+			record.ClientIP = redactValue(record.ClientIP)
+		}
+	}
+
+	for _, q := range a.queues {
+		select {
+		case q.records <- record:
+		default:
+			droppedRecords.Inc()
+		}
+	}
+}
+
+func (a *Auditor) sample() bool {
+	if a.sampleRate >= 1 {
+		return true
+	}
+
+	a.randMu.Lock()
+	defer a.randMu.Unlock()
+
+	return a.rand.Float64() < a.sampleRate
+}
+
+func redactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+var errorDescriptionRegexp = regexp.MustCompile(`error_description="([^"]*)"`)
+
+// denialReason returns the reason of a denial from its response: the error description of the WWW-Authenticate
+// header if any, the status text otherwise.
+func denialReason(rec *statusRecorder) string {
+	if m := errorDescriptionRegexp.FindStringSubmatch(rec.Header().Get("WWW-Authenticate")); m != nil {
+		return m[1]
+	}
+
+	return http.StatusText(rec.code)
+}
+
+// clientIP returns the IP of the client of the authorized request. When Traefik does not forward the whole
+// X-Forwarded-For chain, it cannot be found behind trusted proxies and the peer of Traefik is recorded instead.
+func (a *Auditor) clientIP(req *http.Request) string {
+	if ip := forwarded.ClientIP(req, a.depth); ip != nil {
+		return ip.String()
+	}
+
+	if ip := forwarded.ClientIP(req, 0); ip != nil {
+		return ip.String()
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+type decisionKey struct{}
+
+// decision holds the details ACP handlers give about their decision.
+type decision struct {
+	subject string
+	reason  string
+}
+
+// SetSubject sets the subject of the request being authorized, that is the user or client it has been authenticated
+// as. It is a no-op if decisions are not audited.
+func SetSubject(ctx context.Context, subject string) {
+	d, ok := ctx.Value(decisionKey{}).(*decision)
+	if !ok {
+		return
+	}
+
+	d.subject = subject
+}
+
+// SetReason sets the reason of the decision taken for the request being authorized. It is a no-op if decisions are
+// not audited.
+func SetReason(ctx context.Context, reason string) {
+	d, ok := ctx.Value(decisionKey{}).(*decision)
+	if !ok {
+		return
+	}
+
+	d.reason = reason
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,405 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuditor(t *testing.T) {
+	sinks := []Sink{&memorySink{}}
+
+	tests := []struct {
+		desc    string
+		cfg     Config
+		wantErr bool
+	}{
+		{
+			desc: "valid configuration",
+			cfg:  Config{Sinks: sinks, SampleRate: 0.5, Redact: []string{FieldSubject, FieldClientIP}, BufferSize: 10},
+		},
+		{
+			desc:    "no sink",
+			cfg:     Config{SampleRate: 1, BufferSize: 10},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid sample rate",
+			cfg:     Config{Sinks: sinks, SampleRate: 2, BufferSize: 10},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown redacted field",
+			cfg:     Config{Sinks: sinks, SampleRate: 1, Redact: []string{"password"}, BufferSize: 10},
+			wantErr: true,
+		},
+		{
+			desc:    "no buffer",
+			cfg:     Config{Sinks: sinks, SampleRate: 1},
+			wantErr: true,
+		},
+		{
+			desc:    "negative trusted proxy depth",
+			cfg:     Config{Sinks: sinks, SampleRate: 1, BufferSize: 10, TrustedProxyDepth: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewAuditor(test.cfg)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuditor_Middleware(t *testing.T) {
+	tests := []struct {
+		desc       string
+		sampleRate float64
+		redact     []string
+		handler    http.HandlerFunc
+		wantRecord *Record
+	}{
+		{
+			desc:       "allowed request",
+			sampleRate: 1,
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				SetSubject(req.Context(), "john")
+				rw.WriteHeader(http.StatusOK)
+			},
+			wantRecord: &Record{
+				Policy:     "my-policy",
+				Decision:   DecisionAllow,
+				StatusCode: http.StatusOK,
+				Subject:    "john",
+				Host:       "my-app.example.com",
+				URI:        "/admin?page=1",
+				Method:     http.MethodPost,
+				ClientIP:   "192.168.1.1",
+			},
+		},
+		{
+			desc:       "denied request with error description",
+			sampleRate: 1,
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token is expired"`)
+				rw.WriteHeader(http.StatusUnauthorized)
+			},
+			wantRecord: &Record{
+				Policy:     "my-policy",
+				Decision:   DecisionDeny,
+				StatusCode: http.StatusUnauthorized,
+				Reason:     "token is expired",
+				Host:       "my-app.example.com",
+				URI:        "/admin?page=1",
+				Method:     http.MethodPost,
+				ClientIP:   "192.168.1.1",
+			},
+		},
+		{
+			desc:       "denied request with reason",
+			sampleRate: 1,
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				SetReason(req.Context(), "not allowed")
+				rw.WriteHeader(http.StatusForbidden)
+			},
+			wantRecord: &Record{
+				Policy:     "my-policy",
+				Decision:   DecisionDeny,
+				StatusCode: http.StatusForbidden,
+				Reason:     "not allowed",
+				Host:       "my-app.example.com",
+				URI:        "/admin?page=1",
+				Method:     http.MethodPost,
+				ClientIP:   "192.168.1.1",
+			},
+		},
+		{
+			desc:       "denied request without reason",
+			sampleRate: 1,
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusForbidden)
+			},
+			wantRecord: &Record{
+				Policy:     "my-policy",
+				Decision:   DecisionDeny,
+				StatusCode: http.StatusForbidden,
+				Reason:     "Forbidden",
+				Host:       "my-app.example.com",
+				URI:        "/admin?page=1",
+				Method:     http.MethodPost,
+				ClientIP:   "192.168.1.1",
+			},
+		},
+		{
+			desc:       "redacted fields",
+			sampleRate: 1,
+			redact:     []string{FieldSubject, FieldURI, FieldClientIP},
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				SetSubject(req.Context(), "john")
+				rw.WriteHeader(http.StatusOK)
+			},
+			wantRecord: &Record{
+				Policy:     "my-policy",
+				Decision:   DecisionAllow,
+				StatusCode: http.StatusOK,
+				Subject:    "redacted",
+				Host:       "my-app.example.com",
+				URI:        "redacted",
+				Method:     http.MethodPost,
+				ClientIP:   "redacted",
+			},
+		},
+		{
+			desc:       "allowed request not sampled",
+			sampleRate: 0,
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			},
+		},
+		{
+			desc:       "denied request always sampled",
+			sampleRate: 0,
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusForbidden)
+			},
+			wantRecord: &Record{
+				Policy:     "my-policy",
+				Decision:   DecisionDeny,
+				StatusCode: http.StatusForbidden,
+				Reason:     "Forbidden",
+				Host:       "my-app.example.com",
+				URI:        "/admin?page=1",
+				Method:     http.MethodPost,
+				ClientIP:   "192.168.1.1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			a, err := NewAuditor(Config{
+				Sinks:      []Sink{&memorySink{}},
+				SampleRate: test.sampleRate,
+				Redact:     test.redact,
+				BufferSize: 1,
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			req.Header.Set("X-Forwarded-Method", http.MethodPost)
+			req.Header.Set("X-Forwarded-Host", "my-app.example.com")
+			req.Header.Set("X-Forwarded-Uri", "/admin?page=1")
+			req.Header.Set("X-Forwarded-For", "10.0.0.1, 192.168.1.1")
+
+			rw := httptest.NewRecorder()
+			a.Middleware(test.handler).ServeHTTP(rw, req)
+
+			records := a.queues[0].records
+			if test.wantRecord == nil {
+				assert.Empty(t, records)
+				return
+			}
+
+			require.Len(t, records, 1)
+			got := <-records
+
+			assert.WithinDuration(t, time.Now(), got.Time, time.Minute)
+			got.Time = time.Time{}
+			assert.Equal(t, *test.wantRecord, got)
+		})
+	}
+}
+
+func TestAuditor_clientIP(t *testing.T) {
+	tests := []struct {
+		desc          string
+		depth         int
+		xForwardedFor []string
+		remoteAddr    string
+		want          string
+	}{
+		{
+			desc:          "peer of Traefik",
+			xForwardedFor: []string{"192.168.1.1"},
+			want:          "192.168.1.1",
+		},
+		{
+			desc:          "client supplied entries are ignored",
+			xForwardedFor: []string{"10.0.0.1, 10.0.0.2", "192.168.1.1"},
+			want:          "192.168.1.1",
+		},
+		{
+			desc:          "behind trusted proxies",
+			depth:         1,
+			xForwardedFor: []string{"10.0.0.1, 192.168.1.1, 172.16.0.1"},
+			want:          "192.168.1.1",
+		},
+		{
+			desc:          "chain shorter than the trusted proxy depth",
+			depth:         2,
+			xForwardedFor: []string{"192.168.1.1"},
+			want:          "192.168.1.1",
+		},
+		{
+			desc:       "no X-Forwarded-For header",
+			remoteAddr: "192.168.1.1:1234",
+			want:       "192.168.1.1",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			a, err := NewAuditor(Config{
+				Sinks:             []Sink{&memorySink{}},
+				SampleRate:        1,
+				BufferSize:        1,
+				TrustedProxyDepth: test.depth,
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			req.RemoteAddr = test.remoteAddr
+			for _, value := range test.xForwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			assert.Equal(t, test.want, a.clientIP(req))
+		})
+	}
+}
+
+func TestAuditor_Run(t *testing.T) {
+	sink := &memorySink{}
+
+	a, err := NewAuditor(Config{Sinks: []Sink{sink}, SampleRate: 1, BufferSize: 10})
+	require.NoError(t, err)
+
+	h := a.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Pending records are written when stopping.
+	a.Run(ctx)
+
+	assert.Len(t, sink.written(), 3)
+	assert.True(t, sink.closed)
+}
+
+func TestAuditor_Run_slowSink(t *testing.T) {
+	slow := &blockingSink{release: make(chan struct{})}
+	sink := &memorySink{}
+
+	a, err := NewAuditor(Config{Sinks: []Sink{slow, sink}, SampleRate: 1, BufferSize: 10})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+
+	h := a.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil))
+	}
+
+	// Records are written to the other sinks while the slow one is blocked.
+	assert.Eventually(t, func() bool { return len(sink.written()) == 3 }, time.Second, 10*time.Millisecond)
+
+	close(slow.release)
+	cancel()
+	<-done
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&slow.writes))
+	assert.True(t, sink.closed)
+}
+
+type blockingSink struct {
+	release chan struct{}
+	writes  int32
+}
+
+func (s *blockingSink) Write(_ context.Context, _ Record) error {
+	<-s.release
+	atomic.AddInt32(&s.writes, 1)
+
+	return nil
+}
+
+type memorySink struct {
+	mu      sync.Mutex
+	records []Record
+	closed  bool
+}
+
+func (s *memorySink) Write(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, record)
+
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+
+	return nil
+}
+
+func (s *memorySink) written() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.records
+}
@@ -0,0 +1,206 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WriterSink writes audit records as JSON lines to a writer.
+type WriterSink struct {
+	w io.Writer
+}
+
+// NewWriterSink returns a new WriterSink.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Write writes the given record.
+func (s *WriterSink) Write(_ context.Context, record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+
+	if _, err = s.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+
+	return nil
+}
+
+// FileSink writes audit records as JSON lines to a file. The file is rotated when it reaches its maximum size: it is
+// renamed with a ".1" suffix, the previous backups being shifted and the oldest ones removed.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+// NewFileSink returns a new FileSink writing to the file at the given path.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("max size must be positive")
+	}
+
+	if maxBackups < 0 {
+		return nil, errors.New("max backups must not be negative")
+	}
+
+	s := &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Write writes the given record, rotating the file if needed.
+func (s *FileSink) Write(_ context.Context, record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+	b = append(b, '\n')
+
+	if s.size > 0 && s.size+int64(len(b)) > s.maxSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat audit file: %w", err)
+	}
+
+	s.file = f
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("close audit file: %w", err)
+	}
+
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove audit file: %w", err)
+		}
+
+		return s.open()
+	}
+
+	for i := s.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(s.backup(i), s.backup(i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("rotate audit file: %w", err)
+		}
+	}
+
+	if err := os.Rename(s.path, s.backup(1)); err != nil {
+		return fmt.Errorf("rotate audit file: %w", err)
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) backup(i int) string {
+	return s.path + "." + strconv.Itoa(i)
+}
+
+// WebhookSink sends audit records as JSON to a webhook.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a new WebhookSink.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Write sends the given record.
+func (s *WebhookSink) Write(ctx context.Context, record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send audit record: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %q", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterSink_Write(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+
+	err := sink.Write(context.Background(), Record{Policy: "my-policy", Decision: DecisionDeny, StatusCode: http.StatusForbidden})
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"time":"0001-01-01T00:00:00Z","policy":"my-policy","decision":"deny","statusCode":403}`+"\n", buf.String())
+}
+
+func TestFileSink_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	record := Record{Policy: "my-policy", Decision: DecisionAllow, StatusCode: http.StatusOK}
+	b, err := json.Marshal(record)
+	require.NoError(t, err)
+	line := string(b) + "\n"
+
+	// Each file can hold two records.
+	sink, err := NewFileSink(path, int64(2*len(line)), 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		err = sink.Write(context.Background(), record)
+		require.NoError(t, err)
+	}
+	require.NoError(t, sink.Close())
+
+	for file, wantRecords := range map[string]int{path: 1, path + ".1": 2, path + ".2": 2} {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		assert.Equal(t, strings.Repeat(line, wantRecords), string(content), file)
+	}
+
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWebhookSink_Write(t *testing.T) {
+	var got Record
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	record := Record{Policy: "my-policy", Decision: DecisionDeny, StatusCode: http.StatusUnauthorized, Subject: "john"}
+
+	err := NewWebhookSink(srv.URL).Write(context.Background(), record)
+	require.NoError(t, err)
+	assert.Equal(t, record, got)
+
+	err = NewWebhookSink(srv.URL+"/unknown\x7f").Write(context.Background(), record)
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcomes of ACP decisions.
+const (
+	outcomeAllow = "allow"
+	outcomeDeny  = "deny"
+)
+
+// Results of ACP handler builds.
+const (
+	buildSuccess = "success"
+	buildFailure = "failure"
+)
+
+var (
+	decisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hub_agent",
+		Subsystem: "acp",
+		Name:      "decisions_total",
+		Help:      "Number of requests authorized or denied by ACPs.",
+	}, []string{"policy", "outcome"})
+
+	decisionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "hub_agent",
+		Subsystem: "acp",
+		Name:      "decision_duration_seconds",
+		Help:      "Time taken by ACPs to authorize or deny requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"policy"})
+
+	handlerBuilds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hub_agent",
+		Subsystem: "acp",
+		Name:      "handler_builds_total",
+		Help:      "Number of times ACP handlers have been built, following a change of their configuration or of the Secrets and ConfigMaps they reference.",
+	}, []string{"policy", "result"})
+
+	loadedPolicies = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "hub_agent",
+		Subsystem: "acp",
+		Name:      "loaded_policies",
+		Help:      "Number of ACPs currently served.",
+	})
+)
+
+// instrument returns a handler reporting the decisions of the handler of the given ACP.
+func instrument(name string, h http.Handler) http.Handler {
+	allowed := decisions.WithLabelValues(name, outcomeAllow)
+	denied := decisions.WithLabelValues(name, outcomeDeny)
+	duration := decisionDuration.WithLabelValues(name)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		sw := &statusWriter{ResponseWriter: rw, code: http.StatusOK}
+		h.ServeHTTP(sw, req)
+
+		duration.Observe(time.Since(start).Seconds())
+
+		if sw.code >= 200 && sw.code < 300 {
+			allowed.Inc()
+			return
+		}
+		denied.Inc()
+	})
+}
+
+// forgetPolicyMetrics removes the metrics of the given ACP, which is not served anymore.
+func forgetPolicyMetrics(name string) {
+	decisions.DeleteLabelValues(name, outcomeAllow)
+	decisions.DeleteLabelValues(name, outcomeDeny)
+	decisionDuration.DeleteLabelValues(name)
+	handlerBuilds.DeleteLabelValues(name, buildSuccess)
+	handlerBuilds.DeleteLabelValues(name, buildFailure)
+	reportOnlyDenials.DeleteLabelValues(name)
+}
+
+// statusWriter records the status code written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
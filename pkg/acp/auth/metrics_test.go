@@ -0,0 +1,61 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/ipallowlist"
+)
+
+func TestBuildRoutes_metrics(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-metrics-policy": {IPAllowList: &ipallowlist.Config{Allow: []string{"10.0.0.0/8"}}},
+		"my-metrics-invalid": {
+			IPAllowList: &ipallowlist.Config{Allow: []string{"10.0.0.0/8"}},
+			Enforcement: "audit",
+		},
+	}
+
+	routes, built := buildRoutes(nil, cfgs, nil, nil)
+
+	for _, remoteAddr := range []string{"10.1.2.3", "10.4.5.6", "192.168.1.1"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/my-metrics-policy", nil)
+		req.Header.Set("X-Forwarded-For", remoteAddr)
+		routes.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	routes.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost/my-metrics-invalid", nil))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(decisions.WithLabelValues("my-metrics-policy", outcomeAllow)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(decisions.WithLabelValues("my-metrics-policy", outcomeDeny)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(decisions.WithLabelValues("my-metrics-invalid", outcomeDeny)))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(handlerBuilds.WithLabelValues("my-metrics-policy", buildSuccess)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(handlerBuilds.WithLabelValues("my-metrics-invalid", buildFailure)))
+
+	// Unchanged ACPs are not rebuilt.
+	buildRoutes(built, cfgs, nil, nil)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(handlerBuilds.WithLabelValues("my-metrics-policy", buildSuccess)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(handlerBuilds.WithLabelValues("my-metrics-invalid", buildFailure)))
+}
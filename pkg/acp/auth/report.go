@@ -0,0 +1,95 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/audit"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/response"
+)
+
+var reportOnlyDenials = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "hub_agent",
+	Subsystem: "acp",
+	Name:      "report_only_denials_total",
+	Help:      "Number of requests which would have been denied by ACPs in report-only mode.",
+}, []string{"policy"})
+
+// validateEnforcement makes sure the given enforcement mode is known.
+func validateEnforcement(enforcement string) error {
+	switch enforcement {
+	case "", acp.EnforcementEnforce, acp.EnforcementReportOnly:
+		return nil
+	default:
+		return fmt.Errorf("unknown enforcement mode %q", enforcement)
+	}
+}
+
+// enforce returns the handler serving the given ACP handler according to the given enforcement mode.
+func enforce(name, enforcement string, h http.Handler) (http.Handler, error) {
+	if err := validateEnforcement(enforcement); err != nil {
+		return nil, err
+	}
+
+	if enforcement == acp.EnforcementReportOnly {
+		return reportOnlyHandler{name: name, handler: h}, nil
+	}
+
+	return h, nil
+}
+
+// reportOnlyHandler authorizes all requests, and reports the ones the ACP handler it wraps would have denied.
+type reportOnlyHandler struct {
+	name    string
+	handler http.Handler
+}
+
+func (h reportOnlyHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rec := response.NewRecorder()
+	h.handler.ServeHTTP(rec, req)
+
+	if rec.Authorized() {
+		rec.Replay(rw)
+		return
+	}
+
+	reason := rec.Header().Get("WWW-Authenticate")
+	if reason == "" {
+		reason = http.StatusText(rec.Code())
+	}
+
+	log.Info().
+		Str("acp_name", h.name).
+		Int("status_code", rec.Code()).
+		Str("reason", reason).
+		Str("method", req.Header.Get("X-Forwarded-Method")).
+		Str("host", req.Header.Get("X-Forwarded-Host")).
+		Str("uri", req.Header.Get("X-Forwarded-Uri")).
+		Msg("Request would have been denied by report-only ACP")
+
+	reportOnlyDenials.WithLabelValues(h.name).Inc()
+	audit.SetReason(req.Context(), "would have been denied: "+reason)
+
+	rw.WriteHeader(http.StatusOK)
+}
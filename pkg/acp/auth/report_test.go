@@ -0,0 +1,111 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/composite"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/ipallowlist"
+)
+
+func TestBuildRoutes_reportOnly(t *testing.T) {
+	allowList := &ipallowlist.Config{Allow: []string{"10.0.0.0/8"}}
+
+	cfgs := map[string]*acp.Config{
+		"my-enforced":            {IPAllowList: allowList, Enforcement: acp.EnforcementEnforce},
+		"my-report-only":         {IPAllowList: allowList, Enforcement: acp.EnforcementReportOnly},
+		"my-all-of":              {Composite: &composite.Config{AllOf: []string{"my-report-only"}}},
+		"my-any-of":              {Composite: &composite.Config{AnyOf: []string{"my-report-only", "my-enforced"}}},
+		"my-unknown-enforcement": {IPAllowList: allowList, Enforcement: "audit"},
+	}
+
+	routes, built := buildRoutes(nil, cfgs, nil, nil)
+
+	assert.NoError(t, built["my-enforced"].err)
+	assert.NoError(t, built["my-report-only"].err)
+	assert.NoError(t, built["my-all-of"].err)
+	assert.NoError(t, built["my-any-of"].err)
+	assert.Error(t, built["my-unknown-enforcement"].err)
+
+	tests := []struct {
+		desc           string
+		policy         string
+		remoteAddr     string
+		wantStatusCode int
+		wantDenials    float64
+	}{
+		{
+			desc:           "enforced policy denies",
+			policy:         "my-enforced",
+			remoteAddr:     "192.168.1.1",
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "report-only policy authorizes",
+			policy:         "my-report-only",
+			remoteAddr:     "10.1.2.3",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "report-only policy reports denial",
+			policy:         "my-report-only",
+			remoteAddr:     "192.168.1.1",
+			wantStatusCode: http.StatusOK,
+			wantDenials:    1,
+		},
+		{
+			desc:           "allOf composite enforces its report-only policy",
+			policy:         "my-all-of",
+			remoteAddr:     "192.168.1.1",
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "anyOf composite enforces its report-only policy",
+			policy:         "my-any-of",
+			remoteAddr:     "192.168.1.1",
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "anyOf composite authorized by its report-only policy",
+			policy:         "my-any-of",
+			remoteAddr:     "10.1.2.3",
+			wantStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			denials := testutil.ToFloat64(reportOnlyDenials.WithLabelValues("my-report-only"))
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/"+test.policy, nil)
+			req.Header.Set("X-Forwarded-For", test.remoteAddr)
+
+			routes.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+			assert.Equal(t, test.wantDenials, testutil.ToFloat64(reportOnlyDenials.WithLabelValues("my-report-only"))-denials)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	hubclientset "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/hub/clientset/versioned"
+	kerror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Ready condition of an ACP, reporting whether its handler could be built.
+const (
+	conditionReady = "Ready"
+
+	reasonHandlerBuilt = "HandlerBuilt"
+	reasonBuildFailed  = "BuildFailed"
+)
+
+// statusUpdater writes the Ready condition of ACPs. Conditions are written by a single worker at a limited rate, so
+// building ACP handlers is never delayed by the Kubernetes API.
+type statusUpdater struct {
+	hubClientSet hubclientset.Interface
+
+	mu sync.Mutex
+	// statuses holds, for each ACP, the error to report in its Ready condition, or an empty string if it is ready.
+	statuses map[string]string
+	// queue holds the names of the ACPs whose condition must be written. It is nil when no worker is running.
+	queue workqueue.RateLimitingInterface
+}
+
+func newStatusUpdater(hubClientSet hubclientset.Interface) *statusUpdater {
+	return &statusUpdater{
+		hubClientSet: hubClientSet,
+		statuses:     make(map[string]string),
+	}
+}
+
+// set sets the Ready condition to report for the given built ACPs, and queues the ones whose condition changed.
+func (u *statusUpdater) set(built map[string]*builtPolicy) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for name := range u.statuses {
+		if _, ok := built[name]; !ok {
+			delete(u.statuses, name)
+		}
+	}
+
+	for name, p := range built {
+		var msg string
+		if p.err != nil {
+			msg = p.err.Error()
+		}
+
+		if reported, ok := u.statuses[name]; ok && reported == msg {
+			continue
+		}
+
+		u.statuses[name] = msg
+		if u.queue != nil {
+			u.queue.Add(name)
+		}
+	}
+}
+
+// run writes the Ready condition of ACPs until the given context is done. The conditions of all known ACPs are
+// written when it starts, as they may have changed while another replica was writing them.
+func (u *statusUpdater) run(ctx context.Context) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "acp_status")
+
+	u.mu.Lock()
+	u.queue = queue
+	for name := range u.statuses {
+		queue.Add(name)
+	}
+	u.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		u.mu.Lock()
+		u.queue = nil
+		u.mu.Unlock()
+
+		queue.ShutDown()
+	}()
+
+	for u.processNext(ctx, queue) {
+	}
+}
+
+func (u *statusUpdater) processNext(ctx context.Context, queue workqueue.RateLimitingInterface) bool {
+	item, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(item)
+
+	name := item.(string)
+
+	u.mu.Lock()
+	msg, ok := u.statuses[name]
+	u.mu.Unlock()
+
+	if !ok {
+		// The ACP has been deleted in the meantime.
+		queue.Forget(item)
+		return true
+	}
+
+	if err := u.update(ctx, name, msg); err != nil {
+		log.Error().Err(err).Str("acp_name", name).Msg("Unable to update ACP status")
+		queue.AddRateLimited(item)
+		return true
+	}
+
+	queue.Forget(item)
+
+	return true
+}
+
+// update writes the Ready condition of the given ACP, retrying if the ACP has been modified concurrently.
+func (u *statusUpdater) update(ctx context.Context, name, errMsg string) error {
+	ctxUpdate, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	condition := metav1.Condition{
+		Type:    conditionReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonHandlerBuilt,
+		Message: "ACP handler built successfully",
+	}
+	if errMsg != "" {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonBuildFailed
+		condition.Message = errMsg
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		policy, err := u.hubClientSet.HubV1alpha1().AccessControlPolicies().Get(ctxUpdate, name, metav1.GetOptions{})
+		if kerror.IsNotFound(err) {
+			// The ACP has been deleted in the meantime.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get ACP: %w", err)
+		}
+
+		if current := meta.FindStatusCondition(policy.Status.Conditions, conditionReady); current != nil &&
+			current.Status == condition.Status &&
+			current.Reason == condition.Reason &&
+			current.Message == condition.Message {
+			return nil
+		}
+
+		meta.SetStatusCondition(&policy.Status.Conditions, condition)
+
+		if _, err = u.hubClientSet.HubV1alpha1().AccessControlPolicies().Update(ctxUpdate, policy, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("update ACP: %w", err)
+		}
+
+		log.Debug().Str("acp_name", name).Str("status", string(condition.Status)).Msg("ACP status updated")
+
+		return nil
+	})
+}
@@ -27,9 +27,18 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/apikey"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/basicauth"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/composite"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/introspection"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/ipallowlist"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/mtls"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/oidc"
 	hubv1alpha1 "github.com/traefik/hub-agent-kubernetes/pkg/crd/api/hub/v1alpha1"
+	hubclientset "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/hub/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // NOTE: if we use the same watcher for all resources, then we need to restart it when new CRDs are
@@ -39,34 +48,70 @@ import (
 // add a parameter to NewWatcher to subscribe only to a subset of events.
 
 // Watcher watches access control policy resources and builds configurations out of them.
+// It also watches the Secrets and ConfigMaps ACP handlers may load their credentials and settings from.
 type Watcher struct {
-	configsMu sync.RWMutex
-	configs   map[string]*acp.Config
-	previous  map[string]*acp.Config
+	configsMu          sync.RWMutex
+	configs            map[string]*acp.Config
+	previous           map[string]*acp.Config
+	secrets            map[string]*corev1.Secret
+	previousSecrets    map[string]*corev1.Secret
+	configMaps         map[string]*corev1.ConfigMap
+	previousConfigMaps map[string]*corev1.ConfigMap
 
 	refresh chan struct{}
+	// ready is closed once the ACP handlers have been built for the first time.
+	ready chan struct{}
 
 	switcher *HTTPHandlerSwitcher
+
+	// built holds the ACP handlers of the last build, to be reused by the next one.
+	built map[string]*builtPolicy
+
+	// statuses writes the Ready condition of the ACPs of the last build.
+	statuses *statusUpdater
 }
 
 // NewWatcher returns a new watcher to track ACP resources. It calls the given Updater when an ACP is modified at most
-// once every throttle.
-func NewWatcher(switcher *HTTPHandlerSwitcher) *Watcher {
+// once every throttle. The Ready condition of each ACP is written using the given client set, when running
+// RunStatusUpdates.
+func NewWatcher(switcher *HTTPHandlerSwitcher, hubClientSet hubclientset.Interface) *Watcher {
 	return &Watcher{
-		configs:  make(map[string]*acp.Config),
-		refresh:  make(chan struct{}, 1),
-		switcher: switcher,
+		configs:    make(map[string]*acp.Config),
+		secrets:    make(map[string]*corev1.Secret),
+		configMaps: make(map[string]*corev1.ConfigMap),
+		refresh:    make(chan struct{}, 1),
+		ready:      make(chan struct{}),
+		switcher:   switcher,
+		statuses:   newStatusUpdater(hubClientSet),
+	}
+}
+
+// Ready returns whether the ACP handlers have been built at least once since the watcher has been running.
+func (w *Watcher) Ready() bool {
+	select {
+	case <-w.ready:
+		return true
+	default:
+		return false
 	}
 }
 
-// Run launches listener if the watcher is dirty.
+// Run launches listener if the watcher is dirty. Handlers are built once when it starts, even if there is no ACP,
+// so it should be run once the informers it is registered on have synced.
 func (w *Watcher) Run(ctx context.Context) {
+	select {
+	case w.refresh <- struct{}{}:
+	default:
+	}
+
 	for {
 		select {
 		case <-w.refresh:
 			w.configsMu.RLock()
 
-			if reflect.DeepEqual(w.previous, w.configs) {
+			if reflect.DeepEqual(w.previous, w.configs) &&
+				reflect.DeepEqual(w.previousSecrets, w.secrets) &&
+				reflect.DeepEqual(w.previousConfigMaps, w.configMaps) {
 				w.configsMu.RUnlock()
 				continue
 			}
@@ -76,30 +121,78 @@ func (w *Watcher) Run(ctx context.Context) {
 				cfgs[k] = v
 			}
 
+			secrets := make(map[string]*corev1.Secret, len(w.secrets))
+			for k, v := range w.secrets {
+				secrets[k] = v
+			}
+
+			configMaps := make(map[string]*corev1.ConfigMap, len(w.configMaps))
+			for k, v := range w.configMaps {
+				configMaps[k] = v
+			}
+
 			w.previous = cfgs
+			w.previousSecrets = secrets
+			w.previousConfigMaps = configMaps
 
 			w.configsMu.RUnlock()
 
 			log.Debug().Msg("Refreshing ACP handlers")
 
-			routes, err := buildRoutes(cfgs)
-			if err != nil {
-				log.Error().Err(err).Msg("Unable to switch ACP handlers")
-				continue
+			routes, built := buildRoutes(w.built, cfgs, secrets, configMaps)
+			for name, p := range built {
+				if p.err != nil {
+					log.Error().Err(p.err).Str("acp_name", name).Msg("Unable to build ACP handler, denying all requests")
+				}
 			}
 
 			w.switcher.UpdateHandler(routes)
 
+			for name := range w.built {
+				if _, ok := built[name]; !ok {
+					forgetPolicyMetrics(name)
+				}
+			}
+			w.built = built
+			loadedPolicies.Set(float64(len(cfgs)))
+
+			if !w.Ready() {
+				close(w.ready)
+			}
+
+			w.statuses.set(built)
+
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// RunStatusUpdates writes the Ready condition of the ACPs until the given context is done. Conditions must be written
+// by a single replica of the auth server at a time.
+func (w *Watcher) RunStatusUpdates(ctx context.Context) {
+	w.statuses.run(ctx)
+}
+
 // OnAdd implements Kubernetes cache.ResourceEventHandler so it can be used as an informer event handler.
 func (w *Watcher) OnAdd(obj interface{}) {
-	v, ok := obj.(*hubv1alpha1.AccessControlPolicy)
-	if !ok {
+	switch v := obj.(type) {
+	case *hubv1alpha1.AccessControlPolicy:
+		w.configsMu.Lock()
+		w.configs[v.ObjectMeta.Name] = acp.ConfigFromPolicy(v)
+		w.configsMu.Unlock()
+
+	case *corev1.Secret:
+		w.configsMu.Lock()
+		w.secrets[v.ObjectMeta.Name] = v
+		w.configsMu.Unlock()
+
+	case *corev1.ConfigMap:
+		w.configsMu.Lock()
+		w.configMaps[v.ObjectMeta.Name] = v
+		w.configsMu.Unlock()
+
+	default:
 		log.Error().
 			Str("component", "acp_watcher").
 			Str("type", fmt.Sprintf("%T", obj)).
@@ -107,10 +200,6 @@ func (w *Watcher) OnAdd(obj interface{}) {
 		return
 	}
 
-	w.configsMu.Lock()
-	w.configs[v.ObjectMeta.Name] = acp.ConfigFromPolicy(v)
-	w.configsMu.Unlock()
-
 	select {
 	case w.refresh <- struct{}{}:
 	default:
@@ -119,8 +208,25 @@ func (w *Watcher) OnAdd(obj interface{}) {
 
 // OnUpdate implements Kubernetes cache.ResourceEventHandler so it can be used as an informer event handler.
 func (w *Watcher) OnUpdate(_, newObj interface{}) {
-	v, ok := newObj.(*hubv1alpha1.AccessControlPolicy)
-	if !ok {
+	switch v := newObj.(type) {
+	case *hubv1alpha1.AccessControlPolicy:
+		cfg := acp.ConfigFromPolicy(v)
+
+		w.configsMu.Lock()
+		w.configs[v.ObjectMeta.Name] = cfg
+		w.configsMu.Unlock()
+
+	case *corev1.Secret:
+		w.configsMu.Lock()
+		w.secrets[v.ObjectMeta.Name] = v
+		w.configsMu.Unlock()
+
+	case *corev1.ConfigMap:
+		w.configsMu.Lock()
+		w.configMaps[v.ObjectMeta.Name] = v
+		w.configsMu.Unlock()
+
+	default:
 		log.Error().
 			Str("component", "acp_watcher").
 			Str("type", fmt.Sprintf("%T", newObj)).
@@ -128,12 +234,6 @@ func (w *Watcher) OnUpdate(_, newObj interface{}) {
 		return
 	}
 
-	cfg := acp.ConfigFromPolicy(v)
-
-	w.configsMu.Lock()
-	w.configs[v.ObjectMeta.Name] = cfg
-	w.configsMu.Unlock()
-
 	select {
 	case w.refresh <- struct{}{}:
 	default:
@@ -142,8 +242,23 @@ func (w *Watcher) OnUpdate(_, newObj interface{}) {
 
 // OnDelete implements Kubernetes cache.ResourceEventHandler so it can be used as an informer event handler.
 func (w *Watcher) OnDelete(obj interface{}) {
-	v, ok := obj.(*hubv1alpha1.AccessControlPolicy)
-	if !ok {
+	switch v := obj.(type) {
+	case *hubv1alpha1.AccessControlPolicy:
+		w.configsMu.Lock()
+		delete(w.configs, v.ObjectMeta.Name)
+		w.configsMu.Unlock()
+
+	case *corev1.Secret:
+		w.configsMu.Lock()
+		delete(w.secrets, v.ObjectMeta.Name)
+		w.configsMu.Unlock()
+
+	case *corev1.ConfigMap:
+		w.configsMu.Lock()
+		delete(w.configMaps, v.ObjectMeta.Name)
+		w.configsMu.Unlock()
+
+	default:
 		log.Error().
 			Str("component", "acp_watcher").
 			Str("type", fmt.Sprintf("%T", obj)).
@@ -151,46 +266,345 @@ func (w *Watcher) OnDelete(obj interface{}) {
 		return
 	}
 
-	w.configsMu.Lock()
-	delete(w.configs, v.ObjectMeta.Name)
-	w.configsMu.Unlock()
-
 	select {
 	case w.refresh <- struct{}{}:
 	default:
 	}
 }
 
-func buildRoutes(cfgs map[string]*acp.Config) (http.Handler, error) {
+// buildRoutes builds the handlers of the given ACPs. Each ACP is built independently: an ACP which cannot be built is
+// served by a handler denying all requests. The handlers of the previous build are reused for the ACPs which did not
+// change since then, so they keep their state, like the JWK sets they fetched. The enforcement mode of an ACP only
+// applies to its own route, composite ACPs being built from the handlers of the ACPs they are made of as enforced.
+func buildRoutes(previous map[string]*builtPolicy, cfgs map[string]*acp.Config, secrets map[string]*corev1.Secret, configMaps map[string]*corev1.ConfigMap) (http.Handler, map[string]*builtPolicy) {
+	b := newRouteBuilder(previous, cfgs, secrets, configMaps)
+
 	mux := http.NewServeMux()
+	for name := range cfgs {
+		h, err := b.handler(name)
+		if err == nil {
+			h, err = enforce(name, cfgs[name].Enforcement, h)
+		}
+		if err != nil {
+			h = denyHandler{name: name, err: err}
+		}
 
-	for name, cfg := range cfgs {
-		switch {
-		case cfg.JWT != nil:
-			jwtHandler, err := jwt.NewHandler(cfg.JWT, name)
-			if err != nil {
-				return nil, fmt.Errorf("create %q JWT ACP handler: %w", name, err)
+		mux.Handle("/"+name, instrument(name, h))
+	}
+
+	return mux, b.built
+}
+
+// denyHandler denies all requests. It serves the ACPs which cannot be built.
+type denyHandler struct {
+	name string
+	err  error
+}
+
+func (h denyHandler) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	log.Debug().Err(h.err).Str("acp_name", h.name).Msg("Request denied by invalid ACP")
+	rw.WriteHeader(http.StatusForbidden)
+}
+
+// builtPolicy is the result of the build of an ACP handler, regardless of its enforcement mode.
+type builtPolicy struct {
+	inputs  policyInputs
+	handler http.Handler
+	err     error
+	// lockoutTracker records the failed attempts of a basic auth ACP with lockout. It is kept across the rebuilds of
+	// the handler, so that they do not reset the lockouts.
+	lockoutTracker basicauth.FailureTracker
+}
+
+// policyInputs holds everything an ACP handler is built from.
+type policyInputs struct {
+	cfg        *acp.Config
+	secrets    map[string]*corev1.Secret
+	configMaps map[string]*corev1.ConfigMap
+}
+
+// routeBuilder builds ACP handlers. Each handler is built once, so that composite ACPs share the handlers of the ACPs
+// they are made of.
+type routeBuilder struct {
+	previous   map[string]*builtPolicy
+	cfgs       map[string]*acp.Config
+	secrets    map[string]*corev1.Secret
+	secretList []*corev1.Secret
+	configMaps map[string]*corev1.ConfigMap
+
+	built map[string]*builtPolicy
+	// lockoutTrackers holds the lockout trackers of the basic auth ACPs built.
+	lockoutTrackers map[string]basicauth.FailureTracker
+	// reused holds the ACPs whose handler has been reused from the previous build.
+	reused map[string]struct{}
+	// building holds the ACPs being built, to detect composite ACPs referencing themselves.
+	building map[string]struct{}
+}
+
+func newRouteBuilder(previous map[string]*builtPolicy, cfgs map[string]*acp.Config, secrets map[string]*corev1.Secret, configMaps map[string]*corev1.ConfigMap) *routeBuilder {
+	secretList := make([]*corev1.Secret, 0, len(secrets))
+	for _, secret := range secrets {
+		secretList = append(secretList, secret)
+	}
+
+	return &routeBuilder{
+		previous:        previous,
+		cfgs:            cfgs,
+		secrets:         secrets,
+		secretList:      secretList,
+		configMaps:      configMaps,
+		built:           make(map[string]*builtPolicy),
+		lockoutTrackers: make(map[string]basicauth.FailureTracker),
+		reused:          make(map[string]struct{}),
+		building:        make(map[string]struct{}),
+	}
+}
+
+// handler returns the handler of the given ACP, building it if needed.
+func (b *routeBuilder) handler(name string) (http.Handler, error) {
+	if p, ok := b.built[name]; ok {
+		return p.handler, p.err
+	}
+
+	cfg, ok := b.cfgs[name]
+	if !ok {
+		return nil, fmt.Errorf("ACP %q not found", name)
+	}
+
+	if _, ok = b.building[name]; ok {
+		return nil, fmt.Errorf("ACP %q references itself", name)
+	}
+	b.building[name] = struct{}{}
+	defer delete(b.building, name)
+
+	inputs := b.inputs(cfg)
+
+	p := b.reuse(name, inputs)
+	if p == nil {
+		err := validateEnforcement(cfg.Enforcement)
+
+		var h http.Handler
+		if err == nil {
+			h, err = b.build(name, cfg)
+		}
+		p = &builtPolicy{inputs: inputs, handler: h, err: err, lockoutTracker: b.lockoutTrackers[name]}
+
+		result := buildSuccess
+		if err != nil {
+			result = buildFailure
+		}
+		handlerBuilds.WithLabelValues(name, result).Inc()
+	}
+
+	b.built[name] = p
+
+	return p.handler, p.err
+}
+
+// reuse returns the handler of the given ACP built previously if none of its inputs changed since then. The handler of
+// a composite ACP is reused only if the handlers of all the ACPs it is made of are reused too.
+func (b *routeBuilder) reuse(name string, inputs policyInputs) *builtPolicy {
+	prev, ok := b.previous[name]
+	if !ok || prev.err != nil || !reflect.DeepEqual(prev.inputs, inputs) {
+		return nil
+	}
+
+	if inputs.cfg.Composite != nil {
+		for _, polName := range inputs.cfg.Composite.Policies() {
+			if _, err := b.handler(polName); err != nil {
+				return nil
+			}
+			if _, ok = b.reused[polName]; !ok {
+				return nil
 			}
+		}
+	}
 
-			path := "/" + name
+	b.reused[name] = struct{}{}
 
-			log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering JWT ACP handler")
+	return prev
+}
 
-			mux.Handle(path, jwtHandler)
+// inputs returns the inputs of the handler of the given ACP configuration, that is the configuration itself and the
+// Secrets and ConfigMaps it references.
+func (b *routeBuilder) inputs(cfg *acp.Config) policyInputs {
+	inputs := policyInputs{
+		cfg:        cfg,
+		secrets:    make(map[string]*corev1.Secret),
+		configMaps: make(map[string]*corev1.ConfigMap),
+	}
 
-		case cfg.BasicAuth != nil:
-			h, err := basicauth.NewHandler(cfg.BasicAuth, name)
-			if err != nil {
-				return nil, fmt.Errorf("create %q basic auth ACP handler: %w", name, err)
+	switch {
+	case cfg.JWT != nil:
+		for _, ref := range []*jwt.SecretKeyRef{cfg.JWT.SigningSecretRef, cfg.JWT.PublicKeyRef} {
+			if ref != nil {
+				inputs.secrets[ref.Name] = b.secrets[ref.Name]
+			}
+		}
+
+		if rev := cfg.JWT.Revocation; rev != nil {
+			if rev.Secret != "" {
+				inputs.secrets[rev.Secret] = b.secrets[rev.Secret]
+			}
+			if rev.ConfigMap != "" {
+				inputs.configMaps[rev.ConfigMap] = b.configMaps[rev.ConfigMap]
+			}
+		}
+
+	case cfg.OIDC != nil:
+		for _, ref := range []*jwt.SecretKeyRef{cfg.OIDC.ClientSecretRef, cfg.OIDC.SecretRef} {
+			if ref != nil {
+				inputs.secrets[ref.Name] = b.secrets[ref.Name]
+			}
+		}
+
+	case cfg.APIKey != nil:
+		selector, err := labels.Parse(cfg.APIKey.SecretSelector)
+		if err != nil {
+			break
+		}
+
+		for name, secret := range b.secrets {
+			if selector.Matches(labels.Set(secret.Labels)) {
+				inputs.secrets[name] = secret
 			}
-			path := "/" + name
-			log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering basic auth ACP handler")
-			mux.Handle(path, h)
+		}
 
-		default:
-			return nil, errors.New("unknown ACP handler type")
+	case cfg.BasicAuth != nil:
+		if cfg.BasicAuth.UsersSecret != "" {
+			inputs.secrets[cfg.BasicAuth.UsersSecret] = b.secrets[cfg.BasicAuth.UsersSecret]
 		}
+
+	case cfg.MTLS != nil:
+		inputs.secrets[cfg.MTLS.CASecret] = b.secrets[cfg.MTLS.CASecret]
+
+	case cfg.Introspection != nil:
+		inputs.secrets[cfg.Introspection.ClientCredentialsSecret] = b.secrets[cfg.Introspection.ClientCredentialsSecret]
+
+	case cfg.IPAllowList != nil:
+		if cfg.IPAllowList.ConfigMap != "" {
+			inputs.configMaps[cfg.IPAllowList.ConfigMap] = b.configMaps[cfg.IPAllowList.ConfigMap]
+		}
+	}
+
+	return inputs
+}
+
+// lockoutTracker returns the tracker of the failed attempts of the given basic auth ACP. The tracker of its previous
+// handler is kept unless its lockout configuration changed, so that rebuilding the handler, following a Secret rotation
+// or an update of the ACP for instance, does not reset the lockouts.
+func (b *routeBuilder) lockoutTracker(name string, cfg *basicauth.LockoutConfig) basicauth.FailureTracker {
+	prev, ok := b.previous[name]
+	if ok && prev.lockoutTracker != nil && prev.inputs.cfg.BasicAuth != nil &&
+		reflect.DeepEqual(prev.inputs.cfg.BasicAuth.Lockout, cfg) {
+		return prev.lockoutTracker
 	}
 
-	return mux, nil
+	return basicauth.NewLockoutTracker(cfg)
+}
+
+func (b *routeBuilder) build(name string, cfg *acp.Config) (http.Handler, error) {
+	path := "/" + name
+
+	switch {
+	case cfg.JWT != nil:
+		jwtHandler, err := jwt.NewHandler(cfg.JWT, name, b.secrets, b.configMaps)
+		if err != nil {
+			return nil, fmt.Errorf("create %q JWT ACP handler: %w", name, err)
+		}
+
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering JWT ACP handler")
+
+		return jwtHandler, nil
+
+	case cfg.BasicAuth != nil:
+		var usersSecret *corev1.Secret
+		if cfg.BasicAuth.UsersSecret != "" {
+			usersSecret = b.secrets[cfg.BasicAuth.UsersSecret]
+		}
+
+		basicCfg := cfg.BasicAuth
+		if basicCfg.Lockout != nil && basicCfg.Lockout.Tracker == nil {
+			lockoutCfg := *basicCfg.Lockout
+			lockoutCfg.Tracker = b.lockoutTracker(name, basicCfg.Lockout)
+			b.lockoutTrackers[name] = lockoutCfg.Tracker
+
+			withTracker := *basicCfg
+			withTracker.Lockout = &lockoutCfg
+			basicCfg = &withTracker
+		}
+
+		h, err := basicauth.NewHandler(basicCfg, name, usersSecret)
+		if err != nil {
+			return nil, fmt.Errorf("create %q basic auth ACP handler: %w", name, err)
+		}
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering basic auth ACP handler")
+		return h, nil
+
+	case cfg.OIDC != nil:
+		h, err := oidc.NewHandler(cfg.OIDC, name, b.secrets)
+		if err != nil {
+			return nil, fmt.Errorf("create %q OIDC ACP handler: %w", name, err)
+		}
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering OIDC ACP handler")
+		return h, nil
+
+	case cfg.APIKey != nil:
+		h, err := apikey.NewHandler(cfg.APIKey, name, b.secretList)
+		if err != nil {
+			return nil, fmt.Errorf("create %q API key ACP handler: %w", name, err)
+		}
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering API key ACP handler")
+		return h, nil
+
+	case cfg.MTLS != nil:
+		h, err := mtls.NewHandler(cfg.MTLS, name, b.secrets[cfg.MTLS.CASecret])
+		if err != nil {
+			return nil, fmt.Errorf("create %q mTLS ACP handler: %w", name, err)
+		}
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering mTLS ACP handler")
+		return h, nil
+
+	case cfg.Introspection != nil:
+		h, err := introspection.NewHandler(cfg.Introspection, name, b.secrets[cfg.Introspection.ClientCredentialsSecret])
+		if err != nil {
+			return nil, fmt.Errorf("create %q introspection ACP handler: %w", name, err)
+		}
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering introspection ACP handler")
+		return h, nil
+
+	case cfg.IPAllowList != nil:
+		var configMap *corev1.ConfigMap
+		if cfg.IPAllowList.ConfigMap != "" {
+			configMap = b.configMaps[cfg.IPAllowList.ConfigMap]
+		}
+
+		h, err := ipallowlist.NewHandler(cfg.IPAllowList, name, configMap)
+		if err != nil {
+			return nil, fmt.Errorf("create %q IP allow list ACP handler: %w", name, err)
+		}
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering IP allow list ACP handler")
+		return h, nil
+
+	case cfg.Composite != nil:
+		var policies []composite.Policy
+		for _, polName := range cfg.Composite.Policies() {
+			h, err := b.handler(polName)
+			if err != nil {
+				return nil, fmt.Errorf("create %q composite ACP handler: %w", name, err)
+			}
+
+			policies = append(policies, composite.Policy{Name: polName, Handler: h})
+		}
+
+		h, err := composite.NewHandler(cfg.Composite, name, policies)
+		if err != nil {
+			return nil, fmt.Errorf("create %q composite ACP handler: %w", name, err)
+		}
+		log.Debug().Str("acp_name", name).Str("path", path).Msg("Registering composite ACP handler")
+		return h, nil
+
+	default:
+		return nil, errors.New("unknown ACP handler type")
+	}
 }
@@ -19,15 +19,31 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	gojwt "github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/basicauth"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/composite"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/ipallowlist"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/mtls"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/oidc"
 	hubv1alpha1 "github.com/traefik/hub-agent-kubernetes/pkg/crd/api/hub/v1alpha1"
+	hubfake "github.com/traefik/hub-agent-kubernetes/pkg/crd/generated/client/hub/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	kerror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	ktypes "k8s.io/apimachinery/pkg/types"
+	ktesting "k8s.io/client-go/testing"
 )
 
 func createPolicy(uid, name, ns string) *hubv1alpha1.AccessControlPolicy {
@@ -43,7 +59,7 @@ func createPolicy(uid, name, ns string) *hubv1alpha1.AccessControlPolicy {
 
 func TestWatcher_OnAdd(t *testing.T) {
 	switcher := NewHandlerSwitcher()
-	watcher := NewWatcher(switcher)
+	watcher := NewWatcher(switcher, hubfake.NewSimpleClientset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	t.Cleanup(cancel)
@@ -98,9 +114,24 @@ func TestWatcher_OnAdd(t *testing.T) {
 	}
 }
 
+func TestWatcher_Ready(t *testing.T) {
+	switcher := NewHandlerSwitcher()
+	watcher := NewWatcher(switcher, hubfake.NewSimpleClientset())
+
+	assert.False(t, watcher.Ready())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	t.Cleanup(cancel)
+
+	go watcher.Run(ctx)
+
+	// Handlers are built even if there is no ACP.
+	assert.Eventually(t, watcher.Ready, time.Second, 10*time.Millisecond)
+}
+
 func TestWatcher_OnUpdate(t *testing.T) {
 	switcher := NewHandlerSwitcher()
-	watcher := NewWatcher(switcher)
+	watcher := NewWatcher(switcher, hubfake.NewSimpleClientset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	t.Cleanup(cancel)
@@ -161,7 +192,7 @@ func TestWatcher_OnUpdate(t *testing.T) {
 
 func TestWatcher_OnDelete(t *testing.T) {
 	switcher := NewHandlerSwitcher()
-	watcher := NewWatcher(switcher)
+	watcher := NewWatcher(switcher, hubfake.NewSimpleClientset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	t.Cleanup(cancel)
@@ -219,3 +250,529 @@ func TestWatcher_OnDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestWatcher_OnUpdateSecret(t *testing.T) {
+	switcher := NewHandlerSwitcher()
+	watcher := NewWatcher(switcher, hubfake.NewSimpleClientset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	t.Cleanup(cancel)
+
+	go watcher.Run(ctx)
+
+	watcher.OnAdd(&hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-policy"},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			APIKey: &hubv1alpha1.AccessControlPolicyAPIKey{
+				SecretSelector: "app=my-app",
+			},
+		},
+	})
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-key", Labels: map[string]string{"app": "my-app"}},
+		Data: map[string][]byte{
+			// SHA-256 of "key".
+			"hash": []byte("2c70e12b7a0646f92279f427c7b38e7334d8e5389cff167a1dc30e73f826b683"),
+		},
+	}
+	watcher.OnAdd(secret)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serveWithKey(switcher, "key"))
+
+	updated := secret.DeepCopy()
+	// SHA-256 of "rotated".
+	updated.Data["hash"] = []byte("f4e4bfbff4df1d0bdc8d5b4b8e3d9c4f2a2d1e0d0a8a5a5c6f2c3ad6d4a2a9b1")
+	watcher.OnUpdate(secret, updated)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusUnauthorized, serveWithKey(switcher, "key"))
+
+	watcher.OnDelete(updated)
+	watcher.OnAdd(secret)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serveWithKey(switcher, "key"))
+}
+
+func TestBuildRoutes_basicAuthUsersSecret(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-policy": {BasicAuth: &basicauth.Config{UsersSecret: "my-users"}},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-users"},
+		Data: map[string][]byte{
+			// Bcrypt hash of "secret".
+			"bob": []byte("$2a$04$vLIH7aQaOFMZTCb9xfsVFODEjyaclQTI1qnYEKMla85CF9SB3Sk6W"),
+		},
+	}
+
+	routes, built := buildRoutes(nil, cfgs, nil, nil)
+	require.Error(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusForbidden, serveWithBasicAuth(routes, "bob", "secret"))
+
+	routes, built = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-users": secret}, nil)
+	require.NoError(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusOK, serveWithBasicAuth(routes, "bob", "secret"))
+
+	rotated := secret.DeepCopy()
+	// Bcrypt hash of "test".
+	rotated.Data["bob"] = []byte("$2a$04$SLfGGzCvk7t7e1.XCJfxXuI3VYqODSnhUngbYMbee83WE2bsCuzB2")
+
+	routes, _ = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-users": rotated}, nil)
+	assert.Equal(t, http.StatusUnauthorized, serveWithBasicAuth(routes, "bob", "secret"))
+	assert.Equal(t, http.StatusOK, serveWithBasicAuth(routes, "bob", "test"))
+}
+
+func TestBuildRoutes_basicAuthLockoutSurvivesRebuilds(t *testing.T) {
+	lockout := &basicauth.LockoutConfig{MaxFailures: 1, Duration: time.Minute}
+	cfgs := map[string]*acp.Config{
+		"my-policy": {BasicAuth: &basicauth.Config{UsersSecret: "my-users", Lockout: lockout}},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-users"},
+		Data: map[string][]byte{
+			// Bcrypt hash of "secret".
+			"bob": []byte("$2a$04$vLIH7aQaOFMZTCb9xfsVFODEjyaclQTI1qnYEKMla85CF9SB3Sk6W"),
+		},
+	}
+
+	routes, built := buildRoutes(nil, cfgs, map[string]*corev1.Secret{"my-users": secret}, nil)
+	require.NoError(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusUnauthorized, serveWithBasicAuth(routes, "bob", "wrong"))
+	assert.Equal(t, http.StatusTooManyRequests, serveWithBasicAuth(routes, "bob", "secret"))
+
+	// Rotating the users Secret rebuilds the handler, which keeps the lockouts.
+	rotated := secret.DeepCopy()
+	rotated.ResourceVersion = "2"
+
+	routes, built = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-users": rotated}, nil)
+	require.NoError(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusTooManyRequests, serveWithBasicAuth(routes, "bob", "secret"))
+
+	// So does updating the ACP.
+	cfgs = map[string]*acp.Config{
+		"my-policy": {BasicAuth: &basicauth.Config{UsersSecret: "my-users", Lockout: lockout, ForwardUsernameHeader: "User"}},
+	}
+
+	routes, built = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-users": rotated}, nil)
+	require.NoError(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusTooManyRequests, serveWithBasicAuth(routes, "bob", "secret"))
+
+	// Changing the lockout configuration starts over.
+	cfgs = map[string]*acp.Config{
+		"my-policy": {BasicAuth: &basicauth.Config{
+			UsersSecret:           "my-users",
+			Lockout:               &basicauth.LockoutConfig{MaxFailures: 2, Duration: time.Minute},
+			ForwardUsernameHeader: "User",
+		}},
+	}
+
+	routes, built = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-users": rotated}, nil)
+	require.NoError(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusOK, serveWithBasicAuth(routes, "bob", "secret"))
+}
+
+func TestBuildRoutes_jwtSigningSecretRef(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-policy": {JWT: &jwt.Config{SigningSecretRef: &jwt.SecretKeyRef{Name: "my-jwt", Key: "signing-secret"}}},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-jwt"},
+		Data:       map[string][]byte{"signing-secret": []byte("secret")},
+	}
+
+	routes, built := buildRoutes(nil, cfgs, nil, nil)
+	require.Error(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusForbidden, serveWithToken(t, routes, "secret"))
+
+	routes, built = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-jwt": secret}, nil)
+	require.NoError(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusOK, serveWithToken(t, routes, "secret"))
+
+	rotated := secret.DeepCopy()
+	rotated.Data["signing-secret"] = []byte("rotated")
+
+	routes, _ = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-jwt": rotated}, nil)
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(t, routes, "secret"))
+	assert.Equal(t, http.StatusOK, serveWithToken(t, routes, "rotated"))
+}
+
+func TestBuildRoutes_jwtRevocationConfigMap(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-policy": {JWT: &jwt.Config{
+			SigningSecret: "secret",
+			Revocation:    &jwt.RevocationConfig{ConfigMap: "my-revocations"},
+		}},
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-revocations"},
+		Data:       map[string]string{jwt.RevocationListKey: "jti 3f2a"},
+	}
+
+	routes, built := buildRoutes(nil, cfgs, nil, map[string]*corev1.ConfigMap{"my-revocations": configMap})
+	require.NoError(t, built["my-policy"].err)
+	assert.Equal(t, http.StatusOK, serveWithToken(t, routes, "secret"))
+
+	rotated := configMap.DeepCopy()
+	rotated.Data[jwt.RevocationListKey] = "sub bob 2030-01-01T00:00:00Z"
+
+	routes, _ = buildRoutes(built, cfgs, nil, map[string]*corev1.ConfigMap{"my-revocations": rotated})
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(t, routes, "secret"))
+}
+
+func TestBuildRoutes_oidcSecretRefs(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-policy": {OIDC: &oidc.Config{
+			Issuer:          "https://auth.example.com",
+			ClientID:        "client",
+			ClientSecretRef: &jwt.SecretKeyRef{Name: "my-oidc", Key: "client-secret"},
+			RedirectURL:     "/callback",
+			SecretRef:       &jwt.SecretKeyRef{Name: "my-oidc", Key: "secret"},
+		}},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-oidc"},
+		Data:       map[string][]byte{"client-secret": []byte("client-secret"), "secret": []byte("secret")},
+	}
+
+	_, built := buildRoutes(nil, cfgs, nil, nil)
+	require.Error(t, built["my-policy"].err)
+
+	_, built = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-oidc": secret}, nil)
+	require.NoError(t, built["my-policy"].err)
+	handler := built["my-policy"].handler
+
+	// The handler is rebuilt when a referenced Secret changes.
+	rotated := secret.DeepCopy()
+	rotated.Data["client-secret"] = []byte("rotated")
+
+	_, built = buildRoutes(built, cfgs, map[string]*corev1.Secret{"my-oidc": rotated}, nil)
+	require.NoError(t, built["my-policy"].err)
+	assert.NotSame(t, handler, built["my-policy"].handler)
+}
+
+func serveWithToken(t *testing.T, h http.Handler, signingSecret string) int {
+	t.Helper()
+
+	tok, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, gojwt.MapClaims{"sub": "bob"}).SignedString([]byte(signingSecret))
+	require.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/my-policy", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+
+	h.ServeHTTP(rw, req)
+
+	return rw.Code
+}
+
+func serveWithBasicAuth(h http.Handler, username, password string) int {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/my-policy", nil)
+	req.SetBasicAuth(username, password)
+
+	h.ServeHTTP(rw, req)
+
+	return rw.Code
+}
+
+func serveWithKey(h http.Handler, key string) int {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/my-policy", nil)
+	req.Header.Set("X-Api-Key", key)
+
+	h.ServeHTTP(rw, req)
+
+	return rw.Code
+}
+
+func TestWatcher_OnUpdateConfigMap(t *testing.T) {
+	switcher := NewHandlerSwitcher()
+	watcher := NewWatcher(switcher, hubfake.NewSimpleClientset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	t.Cleanup(cancel)
+
+	go watcher.Run(ctx)
+
+	watcher.OnAdd(&hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-policy"},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			IPAllowList: &hubv1alpha1.AccessControlPolicyIPAllowList{
+				ConfigMap: "my-ranges",
+			},
+		},
+	})
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-ranges"},
+		Data:       map[string]string{"allow": "10.0.0.0/8"},
+	}
+	watcher.OnAdd(configMap)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serveFrom(switcher, "10.1.2.3"))
+
+	updated := configMap.DeepCopy()
+	updated.Data["allow"] = "192.168.0.0/16"
+	watcher.OnUpdate(configMap, updated)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusForbidden, serveFrom(switcher, "10.1.2.3"))
+}
+
+func serveFrom(h http.Handler, ip string) int {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/my-policy", nil)
+	req.Header.Set("X-Forwarded-For", ip)
+
+	h.ServeHTTP(rw, req)
+
+	return rw.Code
+}
+
+func TestWatcher_OnUpdateCompositeChild(t *testing.T) {
+	switcher := NewHandlerSwitcher()
+	watcher := NewWatcher(switcher, hubfake.NewSimpleClientset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	t.Cleanup(cancel)
+
+	go watcher.Run(ctx)
+
+	ipPolicy := &hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-ip-policy"},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			IPAllowList: &hubv1alpha1.AccessControlPolicyIPAllowList{
+				Allow: []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	watcher.OnAdd(ipPolicy)
+	watcher.OnAdd(&hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-policy"},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			Composite: &hubv1alpha1.AccessControlPolicyComposite{
+				AllOf: []string{"my-ip-policy"},
+			},
+		},
+	})
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serveFrom(switcher, "10.1.2.3"))
+
+	updated := ipPolicy.DeepCopy()
+	updated.Spec.IPAllowList.Allow = []string{"192.168.0.0/16"}
+	watcher.OnUpdate(ipPolicy, updated)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusForbidden, serveFrom(switcher, "10.1.2.3"))
+}
+
+func TestBuildRoutes_compositeReferencingItself(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-policy":       {Composite: &composite.Config{AnyOf: []string{"my-other-policy"}}},
+		"my-other-policy": {Composite: &composite.Config{AllOf: []string{"my-policy"}}},
+	}
+
+	_, built := buildRoutes(nil, cfgs, nil, nil)
+	assert.Error(t, built["my-policy"].err)
+	assert.Error(t, built["my-other-policy"].err)
+}
+
+func TestBuildRoutes_isolatesInvalidPolicies(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-policy":         {IPAllowList: &ipallowlist.Config{Allow: []string{"10.0.0.0/8"}}},
+		"my-invalid-policy": {IPAllowList: &ipallowlist.Config{Allow: []string{"invalid"}}},
+		"my-composite":      {Composite: &composite.Config{AnyOf: []string{"my-policy", "my-invalid-policy"}}},
+		"my-missing-child":  {Composite: &composite.Config{AnyOf: []string{"my-policy", "my-unknown-policy"}}},
+	}
+
+	routes, built := buildRoutes(nil, cfgs, nil, nil)
+
+	assert.NoError(t, built["my-policy"].err)
+	assert.Error(t, built["my-invalid-policy"].err)
+	assert.Error(t, built["my-composite"].err)
+	assert.Error(t, built["my-missing-child"].err)
+
+	for name, wantStatusCode := range map[string]int{
+		"my-policy":         http.StatusOK,
+		"my-invalid-policy": http.StatusForbidden,
+		"my-composite":      http.StatusForbidden,
+		"my-missing-child":  http.StatusForbidden,
+	} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/"+name, nil)
+		req.Header.Set("X-Forwarded-For", "10.1.2.3")
+
+		routes.ServeHTTP(rw, req)
+
+		assert.Equal(t, wantStatusCode, rw.Code, name)
+	}
+}
+
+func TestBuildRoutes_reusesUnchangedHandlers(t *testing.T) {
+	cfgs := map[string]*acp.Config{
+		"my-jwt-policy":    {JWT: &jwt.Config{JWKsURL: "https://idp.example.com/jwks.json"}},
+		"my-ip-policy":     {IPAllowList: &ipallowlist.Config{Allow: []string{"10.0.0.0/8"}, ConfigMap: "my-ranges"}},
+		"my-mtls-policy":   {MTLS: &mtls.Config{CASecret: "my-ca"}},
+		"my-composite":     {Composite: &composite.Config{AllOf: []string{"my-jwt-policy", "my-ip-policy"}}},
+		"my-jwt-composite": {Composite: &composite.Config{AllOf: []string{"my-jwt-policy"}}},
+	}
+	configMaps := map[string]*corev1.ConfigMap{
+		"my-ranges": {ObjectMeta: metav1.ObjectMeta{Name: "my-ranges"}, Data: map[string]string{"allow": "192.168.0.0/16"}},
+	}
+
+	_, previous := buildRoutes(nil, cfgs, nil, configMaps)
+	assert.Error(t, previous["my-mtls-policy"].err)
+
+	// Same configuration.
+	_, built := buildRoutes(previous, cfgs, nil, configMaps)
+	for name, p := range built {
+		if name == "my-mtls-policy" {
+			continue
+		}
+		assert.Same(t, previous[name].handler, p.handler, name)
+	}
+
+	// The IP allow list ConfigMap changed.
+	previous = built
+	updatedConfigMaps := map[string]*corev1.ConfigMap{
+		"my-ranges": {ObjectMeta: metav1.ObjectMeta{Name: "my-ranges"}, Data: map[string]string{"allow": "172.16.0.0/12"}},
+	}
+
+	_, built = buildRoutes(previous, cfgs, nil, updatedConfigMaps)
+	assert.Same(t, previous["my-jwt-policy"].handler, built["my-jwt-policy"].handler)
+	assert.Same(t, previous["my-jwt-composite"].handler, built["my-jwt-composite"].handler)
+	assert.NotSame(t, previous["my-ip-policy"].handler, built["my-ip-policy"].handler)
+	assert.NotSame(t, previous["my-composite"].handler, built["my-composite"].handler)
+
+	// The JWT ACP changed.
+	previous = built
+	updatedCfgs := make(map[string]*acp.Config)
+	for name, cfg := range cfgs {
+		updatedCfgs[name] = cfg
+	}
+	updatedCfgs["my-jwt-policy"] = &acp.Config{JWT: &jwt.Config{JWKsURL: "https://idp.example.com/rotated.json"}}
+
+	_, built = buildRoutes(previous, updatedCfgs, nil, updatedConfigMaps)
+	assert.NotSame(t, previous["my-jwt-policy"].handler, built["my-jwt-policy"].handler)
+	assert.NotSame(t, previous["my-jwt-composite"].handler, built["my-jwt-composite"].handler)
+	assert.NotSame(t, previous["my-composite"].handler, built["my-composite"].handler)
+	assert.Same(t, previous["my-ip-policy"].handler, built["my-ip-policy"].handler)
+
+	// The CA Secret of the mTLS ACP has been created.
+	previous = built
+	secrets := map[string]*corev1.Secret{
+		"my-ca": {ObjectMeta: metav1.ObjectMeta{Name: "my-ca"}, Data: map[string][]byte{"ca.crt": []byte("invalid")}},
+	}
+
+	_, built = buildRoutes(previous, updatedCfgs, secrets, updatedConfigMaps)
+	assert.Error(t, built["my-mtls-policy"].err)
+	assert.NotEqual(t, previous["my-mtls-policy"].err, built["my-mtls-policy"].err)
+	assert.Same(t, previous["my-ip-policy"].handler, built["my-ip-policy"].handler)
+}
+
+func TestWatcher_Run_updatesStatus(t *testing.T) {
+	policy := &hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-policy"},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			IPAllowList: &hubv1alpha1.AccessControlPolicyIPAllowList{
+				Allow: []string{"invalid"},
+			},
+		},
+	}
+	clientSet := hubfake.NewSimpleClientset(policy)
+
+	switcher := NewHandlerSwitcher()
+	watcher := NewWatcher(switcher, clientSet)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	t.Cleanup(cancel)
+
+	go watcher.Run(ctx)
+
+	watcher.OnAdd(policy)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusForbidden, serveFrom(switcher, "10.1.2.3"))
+
+	// Conditions are only written by the replica running status updates.
+	got, err := clientSet.HubV1alpha1().AccessControlPolicies().Get(ctx, "my-policy", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, got.Status.Conditions)
+
+	go watcher.RunStatusUpdates(ctx)
+
+	time.Sleep(10 * time.Millisecond)
+
+	got, err = clientSet.HubV1alpha1().AccessControlPolicies().Get(ctx, "my-policy", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, got.Status.Conditions, 1)
+	assert.Equal(t, "Ready", got.Status.Conditions[0].Type)
+	assert.Equal(t, metav1.ConditionFalse, got.Status.Conditions[0].Status)
+	assert.Equal(t, "BuildFailed", got.Status.Conditions[0].Reason)
+	assert.Contains(t, got.Status.Conditions[0].Message, `invalid IP "invalid"`)
+
+	updated := got.DeepCopy()
+	updated.Spec.IPAllowList.Allow = []string{"10.0.0.0/8"}
+	_, err = clientSet.HubV1alpha1().AccessControlPolicies().Update(ctx, updated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	watcher.OnUpdate(got, updated)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serveFrom(switcher, "10.1.2.3"))
+
+	got, err = clientSet.HubV1alpha1().AccessControlPolicies().Get(ctx, "my-policy", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, got.Status.Conditions, 1)
+	assert.Equal(t, metav1.ConditionTrue, got.Status.Conditions[0].Status)
+	assert.Equal(t, "HandlerBuilt", got.Status.Conditions[0].Reason)
+}
+
+func TestWatcher_RunStatusUpdates_retriesOnConflict(t *testing.T) {
+	policy := &hubv1alpha1.AccessControlPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-policy"},
+		Spec: hubv1alpha1.AccessControlPolicySpec{
+			IPAllowList: &hubv1alpha1.AccessControlPolicyIPAllowList{
+				Allow: []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	clientSet := hubfake.NewSimpleClientset(policy)
+
+	var conflicts int32
+	clientSet.PrependReactor("update", "accesscontrolpolicies", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if !atomic.CompareAndSwapInt32(&conflicts, 0, 1) {
+			return false, nil, nil
+		}
+
+		return true, nil, kerror.NewConflict(hubv1alpha1.Resource("accesscontrolpolicies"), "my-policy", errors.New("modified"))
+	})
+
+	switcher := NewHandlerSwitcher()
+	watcher := NewWatcher(switcher, clientSet)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	t.Cleanup(cancel)
+
+	go watcher.Run(ctx)
+	go watcher.RunStatusUpdates(ctx)
+
+	watcher.OnAdd(policy)
+
+	time.Sleep(50 * time.Millisecond)
+
+	got, err := clientSet.HubV1alpha1().AccessControlPolicies().Get(ctx, "my-policy", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, got.Status.Conditions, 1)
+	assert.Equal(t, metav1.ConditionTrue, got.Status.Conditions[0].Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conflicts))
+}
@@ -1,25 +1,45 @@
 package basicauth
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	goauth "github.com/abbot/go-http-auth"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/audit"
+	corev1 "k8s.io/api/core/v1"
 )
 
 const defaultRealm = "hub"
 
+// SecretHtpasswdKey is the key of the users Secret data entry holding users in the htpasswd format. Every other entry
+// holds the hash of the password of the user it is named after.
+const SecretHtpasswdKey = "htpasswd"
+
+// strongHashPrefixes are the prefixes of the password hashes accepted in users Secrets: only bcrypt hashes are, as
+// MD5 and SHA1 hashes can be brute-forced.
+var strongHashPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
 // Users holds a list of users.
 type Users []string
 
 // Config configures a basic auth ACP handler.
 type Config struct {
-	Users                    Users
+	Users Users
+	// UsersSecret is the name of the Secret holding users, either in the htpasswd format under the "htpasswd" key, or
+	// one per key, each holding the password hash of the user it is named after. Password hashes must be bcrypt hashes.
+	UsersSecret              string
 	Realm                    string
 	StripAuthorizationHeader bool
 	ForwardUsernameHeader    string
+	// Lockout, if set, locks out the usernames and client IPs failing to authenticate too many times in a row.
+	Lockout *LockoutConfig
 }
 
 // Handler is a basic auth ACP Handler.
@@ -28,16 +48,28 @@ type Handler struct {
 	users              map[string]string
 	forwardUsername    string
 	stripAuthorization bool
+	lockout            *lockout
 	name               string
 }
 
-// NewHandler creates a new basic auth ACP Handler.
-func NewHandler(cfg *Config, name string) (*Handler, error) {
+// NewHandler creates a new basic auth ACP Handler. Users are read from the configuration and from the given users
+// Secret, if any.
+func NewHandler(cfg *Config, name string, usersSecret *corev1.Secret) (*Handler, error) {
 	users, err := getUsers(cfg.Users, basicUserParser)
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.UsersSecret != "" {
+		if usersSecret == nil {
+			return nil, fmt.Errorf("users secret %q not found", cfg.UsersSecret)
+		}
+
+		if err = addSecretUsers(users, usersSecret); err != nil {
+			return nil, fmt.Errorf("users secret %q: %w", cfg.UsersSecret, err)
+		}
+	}
+
 	h := &Handler{
 		users:              users,
 		forwardUsername:    cfg.ForwardUsernameHeader,
@@ -45,6 +77,13 @@ func NewHandler(cfg *Config, name string) (*Handler, error) {
 		name:               name,
 	}
 
+	if cfg.Lockout != nil {
+		h.lockout, err = newLockout(cfg.Lockout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	realm := defaultRealm
 	if len(cfg.Realm) > 0 {
 		realm = cfg.Realm
@@ -59,10 +98,34 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	l := log.With().Str("handler_type", "BasicAuth").Str("handler_name", h.name).Logger()
 
 	username, password, ok := req.BasicAuth()
+	if ok {
+		audit.SetSubject(req.Context(), username)
+	}
+
+	// Only the requests holding credentials are tracked, as browsers first send requests without any to be
+	// challenged.
+	var lockoutKeys []string
+	if ok && h.lockout != nil {
+		lockoutKeys = h.lockout.keys(req, username)
+
+		if retryAfter := h.lockout.retryAfter(lockoutKeys); retryAfter > 0 {
+			l.Debug().Str("username", username).Msg("Authentication attempt while locked out")
+			audit.SetReason(req.Context(), "locked out after too many failed attempts")
+
+			rw.Header().Set("Retry-After", formatRetryAfter(retryAfter))
+			rw.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}
+
 	if ok {
 		secret := h.auth.Secrets(username, h.auth.Realm)
 		if secret == "" || !goauth.CheckSecret(password, secret) {
 			ok = false
+
+			if lockoutKeys != nil {
+				h.fail(l, rw, req, username, lockoutKeys)
+			}
 		}
 	}
 
@@ -73,6 +136,11 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if lockoutKeys != nil {
+		// The username succeeded, but not necessarily the client IP which may have tried many of them.
+		h.lockout.reset(lockoutKeys[0])
+	}
+
 	if h.forwardUsername != "" {
 		rw.Header().Set(h.forwardUsername, username)
 	}
@@ -84,6 +152,24 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	rw.WriteHeader(http.StatusOK)
 }
 
+// fail records a failed attempt for the given keys, reporting the lockouts it leads to.
+func (h *Handler) fail(l zerolog.Logger, rw http.ResponseWriter, req *http.Request, username string, keys []string) {
+	lockedFor := h.lockout.fail(keys)
+	if lockedFor == 0 {
+		audit.SetReason(req.Context(), "invalid credentials")
+		return
+	}
+
+	l.Info().
+		Str("username", username).
+		Strs("keys", keys).
+		Dur("duration", lockedFor).
+		Msg("Locking out after too many failed authentication attempts")
+	audit.SetReason(req.Context(), "invalid credentials, locked out for "+lockedFor.String())
+
+	rw.Header().Set("Retry-After", formatRetryAfter(lockedFor))
+}
+
 func (h *Handler) secretBasic(user, _ string) string {
 	if secret, ok := h.users[user]; ok {
 		return secret
@@ -100,6 +186,78 @@ func basicUserParser(user string) (username, password string, err error) {
 	return split[0], split[1], nil
 }
 
+// addSecretUsers adds the users of the given Secret to the given users.
+func addSecretUsers(users map[string]string, secret *corev1.Secret) error {
+	secretUsers := make(map[string]string)
+
+	if htpasswd, ok := secret.Data[SecretHtpasswdKey]; ok {
+		scanner := bufio.NewScanner(bytes.NewReader(htpasswd))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			userName, userHash, err := basicUserParser(line)
+			if err != nil {
+				return err
+			}
+			if _, ok = secretUsers[userName]; ok {
+				return fmt.Errorf("user %q defined more than once", userName)
+			}
+			secretUsers[userName] = userHash
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("read %q: %w", SecretHtpasswdKey, err)
+		}
+	}
+
+	for key, value := range secret.Data {
+		if key == SecretHtpasswdKey {
+			continue
+		}
+
+		if _, ok := secretUsers[key]; ok {
+			return fmt.Errorf("user %q defined more than once", key)
+		}
+		secretUsers[key] = strings.TrimSpace(string(value))
+	}
+
+	if len(secretUsers) == 0 {
+		return errors.New("no user found")
+	}
+
+	// Sort users so errors are reported consistently.
+	userNames := make([]string, 0, len(secretUsers))
+	for userName := range secretUsers {
+		userNames = append(userNames, userName)
+	}
+	sort.Strings(userNames)
+
+	for _, userName := range userNames {
+		userHash := secretUsers[userName]
+		if !isStrongHash(userHash) {
+			return fmt.Errorf("password of user %q must be hashed with bcrypt", userName)
+		}
+		if _, ok := users[userName]; ok {
+			return fmt.Errorf("user %q defined more than once", userName)
+		}
+		users[userName] = userHash
+	}
+
+	return nil
+}
+
+func isStrongHash(hash string) bool {
+	for _, prefix := range strongHashPrefixes {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // userParser Parses a string and return a userName/userHash. An error if the format of the string is incorrect.
 type userParser func(user string) (username, password string, err error)
 
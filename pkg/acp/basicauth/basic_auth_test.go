@@ -7,19 +7,21 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestBasicAuthFail(t *testing.T) {
 	cfg := &Config{
 		Users: []string{"test"},
 	}
-	_, err := NewHandler(cfg, "authName")
+	_, err := NewHandler(cfg, "authName", nil)
 	require.Error(t, err)
 
 	auth2 := Config{
 		Users: []string{"test:test"},
 	}
-	handler, err := NewHandler(&auth2, "acp@my-ns")
+	handler, err := NewHandler(&auth2, "acp@my-ns", nil)
 	require.NoError(t, err)
 
 	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
@@ -36,7 +38,7 @@ func TestBasicAuthUserHeader(t *testing.T) {
 		Users:                 []string{"test:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"},
 		ForwardUsernameHeader: "User",
 	}
-	handler, err := NewHandler(cfg, "acp@my-ns")
+	handler, err := NewHandler(cfg, "acp@my-ns", nil)
 	require.NoError(t, err)
 
 	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
@@ -48,3 +50,129 @@ func TestBasicAuthUserHeader(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.Equal(t, "test", rec.Header().Get("User"))
 }
+
+func TestNewHandler_usersSecret(t *testing.T) {
+	const (
+		testHash   = "$2a$04$SLfGGzCvk7t7e1.XCJfxXuI3VYqODSnhUngbYMbee83WE2bsCuzB2"
+		secretHash = "$2a$04$vLIH7aQaOFMZTCb9xfsVFODEjyaclQTI1qnYEKMla85CF9SB3Sk6W"
+	)
+
+	tests := []struct {
+		desc      string
+		users     []string
+		data      map[string][]byte
+		noSecret  bool
+		wantUsers map[string]string
+		wantErr   string
+	}{
+		{
+			desc: "htpasswd",
+			data: map[string][]byte{
+				SecretHtpasswdKey: []byte("# Users\ntest:" + testHash + "\n\nbob:" + secretHash + "\n"),
+			},
+			wantUsers: map[string]string{"test": "test", "bob": "secret"},
+		},
+		{
+			desc: "one user per key",
+			data: map[string][]byte{
+				"test": []byte(testHash + "\n"),
+				"bob":  []byte(secretHash),
+			},
+			wantUsers: map[string]string{"test": "test", "bob": "secret"},
+		},
+		{
+			desc:  "users from the configuration and the secret",
+			users: []string{"test:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"},
+			data: map[string][]byte{
+				"bob": []byte(secretHash),
+			},
+			wantUsers: map[string]string{"test": "test", "bob": "secret"},
+		},
+		{
+			desc:     "secret not found",
+			noSecret: true,
+			wantErr:  `users secret "my-users" not found`,
+		},
+		{
+			desc:    "empty secret",
+			data:    map[string][]byte{},
+			wantErr: `users secret "my-users": no user found`,
+		},
+		{
+			desc: "MD5 hash",
+			data: map[string][]byte{
+				SecretHtpasswdKey: []byte("test:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"),
+			},
+			wantErr: `users secret "my-users": password of user "test" must be hashed with bcrypt`,
+		},
+		{
+			desc: "SHA1 hash",
+			data: map[string][]byte{
+				"test": []byte("{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M="),
+			},
+			wantErr: `users secret "my-users": password of user "test" must be hashed with bcrypt`,
+		},
+		{
+			desc: "plain text password",
+			data: map[string][]byte{
+				"test": []byte("test"),
+			},
+			wantErr: `users secret "my-users": password of user "test" must be hashed with bcrypt`,
+		},
+		{
+			desc: "invalid htpasswd",
+			data: map[string][]byte{
+				SecretHtpasswdKey: []byte("test"),
+			},
+			wantErr: `users secret "my-users": parse BasicUser: test`,
+		},
+		{
+			desc: "user defined more than once",
+			data: map[string][]byte{
+				SecretHtpasswdKey: []byte("test:" + testHash),
+				"test":            []byte(secretHash),
+			},
+			wantErr: `users secret "my-users": user "test" defined more than once`,
+		},
+		{
+			desc:  "user defined in the configuration and the secret",
+			users: []string{"test:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"},
+			data: map[string][]byte{
+				"test": []byte(testHash),
+			},
+			wantErr: `users secret "my-users": user "test" defined more than once`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var secret *corev1.Secret
+			if !test.noSecret {
+				secret = &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "my-users"},
+					Data:       test.data,
+				}
+			}
+
+			handler, err := NewHandler(&Config{Users: test.users, UsersSecret: "my-users"}, "acp@my-ns", secret)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			for user, password := range test.wantUsers {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+				req.SetBasicAuth(user, password)
+				rec := httptest.NewRecorder()
+
+				handler.ServeHTTP(rec, req)
+
+				assert.Equal(t, http.StatusOK, rec.Code, user)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package basicauth
+
+import (
+	"container/list"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/forwarded"
+)
+
+// maxTrackedKeys is the number of usernames and client IPs above which the least recently failing ones are forgotten.
+const maxTrackedKeys = 10000
+
+// LockoutConfig configures the lockout of the usernames and client IPs failing to authenticate too many times in a row.
+type LockoutConfig struct {
+	// MaxFailures is the number of consecutive failed attempts after which a username or client IP is locked out.
+	MaxFailures int
+	// Duration is how long the first lockout lasts. It doubles on each further failed attempt, up to MaxDuration.
+	// Failed attempts are forgotten MaxDuration after the last one.
+	Duration    time.Duration
+	MaxDuration time.Duration
+	// TrustedProxyDepth is the number of trusted proxies in front of Traefik. The client IP is the one found at this
+	// depth in the X-Forwarded-For header, starting from the right.
+	TrustedProxyDepth int
+	// Tracker records failed attempts, in memory if nil. It can be set to share them between auth server replicas.
+	Tracker FailureTracker
+}
+
+// FailureTracker records failed authentication attempts by key. It must be safe for concurrent use.
+type FailureTracker interface {
+	// Fail records a failed attempt for the given key and returns the number of consecutive failed attempts recorded
+	// for it.
+	Fail(key string) int
+	// Lock locks the given key out until the given time.
+	Lock(key string, until time.Time)
+	// LockedUntil returns the time until which the given key is locked out, the zero time if it is not.
+	LockedUntil(key string) time.Time
+	// Reset forgets the failed attempts of the given key.
+	Reset(key string)
+}
+
+// lockout locks out the usernames and client IPs failing to authenticate too many times in a row.
+type lockout struct {
+	maxFailures int
+	duration    time.Duration
+	maxDuration time.Duration
+	depth       int
+	tracker     FailureTracker
+
+	now func() time.Time
+}
+
+func newLockout(cfg *LockoutConfig) (*lockout, error) {
+	if cfg.MaxFailures <= 0 {
+		return nil, errors.New("lockout max failures must be positive")
+	}
+	if cfg.Duration <= 0 {
+		return nil, errors.New("lockout duration must be positive")
+	}
+	if cfg.TrustedProxyDepth < 0 {
+		return nil, errors.New("lockout trusted proxy depth must not be negative")
+	}
+
+	maxDuration := cfg.maxDuration()
+	if maxDuration < cfg.Duration {
+		return nil, errors.New("lockout max duration must be greater than its duration")
+	}
+
+	tracker := cfg.Tracker
+	if tracker == nil {
+		tracker = NewLockoutTracker(cfg)
+	}
+
+	return &lockout{
+		maxFailures: cfg.MaxFailures,
+		duration:    cfg.Duration,
+		maxDuration: maxDuration,
+		depth:       cfg.TrustedProxyDepth,
+		tracker:     tracker,
+		now:         time.Now,
+	}, nil
+}
+
+// NewLockoutTracker returns the in-memory tracker used by default for the given lockout configuration. It can be set
+// as the tracker of the handlers built for the same ACP, so that lockouts survive the rebuilds of its handler.
+func NewLockoutTracker(cfg *LockoutConfig) *MemoryTracker {
+	return NewMemoryTracker(maxTrackedKeys, cfg.maxDuration())
+}
+
+// maxDuration returns how long a lockout lasts at most.
+func (c *LockoutConfig) maxDuration() time.Duration {
+	if c.MaxDuration == 0 {
+		return c.Duration
+	}
+
+	return c.MaxDuration
+}
+
+// keys returns the keys failures of the given request are tracked under: its username and its client IP, if found.
+func (l *lockout) keys(req *http.Request, username string) []string {
+	keys := []string{"user:" + username}
+	if ip := forwarded.ClientIP(req, l.depth); ip != nil {
+		keys = append(keys, "ip:"+ip.String())
+	}
+
+	return keys
+}
+
+// retryAfter returns how long the given keys are locked out for, or zero if none of them is.
+func (l *lockout) retryAfter(keys []string) time.Duration {
+	now := l.now()
+
+	var retryAfter time.Duration
+	for _, key := range keys {
+		if d := l.tracker.LockedUntil(key).Sub(now); d > retryAfter {
+			retryAfter = d
+		}
+	}
+
+	return retryAfter
+}
+
+// fail records a failed attempt for the given keys, and locks them out if they failed too many times in a row. It
+// returns how long the keys are locked out for, zero if none of them is.
+func (l *lockout) fail(keys []string) time.Duration {
+	now := l.now()
+
+	var lockedFor time.Duration
+	for _, key := range keys {
+		failures := l.tracker.Fail(key)
+		if failures < l.maxFailures {
+			continue
+		}
+
+		d := l.lockoutDuration(failures)
+		l.tracker.Lock(key, now.Add(d))
+
+		if d > lockedFor {
+			lockedFor = d
+		}
+	}
+
+	return lockedFor
+}
+
+// lockoutDuration returns how long a key failing the given number of times in a row is locked out for.
+func (l *lockout) lockoutDuration(failures int) time.Duration {
+	d := l.duration
+	for i := l.maxFailures; i < failures && d < l.maxDuration; i++ {
+		d *= 2
+	}
+
+	if d > l.maxDuration {
+		return l.maxDuration
+	}
+
+	return d
+}
+
+// reset forgets the failed attempts of the given key.
+func (l *lockout) reset(key string) {
+	l.tracker.Reset(key)
+}
+
+// formatRetryAfter formats the given duration as the value of a Retry-After header, in seconds rounded up.
+func formatRetryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+type trackerEntry struct {
+	key         string
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// MemoryTracker is a FailureTracker keeping failed attempts in memory. The least recently failing keys are forgotten
+// when it tracks too many of them.
+type MemoryTracker struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	maxKeys int
+	ttl     time.Duration
+
+	now func() time.Time
+}
+
+// NewMemoryTracker returns a MemoryTracker tracking at most the given number of keys. Failed attempts are forgotten
+// after the given TTL, unless the key is locked out for longer.
+func NewMemoryTracker(maxKeys int, ttl time.Duration) *MemoryTracker {
+	return &MemoryTracker{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		maxKeys: maxKeys,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Fail records a failed attempt for the given key.
+func (t *MemoryTracker) Fail(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+
+	entry := t.get(key, now)
+	if entry == nil {
+		entry = &trackerEntry{key: key}
+		t.entries[key] = t.lru.PushFront(entry)
+
+		if t.lru.Len() > t.maxKeys {
+			oldest := t.lru.Back()
+			t.lru.Remove(oldest)
+			delete(t.entries, oldest.Value.(*trackerEntry).key)
+		}
+	} else {
+		t.lru.MoveToFront(t.entries[key])
+	}
+
+	entry.failures++
+	entry.lastFailure = now
+
+	return entry.failures
+}
+
+// Lock locks the given key out until the given time.
+func (t *MemoryTracker) Lock(key string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entry := t.get(key, t.now()); entry != nil {
+		entry.lockedUntil = until
+	}
+}
+
+// LockedUntil returns the time until which the given key is locked out.
+func (t *MemoryTracker) LockedUntil(key string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.get(key, t.now())
+	if entry == nil {
+		return time.Time{}
+	}
+
+	return entry.lockedUntil
+}
+
+// Reset forgets the failed attempts of the given key.
+func (t *MemoryTracker) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elem, ok := t.entries[key]; ok {
+		t.lru.Remove(elem)
+		delete(t.entries, key)
+	}
+}
+
+// get returns the entry of the given key, forgetting it if it expired. It must be called with the lock held.
+func (t *MemoryTracker) get(key string, now time.Time) *trackerEntry {
+	elem, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*trackerEntry)
+	if now.After(entry.lastFailure.Add(t.ttl)) && now.After(entry.lockedUntil) {
+		t.lru.Remove(elem)
+		delete(t.entries, key)
+		return nil
+	}
+
+	return entry
+}
@@ -0,0 +1,212 @@
+package basicauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_ServeHTTP_lockout(t *testing.T) {
+	cfg := &Config{
+		Users: []string{
+			"test:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/",
+			"bob:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/",
+		},
+		Lockout: &LockoutConfig{
+			MaxFailures: 2,
+			Duration:    time.Minute,
+			MaxDuration: 4 * time.Minute,
+		},
+	}
+	h, err := NewHandler(cfg, "acp@my-ns", nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+	h.lockout.now = clock
+	h.lockout.tracker.(*MemoryTracker).now = clock
+
+	steps := []struct {
+		desc           string
+		elapsed        time.Duration
+		username       string
+		password       string
+		clientIP       string
+		wantStatusCode int
+		wantRetryAfter string
+	}{
+		{
+			desc:           "first failure",
+			username:       "test",
+			password:       "invalid",
+			clientIP:       "10.0.0.1",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "second failure locks out",
+			username:       "test",
+			password:       "invalid",
+			clientIP:       "10.0.0.1",
+			wantStatusCode: http.StatusUnauthorized,
+			wantRetryAfter: "60",
+		},
+		{
+			desc:           "valid credentials while locked out",
+			elapsed:        10 * time.Second,
+			username:       "test",
+			password:       "test",
+			clientIP:       "10.0.0.2",
+			wantStatusCode: http.StatusTooManyRequests,
+			wantRetryAfter: "50",
+		},
+		{
+			desc:           "other user from the locked out IP",
+			username:       "bob",
+			password:       "test",
+			clientIP:       "10.0.0.1",
+			wantStatusCode: http.StatusTooManyRequests,
+			wantRetryAfter: "50",
+		},
+		{
+			desc:           "other user from another IP",
+			username:       "bob",
+			password:       "test",
+			clientIP:       "10.0.0.2",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "failure after the lockout doubles it",
+			elapsed:        time.Minute,
+			username:       "test",
+			password:       "invalid",
+			clientIP:       "10.0.0.3",
+			wantStatusCode: http.StatusUnauthorized,
+			wantRetryAfter: "120",
+		},
+		{
+			desc:           "success after the lockout",
+			elapsed:        2 * time.Minute,
+			username:       "test",
+			password:       "test",
+			clientIP:       "10.0.0.3",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "failure after a success",
+			username:       "test",
+			password:       "invalid",
+			clientIP:       "10.0.0.4",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		req.SetBasicAuth(step.username, step.password)
+		req.Header.Set("X-Forwarded-For", step.clientIP)
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, step.wantStatusCode, rec.Code, step.desc)
+		assert.Equal(t, step.wantRetryAfter, rec.Header().Get("Retry-After"), step.desc)
+	}
+}
+
+func TestHandler_ServeHTTP_lockoutIgnoresMissingCredentials(t *testing.T) {
+	cfg := &Config{
+		Users:   []string{"test:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"},
+		Lockout: &LockoutConfig{MaxFailures: 1, Duration: time.Minute},
+	}
+	h, err := NewHandler(cfg, "acp@my-ns", nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	req.SetBasicAuth("test", "test")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestNewHandler_invalidLockout(t *testing.T) {
+	tests := []struct {
+		desc    string
+		lockout LockoutConfig
+	}{
+		{
+			desc:    "no max failures",
+			lockout: LockoutConfig{Duration: time.Minute},
+		},
+		{
+			desc:    "no duration",
+			lockout: LockoutConfig{MaxFailures: 3},
+		},
+		{
+			desc:    "max duration lower than duration",
+			lockout: LockoutConfig{MaxFailures: 3, Duration: time.Minute, MaxDuration: time.Second},
+		},
+		{
+			desc:    "negative trusted proxy depth",
+			lockout: LockoutConfig{MaxFailures: 3, Duration: time.Minute, TrustedProxyDepth: -1},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&Config{Lockout: &test.lockout}, "acp@my-ns", nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMemoryTracker(t *testing.T) {
+	tracker := NewMemoryTracker(2, time.Minute)
+
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	assert.Equal(t, 1, tracker.Fail("user:test"))
+	assert.Equal(t, 2, tracker.Fail("user:test"))
+
+	tracker.Lock("user:test", now.Add(5*time.Minute))
+	assert.Equal(t, now.Add(5*time.Minute), tracker.LockedUntil("user:test"))
+
+	// Locked out keys are kept beyond the TTL.
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 3, tracker.Fail("user:test"))
+
+	// The least recently failing key is forgotten.
+	tracker.Fail("user:bob")
+	tracker.Fail("user:alice")
+	assert.True(t, tracker.LockedUntil("user:test").IsZero())
+	assert.Equal(t, 2, tracker.Fail("user:bob"))
+
+	// Failures are forgotten after the TTL.
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 1, tracker.Fail("user:bob"))
+
+	tracker.Reset("user:bob")
+	assert.Equal(t, 1, tracker.Fail("user:bob"))
+}
@@ -0,0 +1,143 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/response"
+)
+
+// Config configures a composite ACP handler. Exactly one of AllOf and AnyOf must be set.
+type Config struct {
+	// AllOf is a list of ACP names. A request is authorized if all of them authorize it.
+	AllOf []string
+	// AnyOf is a list of ACP names. A request is authorized if at least one of them authorizes it.
+	AnyOf []string
+}
+
+// Policies returns the names of the ACPs the composite ACP is made of.
+func (c *Config) Policies() []string {
+	if len(c.AllOf) > 0 {
+		return c.AllOf
+	}
+
+	return c.AnyOf
+}
+
+// Validate validates the configuration.
+func (c *Config) Validate() error {
+	if len(c.AllOf) > 0 && len(c.AnyOf) > 0 {
+		return errors.New("allOf and anyOf are mutually exclusive")
+	}
+	if len(c.AllOf) == 0 && len(c.AnyOf) == 0 {
+		return errors.New("either allOf or anyOf is required")
+	}
+
+	return nil
+}
+
+// Policy is an ACP handler a composite ACP is made of.
+type Policy struct {
+	Name    string
+	Handler http.Handler
+}
+
+// Handler is a composite ACP Handler.
+type Handler struct {
+	name string
+
+	allOf    bool
+	policies []Policy
+}
+
+// NewHandler returns a new composite ACP Handler. The given policies must be the handlers of the ACPs referenced by
+// the configuration, in the same order.
+func NewHandler(cfg *Config, polName string, policies []Policy) (*Handler, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(policies) != len(cfg.Policies()) {
+		return nil, fmt.Errorf("expected %d policies, got %d", len(cfg.Policies()), len(policies))
+	}
+
+	return &Handler{
+		name:     polName,
+		allOf:    len(cfg.AllOf) > 0,
+		policies: policies,
+	}, nil
+}
+
+// ServeHTTP evaluates the request against the policies, in order. With allOf, the response of the first policy
+// denying the request is returned, and the headers set by all policies are merged otherwise. With anyOf, the first
+// policy authorizing the request decides, and the response of the first policy is returned if none of them
+// authorizes it.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	l := log.With().Str("handler_type", "Composite").Str("handler_name", h.name).Logger()
+
+	var (
+		authorized  bool
+		firstDenial *response.Recorder
+	)
+	fwdHeaders := make(http.Header)
+
+	for _, pol := range h.policies {
+		rec := response.NewRecorder()
+		pol.Handler.ServeHTTP(rec, req)
+
+		if !rec.Authorized() {
+			l.Debug().Str("acp_name", pol.Name).Int("status_code", rec.Code()).Msg("Request denied by policy")
+
+			if h.allOf {
+				rec.Replay(rw)
+				return
+			}
+
+			if firstDenial == nil {
+				firstDenial = rec
+			}
+			continue
+		}
+
+		authorized = true
+		for name, values := range rec.Header() {
+			fwdHeaders[name] = values
+		}
+
+		// With anyOf, the remaining policies are not evaluated, so they neither log errors nor run side effects,
+		// such as counting failures or starting redirections, for requests that are already authorized.
+		if !h.allOf {
+			break
+		}
+	}
+
+	if !authorized {
+		firstDenial.Replay(rw)
+		return
+	}
+
+	for name, values := range fwdHeaders {
+		rw.Header()[name] = values
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package composite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHandler(t *testing.T) {
+	allow := Policy{Name: "allow", Handler: respond(http.StatusOK, nil)}
+
+	tests := []struct {
+		desc     string
+		cfg      Config
+		policies []Policy
+		wantErr  assert.ErrorAssertionFunc
+	}{
+		{
+			desc:    "no policy",
+			cfg:     Config{},
+			wantErr: assert.Error,
+		},
+		{
+			desc:     "both allOf and anyOf",
+			cfg:      Config{AllOf: []string{"allow"}, AnyOf: []string{"allow"}},
+			policies: []Policy{allow},
+			wantErr:  assert.Error,
+		},
+		{
+			desc:    "missing policy handlers",
+			cfg:     Config{AllOf: []string{"allow"}},
+			wantErr: assert.Error,
+		},
+		{
+			desc:     "allOf",
+			cfg:      Config{AllOf: []string{"allow"}},
+			policies: []Policy{allow},
+			wantErr:  assert.NoError,
+		},
+		{
+			desc:     "anyOf",
+			cfg:      Config{AnyOf: []string{"allow"}},
+			policies: []Policy{allow},
+			wantErr:  assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&test.cfg, "my-policy", test.policies)
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	user := Policy{Name: "user", Handler: respond(http.StatusOK, http.Header{"X-User": []string{"john"}})}
+	group := Policy{Name: "group", Handler: respond(http.StatusOK, http.Header{"X-Group": []string{"dev"}})}
+	unauthorized := Policy{Name: "unauthorized", Handler: respond(http.StatusUnauthorized, http.Header{"Www-Authenticate": []string{`Basic realm="hub"`}})}
+	forbidden := Policy{Name: "forbidden", Handler: respond(http.StatusForbidden, nil)}
+
+	tests := []struct {
+		desc           string
+		allOf          bool
+		policies       []Policy
+		wantStatusCode int
+		wantHeader     http.Header
+	}{
+		{
+			desc:           "allOf authorized by all policies",
+			allOf:          true,
+			policies:       []Policy{user, group},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{"X-User": []string{"john"}, "X-Group": []string{"dev"}},
+		},
+		{
+			desc:           "allOf denied by a policy",
+			allOf:          true,
+			policies:       []Policy{user, forbidden, unauthorized},
+			wantStatusCode: http.StatusForbidden,
+			wantHeader:     http.Header{},
+		},
+		{
+			desc:           "anyOf authorized by a policy",
+			policies:       []Policy{unauthorized, user},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{"X-User": []string{"john"}},
+		},
+		{
+			desc:           "anyOf stops at the first authorizing policy",
+			policies:       []Policy{forbidden, user, group},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{"X-User": []string{"john"}},
+		},
+		{
+			desc:           "anyOf denied by all policies",
+			policies:       []Policy{unauthorized, forbidden},
+			wantStatusCode: http.StatusUnauthorized,
+			wantHeader:     http.Header{"Www-Authenticate": []string{`Basic realm="hub"`}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var names []string
+			for _, pol := range test.policies {
+				names = append(names, pol.Name)
+			}
+
+			cfg := Config{AnyOf: names}
+			if test.allOf {
+				cfg = Config{AllOf: names}
+			}
+
+			h, err := NewHandler(&cfg, "my-policy", test.policies)
+			require.NoError(t, err)
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil))
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+			assert.Equal(t, test.wantHeader, rw.Header())
+		})
+	}
+}
+
+func respond(code int, header http.Header) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		for name, values := range header {
+			rw.Header()[name] = values
+		}
+
+		rw.WriteHeader(code)
+	})
+}
@@ -18,46 +18,257 @@ along with this program. If not, see <https://www.gnu.org/licenses/>.
 package acp
 
 import (
+	"time"
+
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/apikey"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/basicauth"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/composite"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/introspection"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/ipallowlist"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/mtls"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/oidc"
 	hubv1alpha1 "github.com/traefik/hub-agent-kubernetes/pkg/crd/api/hub/v1alpha1"
 )
 
+// Enforcement modes of an ACP.
+const (
+	// EnforcementEnforce denies the requests the ACP does not authorize. It is the default mode.
+	EnforcementEnforce = "enforce"
+	// EnforcementReportOnly authorizes all requests, and reports the ones the ACP would have denied. It only applies
+	// to the route of the ACP: composite ACPs referencing it still enforce it.
+	EnforcementReportOnly = "report-only"
+)
+
 // Config is the configuration of an Access Control Policy. It is used to setup ACP handlers.
 type Config struct {
-	JWT       *jwt.Config
-	BasicAuth *basicauth.Config
+	JWT           *jwt.Config
+	BasicAuth     *basicauth.Config
+	OIDC          *oidc.Config
+	APIKey        *apikey.Config
+	MTLS          *mtls.Config
+	Introspection *introspection.Config
+	IPAllowList   *ipallowlist.Config
+	Composite     *composite.Config
+
+	// Enforcement is the enforcement mode of the ACP, EnforcementEnforce if empty.
+	Enforcement string
 }
 
 // ConfigFromPolicy returns an ACP configuration for the given policy.
 func ConfigFromPolicy(policy *hubv1alpha1.AccessControlPolicy) *Config {
+	cfg := handlerConfigFromPolicy(policy)
+	cfg.Enforcement = policy.Spec.Enforcement
+
+	return cfg
+}
+
+func handlerConfigFromPolicy(policy *hubv1alpha1.AccessControlPolicy) *Config {
 	switch {
 	case policy.Spec.JWT != nil:
 		jwtCfg := policy.Spec.JWT
 
+		var leeway time.Duration
+		if jwtCfg.Leeway != nil {
+			leeway = jwtCfg.Leeway.Duration
+		}
+
+		var cacheTTL time.Duration
+		if jwtCfg.CacheTTL != nil {
+			cacheTTL = jwtCfg.CacheTTL.Duration
+		}
+
+		var tokenSources []jwt.TokenSource
+		for _, src := range jwtCfg.TokenSources {
+			tokenSources = append(tokenSources, jwt.TokenSource{Type: src.Type, Name: src.Name, Prefix: src.Prefix})
+		}
+
+		var rules []jwt.Rule
+		for _, r := range jwtCfg.Rules {
+			rules = append(rules, jwt.Rule{Match: r.Match, Claims: r.Claims})
+		}
+
+		var signingSecretRef, publicKeyRef *jwt.SecretKeyRef
+		if ref := jwtCfg.SigningSecretRef; ref != nil {
+			signingSecretRef = &jwt.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+		if ref := jwtCfg.PublicKeyRef; ref != nil {
+			publicKeyRef = &jwt.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+
+		var deny *jwt.DenyConfig
+		if jwtCfg.Deny != nil {
+			deny = &jwt.DenyConfig{
+				StatusCode:  jwtCfg.Deny.StatusCode,
+				ContentType: jwtCfg.Deny.ContentType,
+				Body:        jwtCfg.Deny.Body,
+				RedirectURL: jwtCfg.Deny.RedirectURL,
+			}
+		}
+
+		var revocation *jwt.RevocationConfig
+		if jwtCfg.Revocation != nil {
+			revocation = &jwt.RevocationConfig{
+				ConfigMap: jwtCfg.Revocation.ConfigMap,
+				Secret:    jwtCfg.Revocation.Secret,
+				URL:       jwtCfg.Revocation.URL,
+			}
+			if jwtCfg.Revocation.RefreshInterval != nil {
+				revocation.RefreshInterval = jwtCfg.Revocation.RefreshInterval.Duration
+			}
+		}
+
 		return &Config{
 			JWT: &jwt.Config{
 				SigningSecret:              jwtCfg.SigningSecret,
 				SigningSecretBase64Encoded: jwtCfg.SigningSecretBase64Encoded,
 				PublicKey:                  jwtCfg.PublicKey,
+				SigningSecretRef:           signingSecretRef,
+				PublicKeyRef:               publicKeyRef,
 				JWKsFile:                   jwt.FileOrContent(jwtCfg.JWKsFile),
 				JWKsURL:                    jwtCfg.JWKsURL,
 				StripAuthorizationHeader:   jwtCfg.StripAuthorizationHeader,
 				ForwardHeaders:             jwtCfg.ForwardHeaders,
 				TokenQueryKey:              jwtCfg.TokenQueryKey,
+				TokenSources:               tokenSources,
 				Claims:                     jwtCfg.Claims,
+				Issuer:                     jwtCfg.Issuer,
+				Issuers:                    jwtCfg.Issuers,
+				Audiences:                  jwtCfg.Audiences,
+				Leeway:                     leeway,
+				RequiredClaims:             jwtCfg.RequiredClaims,
+				Algorithms:                 jwtCfg.Algorithms,
+				Rules:                      rules,
+				CacheTTL:                   cacheTTL,
+				Deny:                       deny,
+				Revocation:                 revocation,
 			},
 		}
 
 	case policy.Spec.BasicAuth != nil:
 		basicCfg := policy.Spec.BasicAuth
 
+		var lockout *basicauth.LockoutConfig
+		if basicCfg.Lockout != nil {
+			lockout = &basicauth.LockoutConfig{
+				MaxFailures:       basicCfg.Lockout.MaxFailures,
+				TrustedProxyDepth: basicCfg.Lockout.TrustedProxyDepth,
+			}
+			if basicCfg.Lockout.Duration != nil {
+				lockout.Duration = basicCfg.Lockout.Duration.Duration
+			}
+			if basicCfg.Lockout.MaxDuration != nil {
+				lockout.MaxDuration = basicCfg.Lockout.MaxDuration.Duration
+			}
+		}
+
 		return &Config{
 			BasicAuth: &basicauth.Config{
 				Users:                    basicCfg.Users,
+				UsersSecret:              basicCfg.UsersSecret,
 				Realm:                    basicCfg.Realm,
 				StripAuthorizationHeader: basicCfg.StripAuthorizationHeader,
 				ForwardUsernameHeader:    basicCfg.ForwardUsernameHeader,
+				Lockout:                  lockout,
+			},
+		}
+
+	case policy.Spec.OIDC != nil:
+		oidcCfg := policy.Spec.OIDC
+
+		var session *oidc.Session
+		if oidcCfg.Session != nil {
+			session = &oidc.Session{
+				Name:     oidcCfg.Session.Name,
+				Path:     oidcCfg.Session.Path,
+				Domain:   oidcCfg.Session.Domain,
+				SameSite: oidcCfg.Session.SameSite,
+				Secure:   oidcCfg.Session.Secure,
+			}
+		}
+
+		var clientSecretRef, secretRef *jwt.SecretKeyRef
+		if ref := oidcCfg.ClientSecretRef; ref != nil {
+			clientSecretRef = &jwt.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+		if ref := oidcCfg.SecretRef; ref != nil {
+			secretRef = &jwt.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+
+		return &Config{
+			OIDC: &oidc.Config{
+				Issuer:          oidcCfg.Issuer,
+				ClientID:        oidcCfg.ClientID,
+				ClientSecret:    oidcCfg.ClientSecret,
+				ClientSecretRef: clientSecretRef,
+				RedirectURL:     oidcCfg.RedirectURL,
+				Secret:          oidcCfg.Secret,
+				SecretRef:       secretRef,
+				Scopes:          oidcCfg.Scopes,
+				AuthParams:      oidcCfg.AuthParams,
+				Session:         session,
+				ForwardHeaders:  oidcCfg.ForwardHeaders,
+				Claims:          oidcCfg.Claims,
+			},
+		}
+
+	case policy.Spec.APIKey != nil:
+		apiKeyCfg := policy.Spec.APIKey
+
+		return &Config{
+			APIKey: &apikey.Config{
+				KeyHeader:      apiKeyCfg.KeyHeader,
+				KeyQuery:       apiKeyCfg.KeyQuery,
+				SecretSelector: apiKeyCfg.SecretSelector,
+				ForwardHeaders: apiKeyCfg.ForwardHeaders,
+			},
+		}
+
+	case policy.Spec.MTLS != nil:
+		mtlsCfg := policy.Spec.MTLS
+
+		return &Config{
+			MTLS: &mtls.Config{
+				CASecret:       mtlsCfg.CASecret,
+				Subjects:       mtlsCfg.Subjects,
+				SANs:           mtlsCfg.SANs,
+				Fingerprints:   mtlsCfg.Fingerprints,
+				ForwardHeaders: mtlsCfg.ForwardHeaders,
+			},
+		}
+
+	case policy.Spec.Introspection != nil:
+		introCfg := policy.Spec.Introspection
+
+		return &Config{
+			Introspection: &introspection.Config{
+				URL:                      introCfg.URL,
+				ClientCredentialsSecret:  introCfg.ClientCredentialsSecret,
+				Scopes:                   introCfg.Scopes,
+				Audiences:                introCfg.Audiences,
+				StripAuthorizationHeader: introCfg.StripAuthorizationHeader,
+				ForwardHeaders:           introCfg.ForwardHeaders,
+				Claims:                   introCfg.Claims,
+			},
+		}
+
+	case policy.Spec.IPAllowList != nil:
+		ipCfg := policy.Spec.IPAllowList
+
+		return &Config{
+			IPAllowList: &ipallowlist.Config{
+				Allow:             ipCfg.Allow,
+				Deny:              ipCfg.Deny,
+				TrustedProxyDepth: ipCfg.TrustedProxyDepth,
+				ConfigMap:         ipCfg.ConfigMap,
+			},
+		}
+
+	case policy.Spec.Composite != nil:
+		return &Config{
+			Composite: &composite.Config{
+				AllOf: policy.Spec.Composite.AllOf,
+				AnyOf: policy.Spec.Composite.AnyOf,
 			},
 		}
 
@@ -0,0 +1,67 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ProviderMetadata is the OpenID provider metadata, as served by the discovery endpoint.
+// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata.
+type ProviderMetadata struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKsURL  string `json:"jwks_uri"`
+}
+
+// Discover fetches the metadata of the OpenID provider identified by the given issuer. The issuer advertised by the
+// metadata must be the given one.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*ProviderMetadata, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("build discovery request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch provider metadata: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %q", resp.Status)
+	}
+
+	var md ProviderMetadata
+	if err = json.NewDecoder(resp.Body).Decode(&md); err != nil {
+		return nil, fmt.Errorf("decode provider metadata: %w", err)
+	}
+
+	if md.Issuer != issuer {
+		return nil, fmt.Errorf("issuer %q does not match the configured issuer %q", md.Issuer, issuer)
+	}
+
+	return &md, nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		desc       string
+		statusCode int
+		body       string
+		issuer     string
+		want       *ProviderMetadata
+		wantErr    assert.ErrorAssertionFunc
+	}{
+		{
+			desc:       "valid metadata",
+			statusCode: http.StatusOK,
+			body:       `{"issuer":"{{issuer}}","authorization_endpoint":"https://auth","token_endpoint":"https://token","jwks_uri":"https://jwks"}`,
+			want: &ProviderMetadata{
+				AuthURL:  "https://auth",
+				TokenURL: "https://token",
+				JWKsURL:  "https://jwks",
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			desc:       "issuer not matching",
+			statusCode: http.StatusOK,
+			body:       `{"issuer":"https://other"}`,
+			wantErr:    assert.Error,
+		},
+		{
+			desc:       "unexpected status code",
+			statusCode: http.StatusNotFound,
+			wantErr:    assert.Error,
+		},
+		{
+			desc:       "invalid metadata",
+			statusCode: http.StatusOK,
+			body:       `{`,
+			wantErr:    assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var issuer string
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/.well-known/openid-configuration" {
+					rw.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				rw.WriteHeader(test.statusCode)
+				_, _ = rw.Write([]byte(strings.ReplaceAll(test.body, "{{issuer}}", issuer)))
+			}))
+			t.Cleanup(srv.Close)
+			issuer = srv.URL
+
+			got, err := Discover(context.Background(), srv.Client(), issuer)
+			test.wantErr(t, err)
+			if test.want == nil {
+				return
+			}
+
+			require.NotNil(t, got)
+			test.want.Issuer = issuer
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
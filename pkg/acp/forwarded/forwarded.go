@@ -0,0 +1,44 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package forwarded
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP of the client of the given auth request, or nil if it cannot be found. Traefik appends the
+// IP of its peer to the X-Forwarded-For header, so the client IP is found by skipping as many entries from the right
+// as there are trusted proxies in front of Traefik. Entries further left are set by the client and must not be
+// trusted.
+func ClientIP(req *http.Request, trustedProxyDepth int) net.IP {
+	var ips []string
+	for _, value := range req.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(value, ",") {
+			ips = append(ips, strings.TrimSpace(ip))
+		}
+	}
+
+	i := len(ips) - 1 - trustedProxyDepth
+	if trustedProxyDepth < 0 || i < 0 {
+		return nil
+	}
+
+	return net.ParseIP(ips[i])
+}
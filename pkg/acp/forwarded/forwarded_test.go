@@ -0,0 +1,84 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package forwarded
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		desc          string
+		depth         int
+		xForwardedFor []string
+		want          net.IP
+	}{
+		{
+			desc:          "peer of Traefik",
+			xForwardedFor: []string{"10.0.0.1"},
+			want:          net.ParseIP("10.0.0.1"),
+		},
+		{
+			desc:          "client supplied entries are ignored",
+			xForwardedFor: []string{"192.168.1.1, 192.168.1.2", "10.0.0.1"},
+			want:          net.ParseIP("10.0.0.1"),
+		},
+		{
+			desc:          "behind trusted proxies",
+			depth:         2,
+			xForwardedFor: []string{"192.168.1.1, 10.0.0.1", "172.16.0.1, 172.16.0.2"},
+			want:          net.ParseIP("10.0.0.1"),
+		},
+		{
+			desc:          "chain shorter than the trusted proxy depth",
+			depth:         1,
+			xForwardedFor: []string{"10.0.0.1"},
+		},
+		{
+			desc:          "invalid IP",
+			xForwardedFor: []string{"10.0.0.1, unknown"},
+		},
+		{
+			desc:          "negative trusted proxy depth",
+			depth:         -1,
+			xForwardedFor: []string{"10.0.0.1"},
+		},
+		{
+			desc: "no X-Forwarded-For header",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			for _, value := range test.xForwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			assert.Equal(t, test.want, ClientIP(req, test.depth))
+		})
+	}
+}
@@ -0,0 +1,348 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/audit"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt/expr"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/tokencache"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// negativeCacheTTL is how long inactive tokens are cached for.
+	negativeCacheTTL = time.Minute
+	// defaultCacheTTL is how long active tokens without expiration are cached for.
+	defaultCacheTTL = time.Minute
+	// maxCacheEntries is the number of tokens above which the least recently used ones are evicted.
+	maxCacheEntries = 10000
+)
+
+// Keys of the Secret data entries holding the client credentials used to call the introspection endpoint.
+const (
+	SecretClientIDKey     = "clientId"
+	SecretClientSecretKey = "clientSecret"
+)
+
+// Config configures an OAuth2 token introspection ACP handler.
+type Config struct {
+	URL string
+	// ClientCredentialsSecret is the name of the Secret holding the client credentials used to authenticate against
+	// the introspection endpoint, under the "clientId" and "clientSecret" keys.
+	ClientCredentialsSecret string
+	// Scopes are the scopes the token must all be granted.
+	Scopes []string
+	// Audiences are the audiences the token must be issued for. The token is accepted if it matches any of them.
+	Audiences                []string
+	StripAuthorizationHeader bool
+	ForwardHeaders           map[string]string
+	Claims                   string
+}
+
+// Handler is an OAuth2 token introspection ACP Handler.
+type Handler struct {
+	name string
+
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	scopes    []string
+	audiences []string
+
+	stripAuthorization bool
+	fwdHeaders         map[string]string
+
+	validateCustomClaims expr.Predicate
+
+	cache *tokencache.Cache
+}
+
+// NewHandler returns a new OAuth2 token introspection ACP Handler. The client credentials are read from the given
+// Secret.
+func NewHandler(cfg *Config, polName string, credSecret *corev1.Secret) (*Handler, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("an introspection URL is required")
+	}
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("parse introspection URL: %w", err)
+	}
+
+	if cfg.ClientCredentialsSecret == "" {
+		return nil, errors.New("a client credentials secret is required")
+	}
+	if credSecret == nil {
+		return nil, fmt.Errorf("client credentials secret %q not found", cfg.ClientCredentialsSecret)
+	}
+
+	clientID := string(credSecret.Data[SecretClientIDKey])
+	if clientID == "" {
+		return nil, fmt.Errorf("no client ID found under %q in secret %q", SecretClientIDKey, cfg.ClientCredentialsSecret)
+	}
+
+	var (
+		pred expr.Predicate
+		err  error
+	)
+	if cfg.Claims != "" {
+		pred, err = expr.Parse(cfg.Claims)
+		if err != nil {
+			return nil, fmt.Errorf("make predicate: %w", err)
+		}
+	}
+
+	return &Handler{
+		name:         polName,
+		url:          cfg.URL,
+		clientID:     clientID,
+		clientSecret: string(credSecret.Data[SecretClientSecretKey]),
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			Timeout: 5 * time.Second,
+		},
+		scopes:               cfg.Scopes,
+		audiences:            cfg.Audiences,
+		stripAuthorization:   cfg.StripAuthorizationHeader,
+		fwdHeaders:           cfg.ForwardHeaders,
+		validateCustomClaims: pred,
+		cache:                tokencache.New(maxCacheEntries, time.Now),
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	l := log.With().Str("handler_type", "Introspection").Str("handler_name", h.name).Logger()
+
+	token, ok := bearerToken(req.Header.Get("Authorization"))
+	if !ok {
+		l.Debug().Msg("No bearer token found in request")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.introspect(req.Context(), token)
+	if err != nil {
+		l.Error().Err(err).Msg("Unable to introspect token")
+		rw.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	if claims == nil {
+		l.Debug().Msg("Inactive token")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if sub, ok := claims["sub"].(string); ok {
+		audit.SetSubject(req.Context(), sub)
+	}
+
+	if !h.hasScopes(claims) || !h.hasAudience(claims) {
+		l.Debug().Msg("Token scopes or audience not matching")
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if h.validateCustomClaims != nil && !h.validateCustomClaims(claims, expr.NewRequest(req)) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	hdrs, err := expr.PluckClaims(h.fwdHeaders, claims)
+	if err != nil {
+		l.Error().Err(err).Msg("Unable to set forwarded header")
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	for name, vals := range hdrs {
+		for _, val := range vals {
+			rw.Header().Add(name, val)
+		}
+	}
+
+	if h.stripAuthorization {
+		rw.Header().Add("Authorization", "")
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// bearerToken returns the token of the given Authorization header value, which must use the Bearer scheme. The scheme
+// is case-insensitive.
+func bearerToken(authorization string) (string, bool) {
+	const prefix = "Bearer "
+
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	token := strings.TrimSpace(authorization[len(prefix):])
+
+	return token, token != ""
+}
+
+// introspect returns the introspection response of the given token, or nil if the token is not active. Responses are
+// cached until the token expires, and concurrent introspections of the same token are collapsed into a single call.
+func (h *Handler) introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	v, err := h.cache.Load(ctx, token, func(ctx context.Context) (interface{}, time.Time, error) {
+		claims, err := h.callEndpoint(ctx, token)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		now := time.Now()
+
+		active, _ := claims["active"].(bool)
+		exp, hasExp := expiresAt(claims)
+		if !active || (hasExp && !exp.After(now)) {
+			return nil, now.Add(negativeCacheTTL), nil
+		}
+
+		if !hasExp {
+			exp = now.Add(defaultCacheTTL)
+		}
+
+		return claims, exp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := v.(map[string]interface{})
+
+	return claims, nil
+}
+
+func (h *Handler) callEndpoint(ctx context.Context, token string) (map[string]interface{}, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(h.clientID), url.QueryEscape(h.clientSecret))
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("call introspection endpoint: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from introspection endpoint", resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("decode introspection response: %w", err)
+	}
+
+	return claims, nil
+}
+
+// hasScopes reports whether the token has been granted all the required scopes.
+func (h *Handler) hasScopes(claims map[string]interface{}) bool {
+	if len(h.scopes) == 0 {
+		return true
+	}
+
+	scope, _ := claims["scope"].(string)
+
+	granted := make(map[string]struct{})
+	for _, s := range strings.Fields(scope) {
+		granted[s] = struct{}{}
+	}
+
+	for _, s := range h.scopes {
+		if _, ok := granted[s]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasAudience reports whether the token has been issued for one of the required audiences.
+func (h *Handler) hasAudience(claims map[string]interface{}) bool {
+	if len(h.audiences) == 0 {
+		return true
+	}
+
+	var auds []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		auds = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+	}
+
+	for _, want := range h.audiences {
+		for _, aud := range auds {
+			if aud == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func expiresAt(claims map[string]interface{}) (time.Time, bool) {
+	num, ok := claims["exp"].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	exp, err := num.Int64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(exp, 0), true
+}
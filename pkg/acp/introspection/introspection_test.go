@@ -0,0 +1,382 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package introspection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/tokencache"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewHandler(t *testing.T) {
+	tests := []struct {
+		desc       string
+		cfg        Config
+		credSecret *corev1.Secret
+		wantErr    assert.ErrorAssertionFunc
+	}{
+		{
+			desc:       "missing URL",
+			cfg:        Config{ClientCredentialsSecret: "creds"},
+			credSecret: credentialsSecret(),
+			wantErr:    assert.Error,
+		},
+		{
+			desc:       "missing credentials secret name",
+			cfg:        Config{URL: "https://auth.example.com/introspect"},
+			credSecret: credentialsSecret(),
+			wantErr:    assert.Error,
+		},
+		{
+			desc:    "credentials secret not found",
+			cfg:     Config{URL: "https://auth.example.com/introspect", ClientCredentialsSecret: "creds"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:       "missing client ID",
+			cfg:        Config{URL: "https://auth.example.com/introspect", ClientCredentialsSecret: "creds"},
+			credSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds"}},
+			wantErr:    assert.Error,
+		},
+		{
+			desc:       "invalid claims",
+			cfg:        Config{URL: "https://auth.example.com/introspect", ClientCredentialsSecret: "creds", Claims: "Unknown(`grp`)"},
+			credSecret: credentialsSecret(),
+			wantErr:    assert.Error,
+		},
+		{
+			desc:       "valid",
+			cfg:        Config{URL: "https://auth.example.com/introspect", ClientCredentialsSecret: "creds"},
+			credSecret: credentialsSecret(),
+			wantErr:    assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&test.cfg, "my-policy", test.credSecret)
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+
+	responses := map[string]map[string]interface{}{
+		"valid": {
+			"active": true,
+			"scope":  "read write",
+			"aud":    []string{"api", "other"},
+			"sub":    "john",
+			"group":  "dev",
+			"exp":    exp,
+		},
+		"inactive": {"active": false},
+		// Credentials of other schemes must never be introspected, even if the endpoint would accept them.
+		"Basic am9objpzZWNyZXQ=": {"active": true, "sub": "john"},
+		"expired": {
+			"active": true,
+			"exp":    time.Now().Add(-time.Minute).Unix(),
+		},
+	}
+
+	srv := newFakeIntrospectionServer(t, responses)
+
+	tests := []struct {
+		desc           string
+		cfg            Config
+		token          string
+		authorization  string
+		wantStatusCode int
+		wantHeaders    map[string]string
+	}{
+		{
+			desc:           "no token",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "basic credentials",
+			authorization:  "Basic am9objpzZWNyZXQ=",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "empty bearer token",
+			authorization:  "Bearer ",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "case-insensitive bearer scheme",
+			authorization:  "bearer valid",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "inactive token",
+			token:          "inactive",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "unknown token",
+			token:          "unknown",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "expired token",
+			token:          "expired",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "valid token",
+			token:          "valid",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "granted scopes",
+			cfg:            Config{Scopes: []string{"read", "write"}},
+			token:          "valid",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "missing scope",
+			cfg:            Config{Scopes: []string{"read", "admin"}},
+			token:          "valid",
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "matching audience",
+			cfg:            Config{Audiences: []string{"foo", "api"}},
+			token:          "valid",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "audience not matching",
+			cfg:            Config{Audiences: []string{"foo"}},
+			token:          "valid",
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "claims not matching",
+			cfg:            Config{Claims: "Equals(`group`, `ops`)"},
+			token:          "valid",
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc: "forwarded headers",
+			cfg: Config{
+				Claims:                   "Equals(`group`, `dev`)",
+				ForwardHeaders:           map[string]string{"X-User": "sub", "X-Exp": "exp"},
+				StripAuthorizationHeader: true,
+			},
+			token:          "valid",
+			wantStatusCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"X-User":        "john",
+				"X-Exp":         strconv.FormatInt(exp, 10),
+				"Authorization": "",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			test.cfg.URL = srv.URL + "/introspect"
+			test.cfg.ClientCredentialsSecret = "creds"
+
+			h, err := NewHandler(&test.cfg, "my-policy", credentialsSecret())
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+			for name, value := range test.wantHeaders {
+				assert.Equal(t, []string{value}, rw.Header().Values(name), name)
+			}
+		})
+	}
+}
+
+func TestHandler_ServeHTTP_cache(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		if err := req.ParseForm(); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		resp := map[string]interface{}{"active": false}
+		if req.Form.Get("token") == "valid" {
+			resp = map[string]interface{}{"active": true, "exp": time.Now().Add(time.Hour).Unix()}
+		}
+		_ = json.NewEncoder(rw).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	h, err := NewHandler(&Config{URL: srv.URL, ClientCredentialsSecret: "creds"}, "my-policy", credentialsSecret())
+	require.NoError(t, err)
+
+	now := time.Now()
+	h.cache = tokencache.New(maxCacheEntries, func() time.Time { return now })
+
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("valid"))
+	assert.Equal(t, http.StatusOK, serve("valid"))
+	assert.Equal(t, http.StatusUnauthorized, serve("inactive"))
+	assert.Equal(t, http.StatusUnauthorized, serve("inactive"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Once expired, entries are not served from the cache anymore.
+	now = now.Add(2 * time.Hour)
+
+	assert.Equal(t, http.StatusOK, serve("valid"))
+	assert.Equal(t, http.StatusUnauthorized, serve("inactive"))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestHandler_ServeHTTP_concurrentIntrospections(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{"active": true})
+	}))
+	t.Cleanup(srv.Close)
+
+	h, err := NewHandler(&Config{URL: srv.URL, ClientCredentialsSecret: "creds"}, "my-policy", credentialsSecret())
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			req.Header.Set("Authorization", "Bearer token")
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, http.StatusOK, rw.Code)
+		}()
+	}
+
+	// Let the requests reach the cache before the introspection completes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHandler_ServeHTTP_endpointFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	h, err := NewHandler(&Config{URL: srv.URL, ClientCredentialsSecret: "creds"}, "my-policy", credentialsSecret())
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+	req.Header.Set("Authorization", "Bearer token")
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusBadGateway, rw.Code)
+}
+
+func newFakeIntrospectionServer(t *testing.T, responses map[string]map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/introspect", func(rw http.ResponseWriter, req *http.Request) {
+		clientID, clientSecret, ok := req.BasicAuth()
+		if !ok || clientID != "client" || clientSecret != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if err := req.ParseForm(); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		resp, ok := responses[req.Form.Get("token")]
+		if !ok {
+			resp = map[string]interface{}{"active": false}
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(resp)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func credentialsSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds"},
+		Data: map[string][]byte{
+			SecretClientIDKey:     []byte("client"),
+			SecretClientSecretKey: []byte("secret"),
+		},
+	}
+}
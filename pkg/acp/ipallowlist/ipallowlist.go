@@ -0,0 +1,181 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package ipallowlist
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/forwarded"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Keys of the ConfigMap data entries holding the additional allowed and denied ranges. Each entry holds a list of
+// IPs or CIDRs separated by commas or new lines.
+const (
+	ConfigMapAllowKey = "allow"
+	ConfigMapDenyKey  = "deny"
+)
+
+// Config configures an IP allow list ACP handler.
+type Config struct {
+	// Allow and Deny are lists of IPs or CIDRs. Denied ranges take precedence over allowed ones. When no allowed
+	// range is defined, all IPs which are not denied are allowed.
+	Allow []string
+	Deny  []string
+	// TrustedProxyDepth is the number of trusted proxies in front of Traefik. The source IP is the one found at this
+	// depth in the X-Forwarded-For header, starting from the right.
+	TrustedProxyDepth int
+	// ConfigMap is the name of an optional ConfigMap holding additional ranges under the "allow" and "deny" keys.
+	ConfigMap string
+}
+
+// Handler is an IP allow list ACP Handler.
+type Handler struct {
+	name string
+
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	depth int
+}
+
+// NewHandler returns a new IP allow list ACP Handler. Additional ranges are read from the given ConfigMap if one is
+// configured.
+func NewHandler(cfg *Config, polName string, configMap *corev1.ConfigMap) (*Handler, error) {
+	if cfg.TrustedProxyDepth < 0 {
+		return nil, errors.New("trusted proxy depth must be positive")
+	}
+
+	allowRanges := cfg.Allow
+	denyRanges := cfg.Deny
+	if cfg.ConfigMap != "" {
+		if configMap == nil {
+			return nil, fmt.Errorf("ConfigMap %q not found", cfg.ConfigMap)
+		}
+
+		allowRanges = append(splitRanges(configMap.Data[ConfigMapAllowKey]), allowRanges...)
+		denyRanges = append(splitRanges(configMap.Data[ConfigMapDenyKey]), denyRanges...)
+	}
+
+	if len(allowRanges) == 0 && len(denyRanges) == 0 {
+		return nil, errors.New("at least an allowed or denied range is required")
+	}
+
+	allow, err := parseRanges(allowRanges)
+	if err != nil {
+		return nil, fmt.Errorf("parse allowed ranges: %w", err)
+	}
+
+	deny, err := parseRanges(denyRanges)
+	if err != nil {
+		return nil, fmt.Errorf("parse denied ranges: %w", err)
+	}
+
+	return &Handler{
+		name:  polName,
+		allow: allow,
+		deny:  deny,
+		depth: cfg.TrustedProxyDepth,
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	l := log.With().Str("handler_type", "IPAllowList").Str("handler_name", h.name).Logger()
+
+	ip := forwarded.ClientIP(req, h.depth)
+	if ip == nil {
+		l.Debug().Str("x_forwarded_for", req.Header.Get("X-Forwarded-For")).Msg("Unable to find source IP")
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if contains(h.deny, ip) {
+		l.Debug().Str("ip", ip.String()).Msg("Source IP denied")
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if len(h.allow) > 0 && !contains(h.allow, ip) {
+		l.Debug().Str("ip", ip.String()).Msg("Source IP not allowed")
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+func contains(ranges []*net.IPNet, ip net.IP) bool {
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseRanges(ranges []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(ranges))
+	for _, r := range ranges {
+		n, err := parseRange(r)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// parseRange parses the given CIDR, or IP which is then considered as a single-IP range.
+func parseRange(r string) (*net.IPNet, error) {
+	if !strings.Contains(r, "/") {
+		ip := net.ParseIP(r)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP %q", r)
+		}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	_, n, err := net.ParseCIDR(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %q: %w", r, err)
+	}
+
+	return n, nil
+}
+
+func splitRanges(s string) []string {
+	var ranges []string
+	for _, r := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == '\n' }) {
+		if r = strings.TrimSpace(r); r != "" {
+			ranges = append(ranges, r)
+		}
+	}
+
+	return ranges
+}
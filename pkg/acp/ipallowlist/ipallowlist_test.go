@@ -0,0 +1,199 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package ipallowlist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewHandler(t *testing.T) {
+	tests := []struct {
+		desc      string
+		cfg       Config
+		configMap *corev1.ConfigMap
+		wantErr   assert.ErrorAssertionFunc
+	}{
+		{
+			desc:    "no range",
+			cfg:     Config{},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "negative depth",
+			cfg:     Config{Allow: []string{"10.0.0.0/8"}, TrustedProxyDepth: -1},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "invalid CIDR",
+			cfg:     Config{Allow: []string{"10.0.0.0/33"}},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "invalid IP",
+			cfg:     Config{Deny: []string{"10.0.0"}},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "ConfigMap not found",
+			cfg:     Config{ConfigMap: "ranges"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:      "invalid range in ConfigMap",
+			cfg:       Config{ConfigMap: "ranges"},
+			configMap: newConfigMap("foo", ""),
+			wantErr:   assert.Error,
+		},
+		{
+			desc:      "ranges from ConfigMap only",
+			cfg:       Config{ConfigMap: "ranges"},
+			configMap: newConfigMap("10.0.0.0/8", ""),
+			wantErr:   assert.NoError,
+		},
+		{
+			desc:    "valid",
+			cfg:     Config{Allow: []string{"10.0.0.0/8", "192.168.1.1", "::1"}, Deny: []string{"10.0.0.1"}},
+			wantErr: assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&test.cfg, "my-policy", test.configMap)
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		desc           string
+		cfg            Config
+		configMap      *corev1.ConfigMap
+		xff            []string
+		wantStatusCode int
+	}{
+		{
+			desc:           "allowed IP",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}},
+			xff:            []string{"10.1.2.3"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "allowed IPv6",
+			cfg:            Config{Allow: []string{"2001:db8::/32"}},
+			xff:            []string{"2001:db8::1"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "IP not allowed",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}},
+			xff:            []string{"192.168.1.1"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "denied IP takes precedence",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.1.0.0/16"}},
+			xff:            []string{"10.1.2.3"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "IP not denied without allowed ranges",
+			cfg:            Config{Deny: []string{"10.0.0.0/8"}},
+			xff:            []string{"192.168.1.1"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "no X-Forwarded-For",
+			cfg:            Config{Deny: []string{"10.0.0.0/8"}},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "spoofed X-Forwarded-For is ignored without trusted proxies",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}},
+			xff:            []string{"10.1.2.3, 192.168.1.1"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "source IP behind trusted proxies",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}, TrustedProxyDepth: 2},
+			xff:            []string{"1.1.1.1, 10.1.2.3", "172.16.0.1, 172.16.0.2"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "not enough entries for the trusted proxy depth",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}, TrustedProxyDepth: 2},
+			xff:            []string{"10.1.2.3, 172.16.0.1"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "allowed by ConfigMap",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}, ConfigMap: "ranges"},
+			configMap:      newConfigMap("192.168.1.0/24,\n192.168.2.0/24\n", ""),
+			xff:            []string{"192.168.2.1"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "denied by ConfigMap",
+			cfg:            Config{Allow: []string{"10.0.0.0/8"}, ConfigMap: "ranges"},
+			configMap:      newConfigMap("", "10.1.2.3"),
+			xff:            []string{"10.1.2.3"},
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHandler(&test.cfg, "my-policy", test.configMap)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			for _, xff := range test.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+		})
+	}
+}
+
+func newConfigMap(allow, deny string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ranges"},
+		Data: map[string]string{
+			ConfigMapAllowKey: allow,
+			ConfigMapDenyKey:  deny,
+		},
+	}
+}
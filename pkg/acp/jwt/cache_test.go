@@ -0,0 +1,106 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/tokencache"
+)
+
+func TestServeHTTP_cache(t *testing.T) {
+	now := time.Now()
+
+	h, err := NewHandler(&Config{
+		SigningSecret:  "secret",
+		ForwardHeaders: map[string]string{"Group": "grp"},
+		Rules:          []Rule{{Match: "Method(`GET`)"}},
+	}, "my-cached-policy", nil, nil)
+	require.NoError(t, err)
+	h.claims.now = func() time.Time { return now }
+	h.cache = tokencache.New(maxCacheEntries, func() time.Time { return now })
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"grp": "admin",
+		"exp": now.Add(30 * time.Second).Unix(),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-cached-policy", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		req.Header.Set("X-Forwarded-Method", method)
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+
+		return rw
+	}
+
+	rw := serve(http.MethodGet)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "admin", rw.Header().Get("Group"))
+
+	rw = serve(http.MethodGet)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "admin", rw.Header().Get("Group"))
+
+	// Rules are still evaluated against each request when the validation is cached.
+	rw = serve(http.MethodPost)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(cacheLookups.WithLabelValues("my-cached-policy", "hit")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(cacheLookups.WithLabelValues("my-cached-policy", "miss")))
+
+	// The validation is not cached past the token expiration.
+	now = now.Add(time.Minute)
+
+	rw = serve(http.MethodGet)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(cacheLookups.WithLabelValues("my-cached-policy", "hit")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(cacheLookups.WithLabelValues("my-cached-policy", "miss")))
+}
+
+func TestServeHTTP_cacheDisabled(t *testing.T) {
+	h, err := NewHandler(&Config{SigningSecret: "secret", CacheTTL: -1}, "my-uncached-policy", nil, nil)
+	require.NoError(t, err)
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"grp": "admin"}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-uncached-policy", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+	}
+
+	assert.Zero(t, testutil.ToFloat64(cacheLookups.WithLabelValues("my-uncached-policy", "hit")))
+	assert.Zero(t, testutil.ToFloat64(cacheLookups.WithLabelValues("my-uncached-policy", "miss")))
+}
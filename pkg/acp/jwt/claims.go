@@ -0,0 +1,143 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// claimsValidator validates the registered claims of JWTs.
+type claimsValidator struct {
+	issuers        []string
+	audiences      []string
+	leeway         time.Duration
+	requiredClaims []string
+
+	now func() time.Time
+}
+
+// validateTime makes sure the token is valid at the current time, according to its "exp", "nbf" and "iat" claims.
+// The configured leeway is tolerated to account for clock skew.
+func (v claimsValidator) validateTime(claims jwt.MapClaims) error {
+	now := v.now()
+
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if ok && !now.Before(exp.Add(v.leeway)) {
+		return errors.New("token is expired")
+	}
+
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+
+	iat, ok, err := numericDate(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.leeway).Before(iat) {
+		return errors.New("token used before issued")
+	}
+
+	return nil
+}
+
+// validateClaims makes sure the token has been issued by an expected issuer, for an expected audience, and that it
+// holds all the required claims.
+func (v claimsValidator) validateClaims(claims jwt.MapClaims) error {
+	if len(v.issuers) > 0 {
+		iss, _ := claims["iss"].(string)
+		if !contains(v.issuers, iss) {
+			return fmt.Errorf("issuer %q not allowed", iss)
+		}
+	}
+
+	if len(v.audiences) > 0 && !v.matchAudience(claims["aud"]) {
+		return errors.New("audience not allowed")
+	}
+
+	for _, name := range v.requiredClaims {
+		if _, ok := claims[name]; !ok {
+			return fmt.Errorf("missing required claim %q", name)
+		}
+	}
+
+	return nil
+}
+
+// matchAudience returns whether the given "aud" claim, which is either a string or an array of strings, holds one of
+// the expected audiences.
+func (v claimsValidator) matchAudience(aud interface{}) bool {
+	switch aud := aud.(type) {
+	case string:
+		return contains(v.audiences, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && contains(v.audiences, s) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// numericDate returns the time held by the given claim. It returns false if the claim is not set.
+func numericDate(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	raw, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	var secs float64
+	switch v := raw.(type) {
+	case json.Number:
+		var err error
+		secs, err = v.Float64()
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %q claim: %w", name, err)
+		}
+	case float64:
+		secs = v
+	default:
+		return time.Time{}, false, fmt.Errorf("invalid %q claim: not a number", name)
+	}
+
+	return time.Unix(0, int64(secs*float64(time.Second))), true, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
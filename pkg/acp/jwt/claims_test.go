@@ -0,0 +1,147 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_ServeHTTP_registeredClaims(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc           string
+		cfg            Config
+		claims         jwt.MapClaims
+		wantStatusCode int
+	}{
+		{
+			desc:           "expired token",
+			cfg:            Config{SigningSecret: "secret"},
+			claims:         jwt.MapClaims{"exp": now.Add(-time.Second).Unix()},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "expired token within leeway",
+			cfg:            Config{SigningSecret: "secret", Leeway: time.Minute},
+			claims:         jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "token not valid yet",
+			cfg:            Config{SigningSecret: "secret", Leeway: time.Minute},
+			claims:         jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "token not valid yet within leeway",
+			cfg:            Config{SigningSecret: "secret", Leeway: time.Minute},
+			claims:         jwt.MapClaims{"nbf": now.Add(30 * time.Second).Unix()},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "token issued in the future",
+			cfg:            Config{SigningSecret: "secret"},
+			claims:         jwt.MapClaims{"iat": now.Add(time.Minute).Unix()},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "invalid expiration",
+			cfg:            Config{SigningSecret: "secret"},
+			claims:         jwt.MapClaims{"exp": "tomorrow"},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "allowed issuer",
+			cfg:            Config{SigningSecret: "secret", Issuers: []string{"https://a.example.com", "https://b.example.com"}},
+			claims:         jwt.MapClaims{"iss": "https://b.example.com"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "issuer not allowed",
+			cfg:            Config{SigningSecret: "secret", Issuers: []string{"https://a.example.com"}},
+			claims:         jwt.MapClaims{"iss": "https://b.example.com"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "missing issuer",
+			cfg:            Config{SigningSecret: "secret", Issuers: []string{"https://a.example.com"}},
+			claims:         jwt.MapClaims{},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "allowed audience",
+			cfg:            Config{SigningSecret: "secret", Audiences: []string{"my-api"}},
+			claims:         jwt.MapClaims{"aud": "my-api"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "allowed audience in a list",
+			cfg:            Config{SigningSecret: "secret", Audiences: []string{"my-api", "my-other-api"}},
+			claims:         jwt.MapClaims{"aud": []string{"foo", "my-other-api"}},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "audience not allowed",
+			cfg:            Config{SigningSecret: "secret", Audiences: []string{"my-api"}},
+			claims:         jwt.MapClaims{"aud": []string{"foo", "bar"}},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "required claims present",
+			cfg:            Config{SigningSecret: "secret", RequiredClaims: []string{"sub", "email"}},
+			claims:         jwt.MapClaims{"sub": "john", "email": "john@example.com"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "missing required claim",
+			cfg:            Config{SigningSecret: "secret", RequiredClaims: []string{"sub", "email"}},
+			claims:         jwt.MapClaims{"sub": "john"},
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHandler(&test.cfg, "my-policy", nil, nil)
+			require.NoError(t, err)
+			h.claims.now = func() time.Time { return now }
+
+			tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, test.claims).SignedString([]byte("secret"))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			req.Header.Set("Authorization", "Bearer "+tok)
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/rs/zerolog"
+)
+
+// Bearer token error codes, as defined by RFC 6750.
+const (
+	errInvalidToken      = "invalid_token"
+	errInsufficientScope = "insufficient_scope"
+)
+
+// DenyConfig configures the response sent when a request is denied.
+type DenyConfig struct {
+	// StatusCode overrides the status code of the response, which is 401 for missing or invalid tokens and 403 for
+	// tokens not granting access.
+	StatusCode int
+	// ContentType is the content type of the body. It defaults to "text/plain; charset=utf-8".
+	ContentType string
+	// Body is a template of the response body. It is given the StatusCode, Error and ErrorDescription of the denial,
+	// and a "json" function to encode values in JSON bodies. HTML bodies are escaped as such.
+	Body string
+	// RedirectURL is an absolute URL browsers are redirected to instead of being denied.
+	RedirectURL string
+}
+
+type bodyTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// denier writes the responses of denied requests.
+type denier struct {
+	statusCode  int
+	contentType string
+	body        bodyTemplate
+	redirectURL string
+}
+
+func newDenier(cfg *DenyConfig) (denier, error) {
+	if cfg == nil {
+		return denier{}, nil
+	}
+
+	if cfg.StatusCode != 0 && (cfg.StatusCode < 400 || cfg.StatusCode > 599) {
+		return denier{}, fmt.Errorf("invalid deny status code %d", cfg.StatusCode)
+	}
+
+	if cfg.RedirectURL != "" {
+		u, err := url.Parse(cfg.RedirectURL)
+		if err != nil {
+			return denier{}, fmt.Errorf("parse deny redirect URL: %w", err)
+		}
+		if !u.IsAbs() {
+			return denier{}, errors.New("deny redirect URL must be absolute")
+		}
+	}
+
+	d := denier{
+		statusCode:  cfg.StatusCode,
+		contentType: cfg.ContentType,
+		redirectURL: cfg.RedirectURL,
+	}
+	if d.contentType == "" {
+		d.contentType = "text/plain; charset=utf-8"
+	}
+
+	if cfg.Body == "" {
+		return d, nil
+	}
+
+	var err error
+	if strings.Contains(d.contentType, "html") {
+		d.body, err = htmltemplate.New("body").Funcs(htmltemplate.FuncMap{"json": toJSON}).Parse(cfg.Body)
+	} else {
+		d.body, err = texttemplate.New("body").Funcs(texttemplate.FuncMap{"json": toJSON}).Parse(cfg.Body)
+	}
+	if err != nil {
+		return denier{}, fmt.Errorf("parse deny body template: %w", err)
+	}
+
+	return d, nil
+}
+
+// denyData is the data given to deny body templates.
+type denyData struct {
+	StatusCode       int
+	Error            string
+	ErrorDescription string
+}
+
+// deny denies the given request. The error code and description are reported in the WWW-Authenticate header, as
+// described by RFC 6750. An empty error code means no token was found in the request.
+func (d denier) deny(l zerolog.Logger, rw http.ResponseWriter, req *http.Request, statusCode int, errCode, desc string) {
+	if d.redirectURL != "" && isBrowserRequest(req) {
+		rw.Header().Set("Location", d.redirectURL)
+		rw.WriteHeader(http.StatusFound)
+		return
+	}
+
+	challenge := "Bearer"
+	if errCode != "" {
+		challenge += fmt.Sprintf(" error=%q", errCode)
+		if desc != "" {
+			challenge += fmt.Sprintf(", error_description=%q", sanitizeDescription(desc))
+		}
+	}
+	rw.Header().Set("WWW-Authenticate", challenge)
+
+	if d.statusCode != 0 {
+		statusCode = d.statusCode
+	}
+
+	if d.body == nil {
+		rw.WriteHeader(statusCode)
+		return
+	}
+
+	var body bytes.Buffer
+	data := denyData{StatusCode: statusCode, Error: errCode, ErrorDescription: desc}
+	if err := d.body.Execute(&body, data); err != nil {
+		l.Error().Err(err).Msg("Unable to render deny body")
+		rw.WriteHeader(statusCode)
+		return
+	}
+
+	rw.Header().Set("Content-Type", d.contentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	rw.WriteHeader(statusCode)
+	_, _ = rw.Write(body.Bytes())
+}
+
+// isBrowserRequest returns whether the given request has been sent by a browser navigating to a page.
+func isBrowserRequest(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// sanitizeDescription removes the characters not allowed in an error description by RFC 6750.
+func sanitizeDescription(desc string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '"' || r == '\\':
+			return '\''
+		case r < 0x20 || r > 0x7e:
+			return -1
+		default:
+			return r
+		}
+	}, desc)
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_ServeHTTP_deny(t *testing.T) {
+	tests := []struct {
+		desc           string
+		deny           *DenyConfig
+		claims         jwt.MapClaims
+		accept         string
+		wantStatusCode int
+		wantHeader     http.Header
+		wantBody       string
+	}{
+		{
+			desc:           "default response",
+			claims:         jwt.MapClaims{"iss": "evil"},
+			wantStatusCode: http.StatusForbidden,
+			wantHeader: http.Header{
+				"Www-Authenticate": {`Bearer error="insufficient_scope", error_description="issuer 'evil' not allowed"`},
+			},
+		},
+		{
+			desc: "custom status code and JSON body",
+			deny: &DenyConfig{
+				StatusCode:  http.StatusNotFound,
+				ContentType: "application/json",
+				Body:        `{"status":{{ .StatusCode }},"error":{{ json .Error }},"description":{{ json .ErrorDescription }}}`,
+			},
+			claims:         jwt.MapClaims{"iss": "evil"},
+			wantStatusCode: http.StatusNotFound,
+			wantHeader: http.Header{
+				"Www-Authenticate": {`Bearer error="insufficient_scope", error_description="issuer 'evil' not allowed"`},
+				"Content-Type":     {"application/json"},
+				"Content-Length":   {"87"},
+			},
+			wantBody: `{"status":404,"error":"insufficient_scope","description":"issuer \"evil\" not allowed"}`,
+		},
+		{
+			desc: "HTML body is escaped",
+			deny: &DenyConfig{
+				ContentType: "text/html; charset=utf-8",
+				Body:        `<p>{{ .ErrorDescription }}</p>`,
+			},
+			claims:         jwt.MapClaims{"iss": "<script>"},
+			wantStatusCode: http.StatusForbidden,
+			wantHeader: http.Header{
+				"Www-Authenticate": {`Bearer error="insufficient_scope", error_description="issuer '<script>' not allowed"`},
+				"Content-Type":     {"text/html; charset=utf-8"},
+				"Content-Length":   {"50"},
+			},
+			wantBody: `<p>issuer &#34;&lt;script&gt;&#34; not allowed</p>`,
+		},
+		{
+			desc:           "browser is redirected",
+			deny:           &DenyConfig{RedirectURL: "https://login.example.com"},
+			claims:         jwt.MapClaims{"iss": "https://other.example.com"},
+			accept:         "text/html,application/xhtml+xml",
+			wantStatusCode: http.StatusFound,
+			wantHeader:     http.Header{"Location": {"https://login.example.com"}},
+		},
+		{
+			desc:           "API client is not redirected",
+			deny:           &DenyConfig{RedirectURL: "https://login.example.com"},
+			claims:         jwt.MapClaims{"iss": "https://other.example.com"},
+			accept:         "application/json",
+			wantStatusCode: http.StatusForbidden,
+			wantHeader: http.Header{
+				"Www-Authenticate": {`Bearer error="insufficient_scope", error_description="issuer 'https://other.example.com' not allowed"`},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := Config{
+				SigningSecret: "secret",
+				Issuers:       []string{"https://issuer.example.com"},
+				Deny:          test.deny,
+			}
+			h, err := NewHandler(&cfg, "my-policy", nil, nil)
+			require.NoError(t, err)
+
+			tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, test.claims).SignedString([]byte("secret"))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			req.Header.Set("Authorization", "Bearer "+tok)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+			assert.Equal(t, test.wantHeader, rw.Header())
+			assert.Equal(t, test.wantBody, rw.Body.String())
+		})
+	}
+}
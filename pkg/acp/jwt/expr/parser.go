@@ -3,14 +3,17 @@ package expr
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vulcand/predicate"
 )
 
-// Predicate represents a function that can be evaluated to get the result of an expression.
-type Predicate func(a map[string]interface{}) bool
+// Predicate represents a function that can be evaluated to get the result of an expression. It is evaluated against
+// the claims of a token and the request being authorized.
+type Predicate func(claims map[string]interface{}, req Request) bool
 
 // Parse returns a predicate from the given expression.
 func Parse(expr string) (Predicate, error) {
@@ -26,6 +29,23 @@ func Parse(expr string) (Predicate, error) {
 			"Contains":      contains,
 			"SplitContains": splitContains,
 			"Ohubf":         ohubf,
+
+			"GreaterThan":     compare(func(claim, expected float64) bool { return claim > expected }),
+			"GreaterOrEquals": compare(func(claim, expected float64) bool { return claim >= expected }),
+			"LessThan":        compare(func(claim, expected float64) bool { return claim < expected }),
+			"LessOrEquals":    compare(func(claim, expected float64) bool { return claim <= expected }),
+			"Matches":         matchesRegexp,
+			"Exists":          exists,
+			"HasKey":          hasKey,
+			"Intersects":      intersects,
+			"ContainsAll":     containsAll,
+			"Before":          before,
+			"After":           after,
+
+			"Method":     method,
+			"Host":       host,
+			"Path":       path,
+			"PathPrefix": pathPrefix,
 		},
 	})
 	if err != nil {
@@ -41,25 +61,25 @@ func Parse(expr string) (Predicate, error) {
 }
 
 func andFunc(a, b Predicate) Predicate {
-	return func(v map[string]interface{}) bool {
-		return a(v) && b(v)
+	return func(v map[string]interface{}, req Request) bool {
+		return a(v, req) && b(v, req)
 	}
 }
 
 func orFunc(a, b Predicate) Predicate {
-	return func(v map[string]interface{}) bool {
-		return a(v) || b(v)
+	return func(v map[string]interface{}, req Request) bool {
+		return a(v, req) || b(v, req)
 	}
 }
 
 func notFunc(a Predicate) Predicate {
-	return func(v map[string]interface{}) bool {
-		return !a(v)
+	return func(v map[string]interface{}, req Request) bool {
+		return !a(v, req)
 	}
 }
 
 func equals(claimName, expected string) Predicate {
-	return func(claims map[string]interface{}) bool {
+	return func(claims map[string]interface{}, _ Request) bool {
 		claim, ok := resolve(claimName, claims)
 		if !ok {
 			return false
@@ -70,7 +90,7 @@ func equals(claimName, expected string) Predicate {
 }
 
 func prefix(claimName, expected string) Predicate {
-	return func(claims map[string]interface{}) bool {
+	return func(claims map[string]interface{}, _ Request) bool {
 		claim, ok := resolve(claimName, claims)
 		if !ok {
 			return false
@@ -86,7 +106,7 @@ func prefix(claimName, expected string) Predicate {
 }
 
 func contains(claimName, expected string) Predicate {
-	return func(claims map[string]interface{}) bool {
+	return func(claims map[string]interface{}, _ Request) bool {
 		claim, ok := resolve(claimName, claims)
 		if !ok {
 			return false
@@ -111,7 +131,7 @@ func contains(claimName, expected string) Predicate {
 }
 
 func splitContains(claimName, sep, expected string) Predicate {
-	return func(claims map[string]interface{}) bool {
+	return func(claims map[string]interface{}, _ Request) bool {
 		claim, ok := resolve(claimName, claims)
 		if !ok {
 			return false
@@ -133,7 +153,7 @@ func splitContains(claimName, sep, expected string) Predicate {
 }
 
 func ohubf(claimName string, expected ...string) Predicate {
-	return func(claims map[string]interface{}) bool {
+	return func(claims map[string]interface{}, _ Request) bool {
 		claim, ok := resolve(claimName, claims)
 		if !ok {
 			return false
@@ -162,6 +182,189 @@ func ohubf(claimName string, expected ...string) Predicate {
 	}
 }
 
+// compare returns a function building predicates comparing a numeric claim to the given number with cmp.
+func compare(cmp func(claim, expected float64) bool) func(claimName string, expected interface{}) (Predicate, error) {
+	return func(claimName string, expected interface{}) (Predicate, error) {
+		exp, err := toFloat(expected)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %v: %w", expected, err)
+		}
+
+		return func(claims map[string]interface{}, _ Request) bool {
+			claim, ok := resolve(claimName, claims)
+			if !ok {
+				return false
+			}
+
+			val, err := toFloat(claim)
+			if err != nil {
+				return false
+			}
+
+			return cmp(val, exp)
+		}, nil
+	}
+}
+
+// matchesRegexp returns a predicate checking the claim, or one of its values if it is an array, matches the given
+// regular expression. The expression must match the whole value.
+func matchesRegexp(claimName, expr string) (Predicate, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %w", expr, err)
+	}
+
+	return func(claims map[string]interface{}, _ Request) bool {
+		claim, ok := resolve(claimName, claims)
+		if !ok {
+			return false
+		}
+
+		for _, v := range values(claim) {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func exists(claimName string) Predicate {
+	return func(claims map[string]interface{}, _ Request) bool {
+		_, ok := lookup(claimName, claims)
+		return ok
+	}
+}
+
+func hasKey(claimName, key string) Predicate {
+	return func(claims map[string]interface{}, _ Request) bool {
+		claim, ok := lookup(claimName, claims)
+		if !ok {
+			return false
+		}
+
+		obj, ok := claim.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		_, ok = obj[key]
+		return ok
+	}
+}
+
+// intersects returns a predicate checking the claim holds at least one of the expected values.
+func intersects(claimName string, expected ...string) Predicate {
+	return func(claims map[string]interface{}, _ Request) bool {
+		claim, ok := resolve(claimName, claims)
+		if !ok {
+			return false
+		}
+
+		for _, v := range values(claim) {
+			for _, exp := range expected {
+				if v == exp {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// containsAll returns a predicate checking the claim holds all the expected values.
+func containsAll(claimName string, expected ...string) Predicate {
+	return func(claims map[string]interface{}, _ Request) bool {
+		claim, ok := resolve(claimName, claims)
+		if !ok {
+			return false
+		}
+
+		vals := make(map[string]struct{})
+		for _, v := range values(claim) {
+			vals[v] = struct{}{}
+		}
+
+		for _, exp := range expected {
+			if _, ok = vals[exp]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// before returns a predicate checking the numeric date claim is before the current time shifted by the given
+// offset. For instance, Before(`exp`, `24h`) checks the token expires in less than a day.
+func before(claimName, offset string) (Predicate, error) {
+	return relativeTime(claimName, offset, func(claim, ref time.Time) bool { return claim.Before(ref) })
+}
+
+// after returns a predicate checking the numeric date claim is after the current time shifted by the given offset.
+// For instance, After(`iat`, `-1h`) checks the token has been issued in the last hour.
+func after(claimName, offset string) (Predicate, error) {
+	return relativeTime(claimName, offset, func(claim, ref time.Time) bool { return claim.After(ref) })
+}
+
+func relativeTime(claimName, offset string, cmp func(claim, ref time.Time) bool) (Predicate, error) {
+	d, err := time.ParseDuration(offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q: %w", offset, err)
+	}
+
+	return func(claims map[string]interface{}, _ Request) bool {
+		claim, ok := resolve(claimName, claims)
+		if !ok {
+			return false
+		}
+
+		secs, err := toFloat(claim)
+		if err != nil {
+			return false
+		}
+
+		return cmp(time.Unix(0, int64(secs*float64(time.Second))), time.Now().Add(d))
+	}, nil
+}
+
+// toFloat converts the given claim value or expression argument to a number.
+func toFloat(v interface{}) (float64, error) {
+	switch val := v.(type) {
+	case json.Number:
+		return val.Float64()
+	case float64:
+		return val, nil
+	case int:
+		return float64(val), nil
+	case string:
+		return strconv.ParseFloat(val, 64)
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
+
+// values returns the string representations of the given claim value, or of its elements if it is an array.
+func values(claim interface{}) []string {
+	arr, ok := claim.([]interface{})
+	if !ok {
+		arr = []interface{}{claim}
+	}
+
+	var vals []string
+	for _, v := range arr {
+		switch val := v.(type) {
+		case string:
+			vals = append(vals, val)
+		case json.Number:
+			vals = append(vals, val.String())
+		case bool:
+			vals = append(vals, strconv.FormatBool(val))
+		}
+	}
+
+	return vals
+}
+
 func matches(v interface{}, expected string) bool {
 	switch val := v.(type) {
 	case string:
@@ -180,6 +383,20 @@ func matches(v interface{}, expected string) bool {
 
 // resolve fetches the value addressed by claimName in the given claims map. It handles nesting.
 func resolve(claimName string, claims map[string]interface{}) (interface{}, bool) {
+	v, ok := lookup(claimName, claims)
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok = v.(map[string]interface{}); ok {
+		return nil, false
+	}
+
+	return v, true
+}
+
+// lookup fetches the value addressed by claimName in the given claims map, which may be an object. It handles nesting.
+func lookup(claimName string, claims map[string]interface{}) (interface{}, bool) {
 	parts := split(claimName, '.')
 	v := claims
 
@@ -189,23 +406,16 @@ func resolve(claimName string, claims map[string]interface{}) (interface{}, bool
 			return nil, false
 		}
 
-		isLast := idx == len(parts)-1
-
-		switch val := got.(type) {
-		case map[string]interface{}:
-			if isLast {
-				return nil, false
-			}
-
-			v = val
-			continue
-		default:
-			if !isLast {
-				return nil, false
-			}
+		if idx == len(parts)-1 {
+			return got, true
+		}
 
-			return val, true
+		obj, ok := got.(map[string]interface{})
+		if !ok {
+			return nil, false
 		}
+
+		v = obj
 	}
 
 	return nil, false
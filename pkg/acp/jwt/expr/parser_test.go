@@ -3,7 +3,9 @@ package expr
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -196,6 +198,90 @@ func TestValidateCustomClaims(t *testing.T) {
 			expr:   "Equals(``, `bruce`)",
 			want:   false,
 		},
+		{
+			desc:   "numeric comparisons",
+			claims: `{"level":3,"score":4.5}`,
+			expr:   "GreaterOrEquals(`level`, 3) && GreaterThan(`score`, 4) && LessThan(`score`, 4.6) && LessOrEquals(`level`, `3`)",
+			want:   true,
+		},
+		{
+			desc:   "numeric comparison not matching",
+			claims: `{"level":2}`,
+			expr:   "GreaterOrEquals(`level`, 3)",
+			want:   false,
+		},
+		{
+			desc:   "numeric comparison on a non numeric claim",
+			claims: `{"level":"high"}`,
+			expr:   "GreaterOrEquals(`level`, 3)",
+			want:   false,
+		},
+		{
+			desc:   "regular expression",
+			claims: `{"email":"john@corp.com"}`,
+			expr:   "Matches(`email`, `.*@corp\\.com`)",
+			want:   true,
+		},
+		{
+			desc:   "regular expression must match the whole value",
+			claims: `{"email":"john@corp.com.evil.com"}`,
+			expr:   "Matches(`email`, `.*@corp\\.com`)",
+			want:   false,
+		},
+		{
+			desc:   "regular expression on array claim",
+			claims: `{"groups":["dev","ops-admin"]}`,
+			expr:   "Matches(`groups`, `.*-admin`)",
+			want:   true,
+		},
+		{
+			desc:   "exists",
+			claims: `{"user":{"name":"john"}}`,
+			expr:   "Exists(`user`) && Exists(`user.name`) && !Exists(`user.email`)",
+			want:   true,
+		},
+		{
+			desc:   "has key",
+			claims: `{"user":{"name":"john"}}`,
+			expr:   "HasKey(`user`, `name`) && !HasKey(`user`, `email`) && !HasKey(`user.name`, `first`)",
+			want:   true,
+		},
+		{
+			desc:   "intersects",
+			claims: `{"groups":["dev","ops"]}`,
+			expr:   "Intersects(`groups`, `admin`, `ops`)",
+			want:   true,
+		},
+		{
+			desc:   "intersects not matching",
+			claims: `{"groups":["dev","ops"]}`,
+			expr:   "Intersects(`groups`, `admin`, `security`)",
+			want:   false,
+		},
+		{
+			desc:   "contains all",
+			claims: `{"groups":["dev","ops","admin"]}`,
+			expr:   "ContainsAll(`groups`, `admin`, `ops`) && !ContainsAll(`groups`, `admin`, `security`)",
+			want:   true,
+		},
+		{
+			desc:   "issued in the last hour",
+			claims: fmt.Sprintf(`{"iat":%d}`, time.Now().Add(-30*time.Minute).Unix()),
+			expr:   "After(`iat`, `-1h`)",
+			want:   true,
+		},
+		{
+			desc:   "not issued in the last hour",
+			claims: fmt.Sprintf(`{"iat":%d}`, time.Now().Add(-2*time.Hour).Unix()),
+			expr:   "After(`iat`, `-1h`)",
+			want:   false,
+		},
+		{
+			desc:   "expires in less than a day",
+			claims: fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix()),
+			expr:   "Before(`exp`, `24h`) && !Before(`exp`, `30m`)",
+			want:   true,
+		},
 	}
 	for _, test := range tests {
 		test := test
@@ -211,7 +297,41 @@ func TestValidateCustomClaims(t *testing.T) {
 			err = dec.Decode(&claims)
 			require.NoError(t, err)
 
-			assert.Equal(t, test.want, pred(claims))
+			assert.Equal(t, test.want, pred(claims, Request{}))
+		})
+	}
+}
+
+func TestParse_invalidExpression(t *testing.T) {
+	tests := []struct {
+		desc string
+		expr string
+	}{
+		{
+			desc: "unknown function",
+			expr: "Unknown(`grp`, `admin`)",
+		},
+		{
+			desc: "invalid regular expression",
+			expr: "Matches(`email`, `(`)",
+		},
+		{
+			desc: "invalid number",
+			expr: "GreaterThan(`level`, `high`)",
+		},
+		{
+			desc: "invalid duration",
+			expr: "After(`iat`, `an hour`)",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(test.expr)
+			assert.Error(t, err)
 		})
 	}
 }
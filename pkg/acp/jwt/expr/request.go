@@ -0,0 +1,75 @@
+package expr
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Request holds the information about the request being authorized which expressions can rely on.
+type Request struct {
+	Method string
+	Host   string
+	Path   string
+}
+
+// NewRequest returns the information about the request being authorized from the given forward auth request, using the
+// X-Forwarded-Method, X-Forwarded-Host and X-Forwarded-Uri headers set by Traefik.
+func NewRequest(req *http.Request) Request {
+	r := Request{
+		Method: req.Header.Get("X-Forwarded-Method"),
+		Host:   req.Header.Get("X-Forwarded-Host"),
+	}
+
+	if uri := req.Header.Get("X-Forwarded-Uri"); uri != "" {
+		if u, err := url.ParseRequestURI(uri); err == nil {
+			r.Path = u.Path
+		}
+	}
+
+	return r
+}
+
+func method(methods ...string) Predicate {
+	return func(_ map[string]interface{}, req Request) bool {
+		for _, m := range methods {
+			if strings.EqualFold(req.Method, m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func host(hosts ...string) Predicate {
+	return func(_ map[string]interface{}, req Request) bool {
+		for _, h := range hosts {
+			if strings.EqualFold(req.Host, h) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func path(paths ...string) Predicate {
+	return func(_ map[string]interface{}, req Request) bool {
+		for _, p := range paths {
+			if req.Path == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func pathPrefix(prefixes ...string) Predicate {
+	return func(_ map[string]interface{}, req Request) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(req.Path, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
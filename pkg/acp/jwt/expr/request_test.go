@@ -0,0 +1,77 @@
+package expr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+	req.Header.Set("X-Forwarded-Method", http.MethodPost)
+	req.Header.Set("X-Forwarded-Host", "api.example.com")
+	req.Header.Set("X-Forwarded-Uri", "/admin/users?page=2")
+
+	assert.Equal(t, Request{Method: http.MethodPost, Host: "api.example.com", Path: "/admin/users"}, NewRequest(req))
+}
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		desc string
+		req  Request
+		expr string
+		want bool
+	}{
+		{
+			desc: "method",
+			req:  Request{Method: http.MethodPost},
+			expr: "Method(`GET`, `post`)",
+			want: true,
+		},
+		{
+			desc: "method not matching",
+			req:  Request{Method: http.MethodDelete},
+			expr: "Method(`GET`, `POST`)",
+			want: false,
+		},
+		{
+			desc: "host",
+			req:  Request{Host: "api.example.com"},
+			expr: "Host(`API.example.com`)",
+			want: true,
+		},
+		{
+			desc: "path",
+			req:  Request{Path: "/admin"},
+			expr: "Path(`/admin`) && !Path(`/admin/`)",
+			want: true,
+		},
+		{
+			desc: "path prefix",
+			req:  Request{Path: "/admin/users"},
+			expr: "PathPrefix(`/public/`, `/admin/`)",
+			want: true,
+		},
+		{
+			desc: "request and claims",
+			req:  Request{Method: http.MethodPost, Path: "/admin/users"},
+			expr: "Method(`POST`) && PathPrefix(`/admin/`) && Equals(`grp`, `admin`)",
+			want: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			pred, err := Parse(test.expr)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.want, pred(map[string]interface{}{"grp": "admin"}, test.req))
+		})
+	}
+}
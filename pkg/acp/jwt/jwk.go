@@ -20,6 +20,7 @@ package jwt
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -28,6 +29,10 @@ import (
 	"time"
 
 	"github.com/pquerna/cachecontrol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/discovery"
 	"gopkg.in/square/go-jose.v2"
 )
 
@@ -156,31 +161,87 @@ func (k *FileKeySet) updateKeySet() error {
 	return nil
 }
 
-// RemoteKeySet resolves a key set based on a key set URL, and keeps it up to date.
+var (
+	jwksFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hub_agent",
+		Subsystem: "acp",
+		Name:      "jwks_fetches_total",
+		Help:      "Number of fetches of remote JWK sets, by ACP.",
+	}, []string{"policy", "result"})
+
+	jwksLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "hub_agent",
+		Subsystem: "acp",
+		Name:      "jwks_last_success_timestamp_seconds",
+		Help:      "Time of the last successful fetch of remote JWK sets, by ACP. The age of a key set is the current time minus this value.",
+	}, []string{"policy"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hub_agent",
+		Subsystem: "acp",
+		Name:      "jwt_cache_lookups_total",
+		Help:      "Number of lookups of the token validation cache, by ACP and result (hit or miss).",
+	}, []string{"policy", "result"})
+)
+
+// minRefetchInterval is the minimum time between two fetches of a remote key set triggered by unknown key IDs, or
+// following a failed fetch. It prevents tokens with unknown key IDs from flooding the key server.
+const minRefetchInterval = 10 * time.Second
+
+// RemoteKeySet resolves a key set based on a key set URL, and keeps it up to date. Keys are refreshed in the background
+// before they expire, and refetched when an unknown key is requested as it may have been rotated. If a refresh fails,
+// the previous keys are used until a refresh succeeds.
 type RemoteKeySet struct {
+	// policy is the name of the ACP the key set is used by. Fetches are reported in metrics under this name rather than
+	// the key set URL, which can be derived from the unverified issuer of tokens.
+	policy string
+	// issuer is set when the key set URL is discovered from the OpenID provider metadata of the issuer.
+	issuer string
+	client *http.Client
+
+	mu  sync.RWMutex
 	url string
+	// keys are refreshed in the background after refreshAt, and before being used after expiry.
+	keys      jose.JSONWebKeySet
+	refreshAt time.Time
+	expiry    time.Time
+	// lastFetch is the time of the last attempt to fetch the keys, and fetchErr its error, if any.
+	lastFetch time.Time
+	fetchErr  error
+	// lastRefetch is the time keys were last refetched because of an unknown key ID.
+	lastRefetch time.Time
+	updating    *inflight
+}
 
-	mu       sync.RWMutex
-	keys     jose.JSONWebKeySet
-	expiry   time.Time
-	updating *inflight
-	client   *http.Client
+// NewRemoteKeySet returns a RemoteKeySet used by the given ACP.
+func NewRemoteKeySet(policy, url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		policy: policy,
+		url:    url,
+		client: newKeySetClient(),
+	}
 }
 
-// NewRemoteKeySet returns a RemoteKeySet.
-func NewRemoteKeySet(url string) *RemoteKeySet {
+// NewDiscoveryKeySet returns a RemoteKeySet fetching keys from the JWKs URL advertised by the OpenID provider metadata
+// of the given issuer, used by the given ACP.
+func NewDiscoveryKeySet(policy, issuer string) *RemoteKeySet {
 	return &RemoteKeySet{
-		url: url,
-		client: &http.Client{
-			Transport: &http.Transport{
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).DialContext,
-				TLSHandshakeTimeout: 10 * time.Second,
-			},
-			Timeout: 5 * time.Second,
+		policy: policy,
+		issuer: issuer,
+		client: newKeySetClient(),
+	}
+}
+
+func newKeySetClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
 		},
+		Timeout: 5 * time.Second,
 	}
 }
 
@@ -190,52 +251,160 @@ func (s *RemoteKeySet) Key(ctx context.Context, keyID string) (*jose.JSONWebKey,
 		return nil, err
 	}
 
+	if key := s.key(keyID); key != nil {
+		return key, nil
+	}
+
+	// The key may have been rotated since the keys were fetched.
+	s.mu.Lock()
+	if time.Since(s.lastRefetch) < minRefetchInterval {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	s.lastRefetch = time.Now()
+	updating := s.fetch()
+	s.mu.Unlock()
+
+	if err := updating.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.key(keyID), nil
+}
+
+func (s *RemoteKeySet) key(keyID string) *jose.JSONWebKey {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	keys := s.keys.Key(keyID)
 	if len(keys) == 0 {
-		return nil, nil
+		return nil
 	}
-	return &keys[0], nil
+	return &keys[0]
 }
 
 func (s *RemoteKeySet) updateKeySet(ctx context.Context) error {
-	if !s.isExpired() {
+	now := time.Now()
+
+	s.mu.RLock()
+	fresh := now.Before(s.refreshAt)
+	s.mu.RUnlock()
+
+	if fresh {
 		return nil
 	}
 
 	s.mu.Lock()
-	if s.updating == nil {
-		s.updating = newInflight()
 
-		go func() {
-			keySet, expiry, err := fetchKeys(ctx, s.client, s.url)
+	hasKeys := !s.expiry.IsZero()
+	canFetch := s.fetchErr == nil || now.Sub(s.lastFetch) >= minRefetchInterval
 
-			s.mu.Lock()
-			defer s.mu.Unlock()
+	switch {
+	case now.Before(s.refreshAt):
+		s.mu.Unlock()
+		return nil
 
-			if err == nil {
-				s.keys = *keySet
-				s.expiry = expiry
-			}
+	case now.Before(s.expiry):
+		// Keys are about to expire: refresh them without making the request wait.
+		if canFetch {
+			s.fetch()
+		}
+		s.mu.Unlock()
+		return nil
+
+	case !canFetch:
+		err := s.fetchErr
+		s.mu.Unlock()
 
-			s.updating.Done(err)
-			s.updating = nil
-		}()
+		if hasKeys {
+			return nil
+		}
+		return err
 	}
 
-	updating := s.updating
+	updating := s.fetch()
 	s.mu.Unlock()
 
-	return updating.Wait(ctx)
+	if err := updating.Wait(ctx); err != nil && !hasKeys {
+		return err
+	}
+
+	return nil
 }
 
-func (s *RemoteKeySet) isExpired() bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// fetch fetches the keys, unless they are already being fetched, and returns the inflight fetch.
+// It must be called with the lock held.
+func (s *RemoteKeySet) fetch() *inflight {
+	if s.updating != nil {
+		return s.updating
+	}
+
+	s.updating = newInflight()
+	url := s.url
+
+	go func() {
+		// The fetch is not bound to the request which triggered it, as its result is shared with other requests.
+		ctx := context.Background()
+
+		var (
+			keySet *jose.JSONWebKeySet
+			expiry time.Time
+			err    error
+		)
+		if url == "" {
+			url, err = discoverJWKsURL(ctx, s.client, s.issuer)
+		}
+		if err == nil {
+			keySet, expiry, err = fetchKeys(ctx, s.client, url)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		now := time.Now()
+		s.lastFetch = now
+		s.fetchErr = err
+
+		if err != nil {
+			jwksFetches.WithLabelValues(s.policy, "failure").Inc()
+
+			if s.issuer != "" {
+				// The JWKs URL advertised by the issuer may have changed.
+				s.url = ""
+			}
+
+			if !s.expiry.IsZero() {
+				log.Warn().Err(err).Str("url", url).Msg("Unable to refresh JWK set, using previous keys")
+			}
+		} else {
+			jwksFetches.WithLabelValues(s.policy, "success").Inc()
+			jwksLastSuccess.WithLabelValues(s.policy).Set(float64(now.Unix()))
+
+			s.url = url
+			s.keys = *keySet
+			s.expiry = expiry
+			s.refreshAt = now.Add(expiry.Sub(now) * 3 / 4)
+		}
+
+		s.updating.Done(err)
+		s.updating = nil
+	}()
+
+	return s.updating
+}
+
+// discoverJWKsURL returns the JWKs URL advertised by the OpenID provider metadata of the given issuer.
+func discoverJWKsURL(ctx context.Context, client *http.Client, issuer string) (string, error) {
+	md, err := discovery.Discover(ctx, client, issuer)
+	if err != nil {
+		return "", err
+	}
+
+	if md.JWKsURL == "" {
+		return "", errors.New("no JWKs URL in provider metadata")
+	}
 
-	return time.Now().After(s.expiry)
+	return md.JWKsURL, nil
 }
 
 func fetchKeys(ctx context.Context, client *http.Client, url string) (*jose.JSONWebKeySet, time.Time, error) {
@@ -19,11 +19,17 @@ package jwt_test
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
@@ -108,7 +114,7 @@ func TestRemoteKeySet_KeysFetchesKeySet(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(hdlr))
 	defer srv.Close()
 
-	ks := jwt.NewRemoteKeySet(srv.URL)
+	ks := jwt.NewRemoteKeySet("my-policy", srv.URL)
 
 	gotFooKey, err := ks.Key(context.Background(), "foo-key")
 	require.NoError(t, err)
@@ -136,7 +142,7 @@ func TestRemoteKeySet_KeysFetchesKeySetWithoutCache(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(hdlr))
 	defer srv.Close()
 
-	ks := jwt.NewRemoteKeySet(srv.URL)
+	ks := jwt.NewRemoteKeySet("my-policy", srv.URL)
 
 	gotFooKey, err := ks.Key(context.Background(), "foo-key")
 	require.NoError(t, err)
@@ -158,7 +164,7 @@ func TestRemoteKeySet_KeysReturnsNilWhenKeyIsUnknown(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(hdlr))
 	defer srv.Close()
 
-	ks := jwt.NewRemoteKeySet(srv.URL)
+	ks := jwt.NewRemoteKeySet("my-policy", srv.URL)
 
 	gotKey, err := ks.Key(context.Background(), "meh-key")
 	require.NoError(t, err)
@@ -166,6 +172,197 @@ func TestRemoteKeySet_KeysReturnsNilWhenKeyIsUnknown(t *testing.T) {
 	assert.Nil(t, gotKey)
 }
 
+func TestRemoteKeySet_KeysRefreshesKeySetInBackground(t *testing.T) {
+	var hdlrCalled int32
+	release := make(chan struct{})
+	hdlr := func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&hdlrCalled, 1) > 1 {
+			<-release
+		}
+
+		rw.Header().Add("Cache-Control", "max-age=1")
+		_, _ = rw.Write([]byte(jwkeys))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(hdlr))
+	defer srv.Close()
+	defer close(release)
+
+	ks := jwt.NewRemoteKeySet("my-policy", srv.URL)
+
+	_, err := ks.Key(context.Background(), "foo-key")
+	require.NoError(t, err)
+
+	// Keys are about to expire: they are refreshed in the background while the current ones are used.
+	time.Sleep(800 * time.Millisecond)
+
+	gotKey, err := ks.Key(context.Background(), "foo-key")
+	require.NoError(t, err)
+	assert.NotNil(t, gotKey)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&hdlrCalled) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRemoteKeySet_KeysUsesPreviousKeysWhenRefreshFails(t *testing.T) {
+	var hdlrCalled int32
+	hdlr := func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&hdlrCalled, 1) > 1 {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = rw.Write([]byte(jwkeys))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(hdlr))
+	defer srv.Close()
+
+	ks := jwt.NewRemoteKeySet("my-refresh-policy", srv.URL)
+
+	_, err := ks.Key(context.Background(), "foo-key")
+	require.NoError(t, err)
+
+	// Keys expired right away as the server doesn't provide cache control headers.
+	gotKey, err := ks.Key(context.Background(), "bar-key")
+	require.NoError(t, err)
+	assert.NotNil(t, gotKey)
+
+	// The failed refresh is not retried right away.
+	gotKey, err = ks.Key(context.Background(), "foo-key")
+	require.NoError(t, err)
+	assert.NotNil(t, gotKey)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hdlrCalled))
+
+	assert.Equal(t, float64(1), jwksFetches(t, "my-refresh-policy", "success"))
+	assert.Equal(t, float64(1), jwksFetches(t, "my-refresh-policy", "failure"))
+}
+
+func TestRemoteKeySet_KeysRefetchesKeySetWhenKeyIsUnknown(t *testing.T) {
+	var keys jose.JSONWebKeySet
+	err := json.Unmarshal([]byte(jwkeys), &keys)
+	require.NoError(t, err)
+
+	rotated, err := json.Marshal(jose.JSONWebKeySet{Keys: keys.Key("foo-key")})
+	require.NoError(t, err)
+
+	var hdlrCalled int32
+	hdlr := func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Add("Cache-Control", "max-age=600")
+
+		if atomic.AddInt32(&hdlrCalled, 1) == 1 {
+			_, _ = rw.Write(rotated)
+			return
+		}
+		_, _ = rw.Write([]byte(jwkeys))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(hdlr))
+	defer srv.Close()
+
+	ks := jwt.NewRemoteKeySet("my-policy", srv.URL)
+
+	gotKey, err := ks.Key(context.Background(), "bar-key")
+	require.NoError(t, err)
+	assert.Equal(t, keys.Key("bar-key")[0], *gotKey)
+
+	// Key set was just refetched, it is not refetched again right away.
+	gotKey, err = ks.Key(context.Background(), "meh-key")
+	require.NoError(t, err)
+	assert.Nil(t, gotKey)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hdlrCalled))
+}
+
+func TestDiscoveryKeySet_Key(t *testing.T) {
+	var wantKeys jose.JSONWebKeySet
+	err := json.Unmarshal([]byte(jwkeys), &wantKeys)
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc    string
+		issuer  func(srvURL string) string
+		wantErr bool
+	}{
+		{
+			desc:   "discovers key set",
+			issuer: func(srvURL string) string { return srvURL },
+		},
+		{
+			desc:    "issuer mismatch",
+			issuer:  func(srvURL string) string { return "https://issuer.example.com" },
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			mux := http.NewServeMux()
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, req *http.Request) {
+				_ = json.NewEncoder(rw).Encode(map[string]string{
+					"issuer":   test.issuer(srv.URL),
+					"jwks_uri": srv.URL + "/keys",
+				})
+			})
+			mux.HandleFunc("/keys", func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Add("Cache-Control", "max-age=600")
+				_, _ = rw.Write([]byte(jwkeys))
+			})
+
+			ks := jwt.NewDiscoveryKeySet("my-policy", srv.URL)
+
+			gotKey, err := ks.Key(context.Background(), "foo-key")
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, wantKeys.Key("foo-key")[0], *gotKey)
+		})
+	}
+}
+
+func TestHandler_dynamicKeySetMetrics(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	h, err := jwt.NewHandler(&jwt.Config{JWKsURL: "/jwks"}, "my-dynamic-policy", nil, nil)
+	require.NoError(t, err)
+
+	// Key sets are fetched from the issuers of the tokens, which must not end up in metric labels.
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_ = json.NewEncoder(rw).Encode(jose.JSONWebKeySet{
+				Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "kid", Algorithm: "RS256"}},
+			})
+		}))
+		t.Cleanup(srv.Close)
+
+		tok := gojwt.NewWithClaims(gojwt.SigningMethodRS256, gojwt.MapClaims{"iss": srv.URL})
+		tok.Header["kid"] = "kid"
+		rawTok, err := tok.SignedString(key)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-dynamic-policy", nil)
+		req.Header.Set("Authorization", "Bearer "+rawTok)
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+
+		require.Equal(t, http.StatusOK, rw.Code)
+	}
+
+	assert.Equal(t, float64(2), jwksFetches(t, "my-dynamic-policy", "success"))
+}
+
 const jwkeys = `
 {
   "keys": [
@@ -188,3 +385,30 @@ const jwkeys = `
   ]
 }
 `
+
+// jwksFetches returns the number of fetches of the JWK sets of the given ACP with the given result reported by metrics.
+func jwksFetches(t *testing.T, policy, result string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "hub_agent_acp_jwks_fetches_total" {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			if labels["policy"] == policy && labels["result"] == result {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
@@ -28,11 +28,22 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	jwtreq "github.com/golang-jwt/jwt/v4/request"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/audit"
 	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt/expr"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/tokencache"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// defaultCacheTTL is how long token validations are cached for at most, unless configured otherwise.
+	defaultCacheTTL = time.Minute
+	// maxCacheEntries is the number of token validations above which the least recently used ones are evicted.
+	maxCacheEntries = 10000
 )
 
 // Config configures a JWT ACP handler.
@@ -40,12 +51,83 @@ type Config struct {
 	SigningSecret              string
 	SigningSecretBase64Encoded bool
 	PublicKey                  string
-	JWKsFile                   FileOrContent
-	JWKsURL                    string
-	StripAuthorizationHeader   bool
-	ForwardHeaders             map[string]string
-	TokenQueryKey              string
-	Claims                     string
+	// SigningSecretRef and PublicKeyRef reference the Secret keys holding the signing secret and public key, instead of
+	// setting them inline. SigningSecretBase64Encoded only applies to an inline signing secret.
+	SigningSecretRef         *SecretKeyRef
+	PublicKeyRef             *SecretKeyRef
+	JWKsFile                 FileOrContent
+	JWKsURL                  string
+	StripAuthorizationHeader bool
+	ForwardHeaders           map[string]string
+	TokenQueryKey            string
+	Claims                   string
+	// TokenSources is the ordered list of the places tokens are looked for in requests. Defaults to the Authorization
+	// header with the "Bearer " prefix, then the query parameter named after TokenQueryKey.
+	TokenSources []TokenSource
+	// Issuer is the issuer of the tokens. Unless a JWKs file or URL is given, the signing keys are fetched from the JWKs
+	// URL advertised by its OpenID provider metadata. Tokens must be issued by it, unless Issuers is set.
+	Issuer string
+	// Issuers and Audiences restrict the accepted tokens to the ones whose "iss" claim is one of the issuers and "aud"
+	// claim holds one of the audiences.
+	Issuers   []string
+	Audiences []string
+	// Leeway is the clock skew tolerated when validating the "exp", "nbf" and "iat" claims.
+	Leeway time.Duration
+	// RequiredClaims is a list of claims which must be present in the tokens.
+	RequiredClaims []string
+	// Algorithms restricts the signing algorithms accepted, all supported ones are accepted if empty.
+	Algorithms []string
+	// CacheTTL is how long token validations are cached for at most. They are never cached past the token expiration.
+	// Defaults to one minute, a negative value disables the cache.
+	CacheTTL time.Duration
+	// Rules is an ordered list of authorization rules. When set, a request is authorized by the first rule matching
+	// it, and denied if none does.
+	Rules []Rule
+	// Deny configures the response sent when a request is denied.
+	Deny *DenyConfig
+	// Revocation configures the revocation of tokens before they expire.
+	Revocation *RevocationConfig
+}
+
+// Types of token sources.
+const (
+	TokenSourceHeader = "header"
+	TokenSourceCookie = "cookie"
+	// TokenSourceQuery reads tokens from a query parameter. Such tokens are not stripped from the request forwarded to
+	// the service: the forwardAuth middleware can only copy headers from the ACP response, it cannot rewrite the
+	// upstream URL.
+	TokenSourceQuery = "query"
+)
+
+// TokenSource is a place tokens are looked for in requests.
+type TokenSource struct {
+	// Type is the type of the source: header, cookie or query.
+	Type string
+	// Name is the name of the header, cookie or query parameter holding the token.
+	Name string
+	// Prefix is the prefix a header value must start with, which is trimmed from the token. It is matched case
+	// insensitively, like authentication schemes are.
+	Prefix string
+}
+
+// SecretKeyRef references a key of a Secret.
+type SecretKeyRef struct {
+	Name string
+	Key  string
+}
+
+// Rule authorizes the requests it matches based on their token claims.
+type Rule struct {
+	// Match is an expression selecting the requests the rule applies to. It applies to all requests if empty.
+	Match string
+	// Claims is an expression the claims must match for the request to be authorized. Any valid token is accepted if
+	// empty.
+	Claims string
+}
+
+type rule struct {
+	match  expr.Predicate
+	claims expr.Predicate
 }
 
 // Handler is a JWT ACP Handler.
@@ -54,7 +136,8 @@ type Handler struct {
 
 	signingSecret string
 	pubKey        interface{}
-	tokQryKey     string
+	tokenSources  []TokenSource
+	algorithms    []string
 
 	// Either `keySet` or `dynKeySets` should be set at a time.
 	// If `jwksURL` is a complete URL, `keySet` is used.
@@ -67,13 +150,41 @@ type Handler struct {
 	stripAuthorization bool
 	fwdHeaders         map[string]string
 
+	claims               claimsValidator
 	validateCustomClaims expr.Predicate
+	rules                []rule
+
+	denier denier
+
+	revocation *revocation
+
+	cache    *tokencache.Cache
+	cacheTTL time.Duration
 }
 
-// NewHandler returns a new JWT ACP Handler.
-func NewHandler(cfg *Config, polName string) (*Handler, error) {
-	if cfg.PublicKey == "" && cfg.SigningSecret == "" && cfg.JWKsFile == "" && cfg.JWKsURL == "" {
-		return nil, errors.New("at least a signing secret, public key or a JWKs file or URL is required")
+// NewHandler returns a new JWT ACP Handler. The signing secret and public key references, and the revocation list are
+// resolved from the given Secrets and ConfigMaps.
+func NewHandler(cfg *Config, polName string, secrets map[string]*corev1.Secret, configMaps map[string]*corev1.ConfigMap) (*Handler, error) {
+	if cfg.SigningSecret != "" && cfg.SigningSecretRef != nil {
+		return nil, errors.New("signing secret and signing secret reference are mutually exclusive")
+	}
+	if cfg.PublicKey != "" && cfg.PublicKeyRef != nil {
+		return nil, errors.New("public key and public key reference are mutually exclusive")
+	}
+
+	if cfg.PublicKey == "" && cfg.PublicKeyRef == nil && cfg.SigningSecret == "" && cfg.SigningSecretRef == nil &&
+		cfg.JWKsFile == "" && cfg.JWKsURL == "" && cfg.Issuer == "" {
+		return nil, errors.New("at least a signing secret, public key, JWKs file or URL, or issuer is required")
+	}
+
+	if cfg.Leeway < 0 {
+		return nil, errors.New("leeway must be positive")
+	}
+
+	for _, alg := range cfg.Algorithms {
+		if !isSupportedAlgorithm(alg) {
+			return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
 	}
 
 	var (
@@ -87,6 +198,34 @@ func NewHandler(cfg *Config, polName string) (*Handler, error) {
 		}
 	}
 
+	rules, err := parseRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDenier(cfg.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	var rev *revocation
+	if cfg.Revocation != nil {
+		rev, err = newRevocation(cfg.Revocation, secrets, configMaps)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var c *tokencache.Cache
+	cacheTTL := cfg.CacheTTL
+	switch {
+	case cacheTTL == 0:
+		cacheTTL = defaultCacheTTL
+		c = tokencache.New(maxCacheEntries, time.Now)
+	case cacheTTL > 0:
+		c = tokencache.New(maxCacheEntries, time.Now)
+	}
+
 	signingSecret := cfg.SigningSecret
 	if cfg.SigningSecretBase64Encoded {
 		var b []byte
@@ -96,10 +235,24 @@ func NewHandler(cfg *Config, polName string) (*Handler, error) {
 		}
 		signingSecret = string(b)
 	}
+	if cfg.SigningSecretRef != nil {
+		signingSecret, err = SecretValue(cfg.SigningSecretRef, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("signing secret: %w", err)
+		}
+	}
+
+	publicKey := cfg.PublicKey
+	if cfg.PublicKeyRef != nil {
+		publicKey, err = SecretValue(cfg.PublicKeyRef, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("public key: %w", err)
+		}
+	}
 
 	var pubKey interface{}
-	if cfg.PublicKey != "" {
-		block, _ := pem.Decode([]byte(cfg.PublicKey))
+	if publicKey != "" {
+		block, _ := pem.Decode([]byte(publicKey))
 		if block == nil {
 			return nil, errors.New("empty or ill-formatted public key")
 		}
@@ -110,16 +263,21 @@ func NewHandler(cfg *Config, polName string) (*Handler, error) {
 		}
 	}
 
-	tokenQueryKey := "jwt"
-	if cfg.TokenQueryKey != "" {
-		tokenQueryKey = cfg.TokenQueryKey
+	tokenSources, err := parseTokenSources(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	ks, err := keySet(cfg)
+	ks, err := keySet(cfg, polName)
 	if err != nil {
 		return nil, err
 	}
 
+	issuers := cfg.Issuers
+	if len(issuers) == 0 && cfg.Issuer != "" {
+		issuers = []string{cfg.Issuer}
+	}
+
 	return &Handler{
 		name:                 polName,
 		signingSecret:        signingSecret,
@@ -129,12 +287,40 @@ func NewHandler(cfg *Config, polName string) (*Handler, error) {
 		dynKeySets:           make(map[string]*RemoteKeySet),
 		stripAuthorization:   cfg.StripAuthorizationHeader,
 		fwdHeaders:           cfg.ForwardHeaders,
-		tokQryKey:            tokenQueryKey,
+		tokenSources:         tokenSources,
 		validateCustomClaims: pred,
+		algorithms:           cfg.Algorithms,
+		rules:                rules,
+		denier:               d,
+		revocation:           rev,
+		cache:                c,
+		cacheTTL:             cacheTTL,
+		claims: claimsValidator{
+			issuers:        issuers,
+			audiences:      cfg.Audiences,
+			leeway:         cfg.Leeway,
+			requiredClaims: cfg.RequiredClaims,
+			now:            time.Now,
+		},
 	}, nil
 }
 
-func keySet(src *Config) (KeySet, error) {
+// SecretValue returns the value of the Secret key the given reference points to, found in the given Secrets.
+func SecretValue(ref *SecretKeyRef, secrets map[string]*corev1.Secret) (string, error) {
+	secret := secrets[ref.Name]
+	if secret == nil {
+		return "", fmt.Errorf("secret %q not found", ref.Name)
+	}
+
+	value := secret.Data[ref.Key]
+	if len(value) == 0 {
+		return "", fmt.Errorf("no value found under %q in secret %q", ref.Key, ref.Name)
+	}
+
+	return string(value), nil
+}
+
+func keySet(src *Config, polName string) (KeySet, error) {
 	if src.JWKsFile != "" {
 		if src.JWKsFile.IsPath() {
 			return NewFileKeySet(src.JWKsFile.String()), nil
@@ -148,7 +334,11 @@ func keySet(src *Config) (KeySet, error) {
 	}
 
 	if src.JWKsURL != "" && !strings.HasPrefix(src.JWKsURL, "/") {
-		return NewRemoteKeySet(src.JWKsURL), nil
+		return NewRemoteKeySet(polName, src.JWKsURL), nil
+	}
+
+	if src.JWKsURL == "" && src.Issuer != "" {
+		return NewDiscoveryKeySet(polName, src.Issuer), nil
 	}
 
 	return nil, nil
@@ -157,36 +347,81 @@ func keySet(src *Config) (KeySet, error) {
 func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	l := log.With().Str("handler_type", "JWT").Str("handler_name", h.name).Logger()
 
-	extractor := jwtExtractor{tokQryKey: h.tokQryKey}
-	p := &jwt.Parser{UseJSONNumber: true}
-	tok, err := jwtreq.ParseFromRequest(req, extractor, h.keyFunc(req.Context()), jwtreq.WithParser(p))
+	rawTok, err := jwtExtractor{sources: h.tokenSources}.ExtractToken(req)
 	if err != nil {
-		var jwtErr *jwt.ValidationError
-		if errors.As(err, &jwtErr) && jwtErr.Errors&jwt.ValidationErrorUnverifiable != 0 {
-			l.Error().Err(err).Msg("Unable to verify the signing key")
+		l.Error().Err(err).Msg("Unable to parse JWT")
+		h.denier.deny(l, rw, req, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	var v validation
+	if h.cache != nil {
+		if cached, ok := h.cache.Get(rawTok); ok {
+			cacheLookups.WithLabelValues(h.name, "hit").Inc()
+			v = cached.(validation)
 		} else {
-			l.Error().Err(err).Msg("Unable to parse JWT")
+			cacheLookups.WithLabelValues(h.name, "miss").Inc()
+
+			var cacheUntil time.Time
+			v, cacheUntil = h.validate(req.Context(), l, rawTok)
+			if !cacheUntil.IsZero() {
+				h.cache.Set(rawTok, v, cacheUntil)
+			}
 		}
+	} else {
+		v, _ = h.validate(req.Context(), l, rawTok)
+	}
 
-		rw.WriteHeader(http.StatusUnauthorized)
+	switch v.statusCode {
+	case 0:
+	case http.StatusInternalServerError:
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
+	case http.StatusUnauthorized:
+		h.denier.deny(l, rw, req, v.statusCode, errInvalidToken, v.errDescription)
+		return
+	default:
+		h.denier.deny(l, rw, req, v.statusCode, errInsufficientScope, v.errDescription)
+		return
+	}
+
+	if sub, ok := v.claims["sub"].(string); ok {
+		audit.SetSubject(req.Context(), sub)
+	}
+
+	// Tokens can be revoked while their validation is cached, so revocation is checked on every request.
+	if h.revocation != nil {
+		revoked, err := h.revocation.revoked(req.Context(), v.claims)
+		if err != nil {
+			l.Error().Err(err).Msg("Unable to check whether the token has been revoked")
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		if revoked {
+			l.Debug().Msg("Token has been revoked")
+			h.denier.deny(l, rw, req, http.StatusUnauthorized, errInvalidToken, "token has been revoked")
+			return
+		}
 	}
 
+	// Custom claims and rules may depend on the request, so they are evaluated on every request.
+	r := expr.NewRequest(req)
+
 	if h.validateCustomClaims != nil {
-		if !h.validateCustomClaims(tok.Claims.(jwt.MapClaims)) {
-			rw.WriteHeader(http.StatusForbidden)
+		if !h.validateCustomClaims(v.claims, r) {
+			h.denier.deny(l, rw, req, http.StatusForbidden, errInsufficientScope, "token claims do not grant access")
 			return
 		}
 	}
 
-	hdrs, err := expr.PluckClaims(h.fwdHeaders, tok.Claims.(jwt.MapClaims))
-	if err != nil {
-		l.Error().Err(err).Msg("Unable to set forwarded header")
-		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if len(h.rules) > 0 && !h.authorizeRules(v.claims, r) {
+		l.Debug().Str("method", r.Method).Str("path", r.Path).Msg("Request not authorized by any rule")
+		h.denier.deny(l, rw, req, http.StatusForbidden, errInsufficientScope, "token claims do not grant access")
 		return
 	}
 
-	for name, vals := range hdrs {
+	for name, vals := range v.headers {
 		for _, val := range vals {
 			rw.Header().Add(name, val)
 		}
@@ -199,24 +434,219 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	rw.WriteHeader(http.StatusOK)
 }
 
+// validation is the outcome of the validation of a token, regardless of the request being authorized.
+type validation struct {
+	// statusCode is the status code of the response to send if the token is rejected, zero otherwise.
+	statusCode int
+	// errDescription describes why the token is rejected.
+	errDescription string
+	claims         jwt.MapClaims
+	headers        map[string][]string
+}
+
+// validate validates the given token and computes the headers to forward. The validation can be cached until the
+// returned time, unless it is zero.
+func (h *Handler) validate(ctx context.Context, l zerolog.Logger, rawTok string) (validation, time.Time) {
+	// Registered time claims are validated below, to take the leeway into account.
+	p := &jwt.Parser{UseJSONNumber: true, SkipClaimsValidation: true, ValidMethods: h.algorithms}
+	tok, err := p.Parse(rawTok, h.keyFunc(ctx))
+	if err != nil {
+		var jwtErr *jwt.ValidationError
+		if errors.As(err, &jwtErr) && jwtErr.Errors&jwt.ValidationErrorUnverifiable != 0 {
+			l.Error().Err(err).Msg("Unable to verify the signing key")
+		} else {
+			l.Error().Err(err).Msg("Unable to parse JWT")
+		}
+
+		return validation{statusCode: http.StatusUnauthorized, errDescription: describeParseError(err)}, time.Time{}
+	}
+
+	claims := tok.Claims.(jwt.MapClaims)
+
+	if err = h.claims.validateTime(claims); err != nil {
+		l.Debug().Err(err).Msg("Invalid JWT")
+		return validation{statusCode: http.StatusUnauthorized, errDescription: err.Error()}, time.Time{}
+	}
+
+	// The token is valid now, the validation can be cached until it expires.
+	cacheUntil := h.claims.now().Add(h.cacheTTL)
+	if exp, ok, _ := numericDate(claims, "exp"); ok && exp.Add(h.claims.leeway).Before(cacheUntil) {
+		cacheUntil = exp.Add(h.claims.leeway)
+	}
+
+	if err = h.claims.validateClaims(claims); err != nil {
+		l.Debug().Err(err).Msg("JWT claims not matching")
+		return validation{statusCode: http.StatusForbidden, errDescription: err.Error()}, cacheUntil
+	}
+
+	hdrs, err := expr.PluckClaims(h.fwdHeaders, claims)
+	if err != nil {
+		l.Error().Err(err).Msg("Unable to set forwarded header")
+		return validation{statusCode: http.StatusInternalServerError}, time.Time{}
+	}
+
+	return validation{claims: claims, headers: hdrs}, cacheUntil
+}
+
+// describeParseError returns a description of the given token parsing error which can be sent to clients.
+func describeParseError(err error) string {
+	var jwtErr *jwt.ValidationError
+	if !errors.As(err, &jwtErr) {
+		return "invalid token"
+	}
+
+	switch {
+	case jwtErr.Errors&jwt.ValidationErrorMalformed != 0:
+		return "malformed token"
+	case jwtErr.Errors&jwt.ValidationErrorUnverifiable != 0:
+		return "token signature cannot be verified"
+	case jwtErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return "invalid token signature"
+	default:
+		return "invalid token"
+	}
+}
+
+// authorizeRules returns whether the first rule matching the request authorizes it.
+func (h *Handler) authorizeRules(claims map[string]interface{}, req expr.Request) bool {
+	for _, r := range h.rules {
+		if r.match != nil && !r.match(claims, req) {
+			continue
+		}
+
+		return r.claims == nil || r.claims(claims, req)
+	}
+
+	return false
+}
+
+func parseRules(cfgs []Rule) ([]rule, error) {
+	rules := make([]rule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		var (
+			r   rule
+			err error
+		)
+		if cfg.Match != "" {
+			r.match, err = expr.Parse(cfg.Match)
+			if err != nil {
+				return nil, fmt.Errorf("parse match expression of rule %d: %w", i, err)
+			}
+		}
+
+		if cfg.Claims != "" {
+			r.claims, err = expr.Parse(cfg.Claims)
+			if err != nil {
+				return nil, fmt.Errorf("parse claims expression of rule %d: %w", i, err)
+			}
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// isSupportedAlgorithm returns whether the given signing algorithm is supported.
+func isSupportedAlgorithm(alg string) bool {
+	switch alg {
+	case "HS256", "HS384", "HS512",
+		"RS256", "RS384", "RS512",
+		"PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+		"EdDSA":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseTokenSources returns the token sources of the given configuration, or the default ones if none is configured.
+func parseTokenSources(cfg *Config) ([]TokenSource, error) {
+	if len(cfg.TokenSources) == 0 {
+		tokenQueryKey := "jwt"
+		if cfg.TokenQueryKey != "" {
+			tokenQueryKey = cfg.TokenQueryKey
+		}
+
+		return []TokenSource{
+			{Type: TokenSourceHeader, Name: "Authorization", Prefix: "Bearer "},
+			{Type: TokenSourceQuery, Name: tokenQueryKey},
+		}, nil
+	}
+
+	for _, src := range cfg.TokenSources {
+		switch src.Type {
+		case TokenSourceHeader, TokenSourceCookie, TokenSourceQuery:
+		default:
+			return nil, fmt.Errorf("unknown token source type %q", src.Type)
+		}
+
+		if src.Name == "" {
+			return nil, fmt.Errorf("a name is required for %s token sources", src.Type)
+		}
+
+		if src.Prefix != "" && src.Type != TokenSourceHeader {
+			return nil, fmt.Errorf("prefix is only supported by header token sources, not %s ones", src.Type)
+		}
+	}
+
+	return cfg.TokenSources, nil
+}
+
 // jwtExtractor extracts JWTs from HTTP requests.
 type jwtExtractor struct {
-	tokQryKey string
+	sources []TokenSource
 }
 
-// ExtractToken extracts a JWT from an HTTP request. It first looks in the "Authorization" header then in a query parameter
-// named as configured by `tokQryKey`. It returns an error if no JWT was found.
+// ExtractToken extracts a JWT from an HTTP request. It looks in each of its sources in order, and returns the first
+// token found. It returns an error if no JWT was found.
 func (j jwtExtractor) ExtractToken(req *http.Request) (string, error) {
-	rawJWT := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
-	if rawJWT == "" {
-		rawJWT = req.URL.Query().Get(j.tokQryKey)
+	for _, src := range j.sources {
+		if rawJWT := extractFromSource(req, src); rawJWT != "" {
+			return rawJWT, nil
+		}
+	}
+
+	return "", errors.New("no JWT found in request")
+}
+
+func extractFromSource(req *http.Request, src TokenSource) string {
+	switch src.Type {
+	case TokenSourceHeader:
+		value := req.Header.Get(src.Name)
+		if len(value) < len(src.Prefix) || !strings.EqualFold(value[:len(src.Prefix)], src.Prefix) {
+			return ""
+		}
+
+		return value[len(src.Prefix):]
+
+	case TokenSourceCookie:
+		cookie, err := req.Cookie(src.Name)
+		if err != nil {
+			return ""
+		}
+
+		return cookie.Value
+
+	case TokenSourceQuery:
+		return queryParam(req, src.Name)
+
+	default:
+		return ""
 	}
+}
 
-	if rawJWT == "" {
-		return "", errors.New("no JWT found in request")
+// queryParam returns the value of the given query parameter of the authenticated request. It reads it from the
+// X-Forwarded-Uri header set by Traefik, and falls back to the request URL.
+func queryParam(req *http.Request, name string) string {
+	if uri := req.Header.Get("X-Forwarded-Uri"); uri != "" {
+		if u, err := url.ParseRequestURI(uri); err == nil {
+			return u.Query().Get(name)
+		}
 	}
 
-	return rawJWT, nil
+	return req.URL.Query().Get(name)
 }
 
 // keyFunc returns a function to find the correct key to validate its given JWT's signature.
@@ -230,7 +660,7 @@ func (h *Handler) keyFunc(ctx context.Context) jwt.Keyfunc {
 		kid, _ := tok.Header["kid"].(string)
 
 		switch prefix {
-		case "RS", "ES":
+		case "RS", "PS", "ES", "Ed":
 			if kid != "" {
 				return h.resolveKey(ctx, tok, kid)
 			}
@@ -283,6 +713,11 @@ func (h *Handler) resolveKey(ctx context.Context, tok *jwt.Token, kid string) (k
 	if k == nil {
 		return nil, fmt.Errorf("no key with id %q found", kid)
 	}
+
+	if k.Algorithm != "" && k.Algorithm != tok.Method.Alg() {
+		return nil, fmt.Errorf("key %q cannot be used with signing algorithm %q", kid, tok.Method.Alg())
+	}
+
 	return k.Key, nil
 }
 
@@ -310,7 +745,7 @@ func (h *Handler) remoteKeySet(iss string) (*RemoteKeySet, error) {
 	h.dynKeySetsMu.Lock()
 	rks = h.dynKeySets[ksURL]
 	if rks == nil {
-		rks = NewRemoteKeySet(ksURL)
+		rks = NewRemoteKeySet(h.name, ksURL)
 		h.dynKeySets[ksURL] = rks
 	}
 	h.dynKeySetsMu.Unlock()
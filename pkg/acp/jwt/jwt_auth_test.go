@@ -19,8 +19,13 @@ package jwt
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -31,6 +36,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/square/go-jose.v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -84,11 +91,141 @@ func TestNew(t *testing.T) {
 			jwtCfg:  Config{JWKsURL: "http://example.com"},
 			wantErr: assert.NoError,
 		},
+		{
+			name:    "issuer",
+			jwtCfg:  Config{Issuer: "https://issuer.example.com"},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "supported algorithms",
+			jwtCfg:  Config{PublicKey: validPubKey, Algorithms: []string{"RS256", "PS256", "ES256", "EdDSA"}},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "invalid rule",
+			jwtCfg:  Config{SigningSecret: "foobar", Rules: []Rule{{Match: "Unknown()"}}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "unsupported algorithm",
+			jwtCfg:  Config{PublicKey: validPubKey, Algorithms: []string{"none"}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "invalid deny status code",
+			jwtCfg:  Config{SigningSecret: "foobar", Deny: &DenyConfig{StatusCode: http.StatusOK}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "relative deny redirect URL",
+			jwtCfg:  Config{SigningSecret: "foobar", Deny: &DenyConfig{RedirectURL: "/login"}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "invalid deny body template",
+			jwtCfg:  Config{SigningSecret: "foobar", Deny: &DenyConfig{Body: "{{ .Error"}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "unknown token source type",
+			jwtCfg:  Config{SigningSecret: "foobar", TokenSources: []TokenSource{{Type: "body", Name: "token"}}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "token source without name",
+			jwtCfg:  Config{SigningSecret: "foobar", TokenSources: []TokenSource{{Type: TokenSourceCookie}}},
+			wantErr: assert.Error,
+		},
+		{
+			name: "prefixed cookie token source",
+			jwtCfg: Config{
+				SigningSecret: "foobar",
+				TokenSources:  []TokenSource{{Type: TokenSourceCookie, Name: "token", Prefix: "Bearer "}},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "negative leeway",
+			jwtCfg:  Config{SigningSecret: "foobar", Leeway: -time.Second},
+			wantErr: assert.Error,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			_, err := NewHandler(&test.jwtCfg, "acp@my-ns")
+			_, err := NewHandler(&test.jwtCfg, "acp@my-ns", nil, nil)
+
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestNew_secretRefs(t *testing.T) {
+	secrets := map[string]*corev1.Secret{
+		"my-keys": {
+			ObjectMeta: metav1.ObjectMeta{Name: "my-keys"},
+			Data: map[string][]byte{
+				"signing-secret": []byte("foobar"),
+				"public-key":     []byte(validPubKey),
+				"invalid-key":    []byte(invalidPubKey),
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		jwtCfg  Config
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "signing secret reference",
+			jwtCfg:  Config{SigningSecretRef: &SecretKeyRef{Name: "my-keys", Key: "signing-secret"}},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "public key reference",
+			jwtCfg:  Config{PublicKeyRef: &SecretKeyRef{Name: "my-keys", Key: "public-key"}},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "reference to an invalid public key",
+			jwtCfg:  Config{PublicKeyRef: &SecretKeyRef{Name: "my-keys", Key: "invalid-key"}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "unknown secret",
+			jwtCfg:  Config{SigningSecretRef: &SecretKeyRef{Name: "unknown", Key: "signing-secret"}},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "unknown secret key",
+			jwtCfg:  Config{SigningSecretRef: &SecretKeyRef{Name: "my-keys", Key: "unknown"}},
+			wantErr: assert.Error,
+		},
+		{
+			name: "signing secret and signing secret reference",
+			jwtCfg: Config{
+				SigningSecret:    "foobar",
+				SigningSecretRef: &SecretKeyRef{Name: "my-keys", Key: "signing-secret"},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "public key and public key reference",
+			jwtCfg: Config{
+				PublicKey:    validPubKey,
+				PublicKeyRef: &SecretKeyRef{Name: "my-keys", Key: "public-key"},
+			},
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&test.jwtCfg, "acp@my-ns", secrets, nil)
 
 			test.wantErr(t, err)
 		})
@@ -109,6 +246,7 @@ func TestServeHTTP(t *testing.T) {
 			jwtCfg:         Config{SigningSecret: "bibi"},
 			token:          "",
 			wantStatusCode: http.StatusUnauthorized,
+			wantHeader:     http.Header{"Www-Authenticate": []string{`Bearer`}},
 		},
 		{
 			name:           "token is valid",
@@ -121,6 +259,7 @@ func TestServeHTTP(t *testing.T) {
 			jwtCfg:         Config{SigningSecret: "bibi"},
 			token:          expiredJWT,
 			wantStatusCode: http.StatusUnauthorized,
+			wantHeader:     http.Header{"Www-Authenticate": []string{`Bearer error="invalid_token", error_description="token is expired"`}},
 		},
 		{
 			name: "token is not for required group",
@@ -130,6 +269,7 @@ func TestServeHTTP(t *testing.T) {
 			},
 			token:          missingGroupJWT,
 			wantStatusCode: http.StatusForbidden,
+			wantHeader:     http.Header{"Www-Authenticate": []string{`Bearer error="insufficient_scope", error_description="token claims do not grant access"`}},
 		},
 		{
 			name: "claims not equal",
@@ -148,6 +288,7 @@ func TestServeHTTP(t *testing.T) {
 			},
 			token:          validJWTWithNestedClaim,
 			wantStatusCode: http.StatusForbidden,
+			wantHeader:     http.Header{"Www-Authenticate": []string{`Bearer error="insufficient_scope", error_description="token claims do not grant access"`}},
 		},
 		{
 			name: "group header is forwarded",
@@ -164,6 +305,7 @@ func TestServeHTTP(t *testing.T) {
 			jwtCfg:         Config{JWKsURL: "/.well-known/jwks.json"},
 			token:          validJWT,
 			wantStatusCode: http.StatusUnauthorized,
+			wantHeader:     http.Header{"Www-Authenticate": []string{`Bearer error="invalid_token", error_description="token signature cannot be verified"`}},
 		},
 		{
 			name: "nested header is forwarded (and header is canonicalized)",
@@ -182,7 +324,7 @@ func TestServeHTTP(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			middleware, err := NewHandler(&test.jwtCfg, "acp@my-ns")
+			middleware, err := NewHandler(&test.jwtCfg, "acp@my-ns", nil, nil)
 			require.NoError(t, err)
 
 			rec := httptest.NewRecorder()
@@ -212,15 +354,204 @@ func TestServeHTTP(t *testing.T) {
 	}
 }
 
+func TestServeHTTP_signingAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPubKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaPEM := publicKeyPEM(t, &rsaKey.PublicKey)
+	edPEM := publicKeyPEM(t, edPubKey)
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &rsaKey.PublicKey, KeyID: "rsa", Algorithm: "PS256"},
+		{Key: edPubKey, KeyID: "ed"},
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		jwtCfg         Config
+		method         jwt.SigningMethod
+		kid            string
+		key            interface{}
+		wantStatusCode int
+	}{
+		{
+			name:           "PS256 with public key",
+			jwtCfg:         Config{PublicKey: rsaPEM},
+			method:         jwt.SigningMethodPS256,
+			key:            rsaKey,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "EdDSA with public key",
+			jwtCfg:         Config{PublicKey: edPEM},
+			method:         jwt.SigningMethodEdDSA,
+			key:            edKey,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "PS256 with JWK",
+			jwtCfg:         Config{JWKsFile: FileOrContent(jwks)},
+			method:         jwt.SigningMethodPS256,
+			kid:            "rsa",
+			key:            rsaKey,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "EdDSA with JWK",
+			jwtCfg:         Config{JWKsFile: FileOrContent(jwks)},
+			method:         jwt.SigningMethodEdDSA,
+			kid:            "ed",
+			key:            edKey,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "JWK algorithm not matching",
+			jwtCfg:         Config{JWKsFile: FileOrContent(jwks)},
+			method:         jwt.SigningMethodRS256,
+			kid:            "rsa",
+			key:            rsaKey,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "allowed algorithm",
+			jwtCfg:         Config{PublicKey: edPEM, SigningSecret: "secret", Algorithms: []string{"EdDSA"}},
+			method:         jwt.SigningMethodEdDSA,
+			key:            edKey,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "algorithm not allowed",
+			jwtCfg:         Config{PublicKey: edPEM, SigningSecret: "secret", Algorithms: []string{"EdDSA"}},
+			method:         jwt.SigningMethodHS256,
+			key:            []byte("secret"),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHandler(&test.jwtCfg, "acp@my-ns", nil, nil)
+			require.NoError(t, err)
+
+			tok := jwt.NewWithClaims(test.method, jwt.MapClaims{"sub": "john"})
+			if test.kid != "" {
+				tok.Header["kid"] = test.kid
+			}
+			signed, err := tok.SignedString(test.key)
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+signed)
+
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.wantStatusCode, rec.Code)
+		})
+	}
+}
+
+func publicKeyPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestServeHTTP_rules(t *testing.T) {
+	rules := []Rule{
+		{Match: "Method(`POST`, `PUT`, `DELETE`) && PathPrefix(`/admin/`)", Claims: "Equals(`grp`, `admin`)"},
+		{Match: "PathPrefix(`/admin/`)"},
+	}
+
+	tests := []struct {
+		desc           string
+		rules          []Rule
+		method         string
+		uri            string
+		claims         jwt.MapClaims
+		wantStatusCode int
+	}{
+		{
+			desc:           "write request authorized by first rule",
+			rules:          rules,
+			method:         http.MethodPost,
+			uri:            "/admin/users",
+			claims:         jwt.MapClaims{"grp": "admin"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "write request denied by first rule",
+			rules:          rules,
+			method:         http.MethodPost,
+			uri:            "/admin/users",
+			claims:         jwt.MapClaims{"grp": "dev"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc:           "read request authorized by second rule",
+			rules:          rules,
+			method:         http.MethodGet,
+			uri:            "/admin/users?page=2",
+			claims:         jwt.MapClaims{"grp": "dev"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "request not matching any rule",
+			rules:          rules,
+			method:         http.MethodGet,
+			uri:            "/public",
+			claims:         jwt.MapClaims{"grp": "admin"},
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHandler(&Config{SigningSecret: "secret", Rules: test.rules}, "my-policy", nil, nil)
+			require.NoError(t, err)
+
+			tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, test.claims).SignedString([]byte("secret"))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			req.Header.Set("Authorization", "Bearer "+tok)
+			req.Header.Set("X-Forwarded-Method", test.method)
+			req.Header.Set("X-Forwarded-Uri", test.uri)
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+		})
+	}
+}
+
 func TestExtractJWT(t *testing.T) {
+	defaultSources, err := parseTokenSources(&Config{TokenQueryKey: "customkey"})
+	require.NoError(t, err)
+
 	tests := []struct {
 		name    string
+		sources []TokenSource
 		req     *http.Request
 		wantJWT string
 		wantErr assert.ErrorAssertionFunc
 	}{
 		{
-			name: "JWT is found in Authorization header",
+			name:    "JWT is found in Authorization header",
+			sources: defaultSources,
 			req: &http.Request{
 				Header: http.Header{
 					"Authorization": []string{"Bearer J.W.T"},
@@ -230,7 +561,8 @@ func TestExtractJWT(t *testing.T) {
 			wantErr: assert.NoError,
 		},
 		{
-			name: "JWT is found in query parameter",
+			name:    "JWT is found in query parameter",
+			sources: defaultSources,
 			req: &http.Request{
 				URL: &url.URL{
 					RawQuery: url.Values{
@@ -242,12 +574,97 @@ func TestExtractJWT(t *testing.T) {
 			wantErr: assert.NoError,
 		},
 		{
-			name: "JWT is found nowhere",
+			name:    "JWT is found in forwarded URI query parameter",
+			sources: defaultSources,
+			req: &http.Request{
+				Header: http.Header{
+					"X-Forwarded-Uri": []string{"/path?customkey=J.W.T"},
+				},
+				URL: &url.URL{},
+			},
+			wantJWT: "J.W.T",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "JWT is found nowhere",
+			sources: defaultSources,
 			req: &http.Request{
 				URL: &url.URL{},
 			},
 			wantErr: assert.Error,
 		},
+		{
+			name:    "JWT is found in custom header",
+			sources: []TokenSource{{Type: TokenSourceHeader, Name: "X-Auth-Token"}},
+			req: &http.Request{
+				Header: http.Header{
+					"X-Auth-Token": []string{"J.W.T"},
+				},
+			},
+			wantJWT: "J.W.T",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "header prefix is matched case insensitively",
+			sources: []TokenSource{{Type: TokenSourceHeader, Name: "Authorization", Prefix: "Bearer "}},
+			req: &http.Request{
+				Header: http.Header{
+					"Authorization": []string{"bearer J.W.T"},
+				},
+			},
+			wantJWT: "J.W.T",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "header without the prefix is ignored",
+			sources: []TokenSource{{Type: TokenSourceHeader, Name: "Authorization", Prefix: "Bearer "}},
+			req: &http.Request{
+				Header: http.Header{
+					"Authorization": []string{"Basic Zm9vOmJhcg=="},
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "JWT is found in cookie",
+			sources: []TokenSource{{Type: TokenSourceCookie, Name: "access_token"}},
+			req: &http.Request{
+				Header: http.Header{
+					"Cookie": []string{"session=foo; access_token=J.W.T"},
+				},
+			},
+			wantJWT: "J.W.T",
+			wantErr: assert.NoError,
+		},
+		{
+			name: "sources are looked in order",
+			sources: []TokenSource{
+				{Type: TokenSourceCookie, Name: "access_token"},
+				{Type: TokenSourceHeader, Name: "X-Auth-Token"},
+			},
+			req: &http.Request{
+				Header: http.Header{
+					"Cookie":       []string{"access_token=J.W.T"},
+					"X-Auth-Token": []string{"O.T.H"},
+				},
+			},
+			wantJWT: "J.W.T",
+			wantErr: assert.NoError,
+		},
+		{
+			name: "next source is looked in when a source holds no token",
+			sources: []TokenSource{
+				{Type: TokenSourceCookie, Name: "access_token"},
+				{Type: TokenSourceHeader, Name: "X-Auth-Token"},
+			},
+			req: &http.Request{
+				Header: http.Header{
+					"X-Auth-Token": []string{"J.W.T"},
+				},
+			},
+			wantJWT: "J.W.T",
+			wantErr: assert.NoError,
+		},
 	}
 
 	for _, test := range tests {
@@ -256,7 +673,7 @@ func TestExtractJWT(t *testing.T) {
 			t.Parallel()
 
 			subj := jwtExtractor{
-				tokQryKey: "customkey",
+				sources: test.sources,
 			}
 			tok, err := subj.ExtractToken(test.req)
 			test.wantErr(t, err)
@@ -292,7 +709,7 @@ func TestKeyFunc(t *testing.T) {
 		{
 			name:    "unsupported signing algorithm",
 			handler: &Handler{},
-			tok:     &jwt.Token{Method: jwt.SigningMethodPS512},
+			tok:     &jwt.Token{Method: jwt.SigningMethodNone},
 			wantErr: assert.Error,
 		},
 		{
@@ -314,7 +731,8 @@ func TestKeyFunc(t *testing.T) {
 			name: "jwks key found",
 			handler: &Handler{
 				keySet: &RemoteKeySet{
-					expiry: time.Now().Add(60 * time.Second),
+					refreshAt: time.Now().Add(45 * time.Second),
+					expiry:    time.Now().Add(60 * time.Second),
 					keys: jose.JSONWebKeySet{
 						Keys: []jose.JSONWebKey{
 							{
@@ -333,7 +751,9 @@ func TestKeyFunc(t *testing.T) {
 			name: "jwks key not found",
 			handler: &Handler{
 				keySet: &RemoteKeySet{
-					expiry: time.Now().Add(60 * time.Second),
+					refreshAt:   time.Now().Add(45 * time.Second),
+					expiry:      time.Now().Add(60 * time.Second),
+					lastRefetch: time.Now(),
 					keys: jose.JSONWebKeySet{
 						Keys: []jose.JSONWebKey{},
 					},
@@ -443,7 +863,7 @@ func Test_JWTAuthNew(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			_, err := NewHandler(&test.static, "acp@my-ns")
+			_, err := NewHandler(&test.static, "acp@my-ns", nil, nil)
 			test.wantErr(t, err)
 		})
 	}
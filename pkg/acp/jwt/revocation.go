@@ -0,0 +1,337 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package jwt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RevocationListKey is the key of the ConfigMap or Secret data entry holding the revocation list. A revocation list
+// holds one revoked token per line: either "jti <id>", revoking the token with the given ID, or
+// "sub <subject> <time>", revoking the tokens of the given subject issued before the given RFC 3339 time. Empty lines
+// and lines starting with "#" are ignored.
+const RevocationListKey = "revocations"
+
+const defaultRevocationRefreshInterval = time.Minute
+
+var errRevocationListNotFetched = errors.New("revocation list not fetched yet")
+
+// maxRevocationListSize is the maximum size of a remote revocation list.
+const maxRevocationListSize = 10 << 20
+
+// RevocationConfig configures the revocation of tokens before they expire.
+type RevocationConfig struct {
+	// ConfigMap and Secret are the names of a ConfigMap or a Secret holding a revocation list under the "revocations"
+	// key.
+	ConfigMap string
+	Secret    string
+	// URL is the URL of a remote revocation list, in the same format. It is refreshed every RefreshInterval, one minute
+	// by default. Requests are denied until it has been fetched once.
+	URL             string
+	RefreshInterval time.Duration
+}
+
+// revocation checks tokens against the revocation lists of a policy.
+type revocation struct {
+	static *revocationList
+	remote *remoteRevocationList
+}
+
+func newRevocation(cfg *RevocationConfig, secrets map[string]*corev1.Secret, configMaps map[string]*corev1.ConfigMap) (*revocation, error) {
+	if cfg.ConfigMap == "" && cfg.Secret == "" && cfg.URL == "" {
+		return nil, errors.New("a revocation ConfigMap, Secret or URL is required")
+	}
+	if cfg.ConfigMap != "" && cfg.Secret != "" {
+		return nil, errors.New("revocation ConfigMap and Secret are mutually exclusive")
+	}
+	if cfg.RefreshInterval < 0 {
+		return nil, errors.New("revocation refresh interval must not be negative")
+	}
+
+	r := &revocation{static: &revocationList{}}
+
+	var err error
+	switch {
+	case cfg.ConfigMap != "":
+		configMap := configMaps[cfg.ConfigMap]
+		if configMap == nil {
+			return nil, fmt.Errorf("revocation ConfigMap %q not found", cfg.ConfigMap)
+		}
+
+		r.static, err = parseRevocationList(strings.NewReader(configMap.Data[RevocationListKey]))
+		if err != nil {
+			return nil, fmt.Errorf("parse revocation list of ConfigMap %q: %w", cfg.ConfigMap, err)
+		}
+
+	case cfg.Secret != "":
+		secret := secrets[cfg.Secret]
+		if secret == nil {
+			return nil, fmt.Errorf("revocation secret %q not found", cfg.Secret)
+		}
+
+		r.static, err = parseRevocationList(strings.NewReader(string(secret.Data[RevocationListKey])))
+		if err != nil {
+			return nil, fmt.Errorf("parse revocation list of secret %q: %w", cfg.Secret, err)
+		}
+	}
+
+	if cfg.URL != "" {
+		interval := cfg.RefreshInterval
+		if interval == 0 {
+			interval = defaultRevocationRefreshInterval
+		}
+
+		r.remote = newRemoteRevocationList(cfg.URL, interval)
+	}
+
+	return r, nil
+}
+
+// revoked returns whether the token with the given claims has been revoked. An error is returned if the remote
+// revocation list has never been fetched, as revoked tokens cannot be told apart then.
+func (r *revocation) revoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	if r.static.revoked(claims) {
+		return true, nil
+	}
+
+	if r.remote == nil {
+		return false, nil
+	}
+
+	list, err := r.remote.current(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return list.revoked(claims), nil
+}
+
+// revocationList is a parsed revocation list. It is never modified once parsed, so it can be shared.
+type revocationList struct {
+	jtis map[string]struct{}
+	// subjects holds, for each subject, the time before which its tokens are revoked.
+	subjects map[string]time.Time
+}
+
+func parseRevocationList(r io.Reader) (*revocationList, error) {
+	l := &revocationList{
+		jtis:     make(map[string]struct{}),
+		subjects: make(map[string]time.Time),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "jti" && len(fields) == 2:
+			l.jtis[fields[1]] = struct{}{}
+
+		case fields[0] == "sub" && len(fields) == 3:
+			issuedBefore, err := time.Parse(time.RFC3339, fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid time: %w", i, err)
+			}
+
+			if issuedBefore.After(l.subjects[fields[1]]) {
+				l.subjects[fields[1]] = issuedBefore
+			}
+
+		default:
+			return nil, fmt.Errorf("line %d: expected \"jti <id>\" or \"sub <subject> <time>\"", i)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read revocation list: %w", err)
+	}
+
+	return l, nil
+}
+
+// revoked returns whether the token with the given claims is revoked by the list. The tokens of a revoked subject
+// without an "iat" claim are revoked, as they may have been issued before the revocation.
+func (l *revocationList) revoked(claims jwt.MapClaims) bool {
+	if jti, ok := claims["jti"].(string); ok {
+		if _, ok = l.jtis[jti]; ok {
+			return true
+		}
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		return false
+	}
+
+	issuedBefore, ok := l.subjects[sub]
+	if !ok {
+		return false
+	}
+
+	iat, ok, err := numericDate(claims, "iat")
+	if err != nil || !ok {
+		return true
+	}
+
+	return iat.Before(issuedBefore)
+}
+
+// remoteRevocationList is a revocation list fetched from a URL. It is refreshed in the background once its refresh
+// interval is over, and the previous list is used until a refresh succeeds.
+type remoteRevocationList struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	// list holds the current *revocationList, replaced as a whole on refresh.
+	list atomic.Value
+
+	mu        sync.RWMutex
+	loaded    bool
+	refreshAt time.Time
+	updating  *inflight
+
+	now func() time.Time
+}
+
+func newRemoteRevocationList(url string, interval time.Duration) *remoteRevocationList {
+	l := &remoteRevocationList{
+		url:      url,
+		interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		now:      time.Now,
+	}
+	l.list.Store(&revocationList{})
+
+	return l
+}
+
+// current returns the current revocation list, triggering a refresh if it is due. Only the first fetch is waited for:
+// an error is returned until it succeeds.
+func (l *remoteRevocationList) current(ctx context.Context) (*revocationList, error) {
+	now := l.now()
+
+	l.mu.RLock()
+	fresh := now.Before(l.refreshAt)
+	loaded := l.loaded
+	l.mu.RUnlock()
+
+	if fresh {
+		if !loaded {
+			return nil, errRevocationListNotFetched
+		}
+		return l.list.Load().(*revocationList), nil
+	}
+
+	l.mu.Lock()
+	var updating *inflight
+	if !now.Before(l.refreshAt) {
+		updating = l.fetch()
+	}
+	loaded = l.loaded
+	l.mu.Unlock()
+
+	if loaded {
+		return l.list.Load().(*revocationList), nil
+	}
+
+	// The first fetch failed in the meantime, and is not retried yet.
+	if updating == nil {
+		return nil, errRevocationListNotFetched
+	}
+
+	if err := updating.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("fetch revocation list: %w", err)
+	}
+
+	return l.list.Load().(*revocationList), nil
+}
+
+// fetch fetches the list, unless it is already being fetched, and returns the inflight fetch.
+// It must be called with the lock held.
+func (l *remoteRevocationList) fetch() *inflight {
+	if l.updating != nil {
+		return l.updating
+	}
+
+	l.updating = newInflight()
+
+	go func() {
+		// The fetch is not bound to the request which triggered it, as its result is shared with other requests.
+		list, err := fetchRevocationList(context.Background(), l.client, l.url)
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		now := l.now()
+		if err != nil {
+			log.Error().Err(err).Str("url", l.url).Msg("Unable to refresh revocation list")
+
+			retryIn := minRefetchInterval
+			if l.interval < retryIn {
+				retryIn = l.interval
+			}
+			l.refreshAt = now.Add(retryIn)
+		} else {
+			l.list.Store(list)
+			l.loaded = true
+			l.refreshAt = now.Add(l.interval)
+		}
+
+		l.updating.Done(err)
+		l.updating = nil
+	}()
+
+	return l.updating
+}
+
+func fetchRevocationList(ctx context.Context, client *http.Client, url string) (*revocationList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("build revocation list request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch revocation list: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %q", resp.Status)
+	}
+
+	return parseRevocationList(io.LimitReader(resp.Body, maxRevocationListSize))
+}
@@ -0,0 +1,448 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseRevocationList(t *testing.T) {
+	tests := []struct {
+		desc    string
+		list    string
+		want    *revocationList
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			desc: "empty list",
+			want: &revocationList{
+				jtis:     map[string]struct{}{},
+				subjects: map[string]time.Time{},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			desc: "token IDs and subjects",
+			list: `# Leaked on 2022-05-01.
+jti 3f2a
+
+sub alice 2022-05-01T00:00:00Z
+sub alice 2022-06-01T00:00:00Z
+sub bob   2022-05-01T00:00:00Z
+`,
+			want: &revocationList{
+				jtis: map[string]struct{}{"3f2a": {}},
+				subjects: map[string]time.Time{
+					"alice": time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+					"bob":   time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			desc:    "invalid time",
+			list:    "sub alice yesterday",
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "subject without time",
+			list:    "sub alice",
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "unknown entry",
+			list:    "iss https://idp.example.com",
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseRevocationList(strings.NewReader(test.list))
+			test.wantErr(t, err)
+
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestRevocationList_revoked(t *testing.T) {
+	revokedAt := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	l := &revocationList{
+		jtis:     map[string]struct{}{"3f2a": {}},
+		subjects: map[string]time.Time{"alice": revokedAt},
+	}
+
+	tests := []struct {
+		desc   string
+		claims jwt.MapClaims
+		want   bool
+	}{
+		{
+			desc:   "revoked token ID",
+			claims: jwt.MapClaims{"jti": "3f2a", "sub": "bob"},
+			want:   true,
+		},
+		{
+			desc:   "other token ID",
+			claims: jwt.MapClaims{"jti": "4b3c", "sub": "bob"},
+		},
+		{
+			desc:   "revoked subject issued before the revocation",
+			claims: jwt.MapClaims{"sub": "alice", "iat": json.Number("1651359599")},
+			want:   true,
+		},
+		{
+			desc:   "revoked subject issued after the revocation",
+			claims: jwt.MapClaims{"sub": "alice", "iat": json.Number("1651363200")},
+		},
+		{
+			desc:   "revoked subject without issue time",
+			claims: jwt.MapClaims{"sub": "alice"},
+			want:   true,
+		},
+		{
+			desc:   "no token ID nor subject",
+			claims: jwt.MapClaims{"iat": json.Number("1651359599")},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, l.revoked(test.claims))
+		})
+	}
+}
+
+func TestNewRevocation(t *testing.T) {
+	configMaps := map[string]*corev1.ConfigMap{
+		"my-revocations": {
+			ObjectMeta: metav1.ObjectMeta{Name: "my-revocations"},
+			Data:       map[string]string{RevocationListKey: "jti 3f2a"},
+		},
+		"invalid-revocations": {
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid-revocations"},
+			Data:       map[string]string{RevocationListKey: "jti"},
+		},
+	}
+	secrets := map[string]*corev1.Secret{
+		"my-revocations": {
+			ObjectMeta: metav1.ObjectMeta{Name: "my-revocations"},
+			Data:       map[string][]byte{RevocationListKey: []byte("jti 3f2a")},
+		},
+	}
+
+	tests := []struct {
+		desc    string
+		cfg     RevocationConfig
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			desc:    "ConfigMap",
+			cfg:     RevocationConfig{ConfigMap: "my-revocations"},
+			wantErr: assert.NoError,
+		},
+		{
+			desc:    "Secret",
+			cfg:     RevocationConfig{Secret: "my-revocations"},
+			wantErr: assert.NoError,
+		},
+		{
+			desc:    "URL",
+			cfg:     RevocationConfig{URL: "https://idp.example.com/revocations"},
+			wantErr: assert.NoError,
+		},
+		{
+			desc:    "no source",
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "ConfigMap and Secret",
+			cfg:     RevocationConfig{ConfigMap: "my-revocations", Secret: "my-revocations"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "unknown ConfigMap",
+			cfg:     RevocationConfig{ConfigMap: "unknown"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "unknown Secret",
+			cfg:     RevocationConfig{Secret: "unknown"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "invalid list",
+			cfg:     RevocationConfig{ConfigMap: "invalid-revocations"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "negative refresh interval",
+			cfg:     RevocationConfig{URL: "https://idp.example.com/revocations", RefreshInterval: -time.Second},
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newRevocation(&test.cfg, secrets, configMaps)
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestRemoteRevocationList_current(t *testing.T) {
+	var (
+		list    atomic.Value
+		fetches int32
+	)
+	list.Store("jti 3f2a")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_, _ = rw.Write([]byte(list.Load().(string)))
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+	l := newRemoteRevocationList(srv.URL, time.Minute)
+	l.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	revoked := jwt.MapClaims{"jti": "3f2a"}
+
+	// The first fetch is waited for.
+	current, err := l.current(ctx)
+	require.NoError(t, err)
+	assert.True(t, current.revoked(revoked))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	list.Store("jti 4b3c")
+
+	now = now.Add(30 * time.Second)
+	current, err = l.current(ctx)
+	require.NoError(t, err)
+	assert.True(t, current.revoked(revoked))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// Further fetches happen in the background, the previous list being used meanwhile.
+	now = now.Add(time.Minute)
+	_, err = l.current(ctx)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		current, err = l.current(ctx)
+		return err == nil && !current.revoked(revoked)
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
+
+func TestRemoteRevocationList_current_keepsPreviousListOnError(t *testing.T) {
+	var failing int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = rw.Write([]byte("jti 3f2a"))
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+	l := newRemoteRevocationList(srv.URL, time.Minute)
+	l.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	revoked := jwt.MapClaims{"jti": "3f2a"}
+
+	current, err := l.current(ctx)
+	require.NoError(t, err)
+	require.True(t, current.revoked(revoked))
+
+	atomic.StoreInt32(&failing, 1)
+	now = now.Add(2 * time.Minute)
+
+	_, err = l.current(ctx)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+
+		return l.updating == nil
+	}, time.Second, 10*time.Millisecond)
+
+	current, err = l.current(ctx)
+	require.NoError(t, err)
+	assert.True(t, current.revoked(revoked))
+}
+
+func TestRemoteRevocationList_current_failsUntilFetched(t *testing.T) {
+	failing := int32(1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = rw.Write([]byte("jti 3f2a"))
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+	l := newRemoteRevocationList(srv.URL, time.Minute)
+	l.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	_, err := l.current(ctx)
+	assert.Error(t, err)
+
+	// The first fetch is not retried before the retry interval is over.
+	atomic.StoreInt32(&failing, 0)
+
+	_, err = l.current(ctx)
+	assert.Error(t, err)
+
+	now = now.Add(minRefetchInterval)
+
+	current, err := l.current(ctx)
+	require.NoError(t, err)
+	assert.True(t, current.revoked(jwt.MapClaims{"jti": "3f2a"}))
+}
+
+func TestRemoteRevocationList_current_contextDone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	l := newRemoteRevocationList(srv.URL, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := l.current(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestServeHTTP_revocation(t *testing.T) {
+	configMaps := map[string]*corev1.ConfigMap{
+		"my-revocations": {
+			ObjectMeta: metav1.ObjectMeta{Name: "my-revocations"},
+			Data:       map[string]string{RevocationListKey: "jti 3f2a\nsub alice 2022-05-01T00:00:00Z"},
+		},
+	}
+
+	h, err := NewHandler(&Config{
+		SigningSecret: "secret",
+		Revocation:    &RevocationConfig{ConfigMap: "my-revocations"},
+	}, "my-policy", nil, configMaps)
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc       string
+		claims     jwt.MapClaims
+		wantStatus int
+	}{
+		{
+			desc:       "revoked token ID",
+			claims:     jwt.MapClaims{"jti": "3f2a", "sub": "bob"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "revoked subject",
+			claims:     jwt.MapClaims{"sub": "alice", "iat": time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC).Unix()},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:       "token issued after the subject revocation",
+			claims:     jwt.MapClaims{"sub": "alice", "iat": time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC).Unix()},
+			wantStatus: http.StatusOK,
+		},
+		{
+			desc:       "token not revoked",
+			claims:     jwt.MapClaims{"jti": "4b3c", "sub": "bob"},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, test.claims).SignedString([]byte("secret"))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tok)
+			rw := httptest.NewRecorder()
+
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatus, rw.Code)
+		})
+	}
+}
+
+func TestServeHTTP_revocationListUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	h, err := NewHandler(&Config{
+		SigningSecret: "secret",
+		Revocation:    &RevocationConfig{URL: srv.URL},
+	}, "my-policy", nil, nil)
+	require.NoError(t, err)
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": "4b3c"}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	rw := httptest.NewRecorder()
+
+	h.ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+}
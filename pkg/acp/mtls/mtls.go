@@ -0,0 +1,286 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package mtls
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/audit"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CertHeader is the header in which Traefik forwards the client certificate when the passTLSClientCert middleware
+// is enabled with the pem option.
+const CertHeader = "X-Forwarded-Tls-Client-Cert"
+
+// SecretCAKey is the key of the Secret data entry holding the PEM-encoded CA bundle.
+const SecretCAKey = "ca.crt"
+
+// Identity fields which can be forwarded as headers.
+const (
+	FieldSubject      = "subject"
+	FieldCommonName   = "commonName"
+	FieldIssuer       = "issuer"
+	FieldSerialNumber = "serialNumber"
+	FieldFingerprint  = "fingerprint"
+	FieldSANs         = "sans"
+)
+
+// Config configures a client certificate ACP handler.
+// Routers using this ACP must request client certificates through their TLS options. The admission webhook chains a
+// passTLSClientCert middleware before the forwardAuth one, so Traefik replaces any certificate header sent by clients
+// with the certificate of the TLS connection.
+type Config struct {
+	// CASecret is the name of the Secret holding the CA bundle under the "ca.crt" key.
+	CASecret string
+	// Subjects, SANs and Fingerprints are the rules the certificate must match. When at least one rule is defined,
+	// the certificate is accepted if it matches any of them. A subject rule matches either the full subject
+	// distinguished name or its common name. A fingerprint is the hex-encoded SHA-256 of the certificate.
+	Subjects     []string
+	SANs         []string
+	Fingerprints []string
+	// ForwardHeaders maps header names to certificate identity fields.
+	ForwardHeaders map[string]string
+}
+
+// Handler is a client certificate ACP Handler.
+type Handler struct {
+	name string
+
+	roots *x509.CertPool
+
+	subjects     map[string]struct{}
+	sans         map[string]struct{}
+	fingerprints map[string]struct{}
+
+	fwdHeaders map[string]string
+}
+
+// NewHandler returns a new client certificate ACP Handler. The CA bundle is read from the given Secret.
+func NewHandler(cfg *Config, polName string, caSecret *corev1.Secret) (*Handler, error) {
+	if cfg.CASecret == "" {
+		return nil, errors.New("a CA secret is required")
+	}
+	if caSecret == nil {
+		return nil, fmt.Errorf("CA secret %q not found", cfg.CASecret)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caSecret.Data[SecretCAKey]) {
+		return nil, fmt.Errorf("no PEM-encoded certificate found under %q in CA secret %q", SecretCAKey, cfg.CASecret)
+	}
+
+	for header, field := range cfg.ForwardHeaders {
+		switch field {
+		case FieldSubject, FieldCommonName, FieldIssuer, FieldSerialNumber, FieldFingerprint, FieldSANs:
+		default:
+			return nil, fmt.Errorf("unsupported identity field %q for header %q", field, header)
+		}
+	}
+
+	fingerprints := make(map[string]struct{}, len(cfg.Fingerprints))
+	for _, fp := range cfg.Fingerprints {
+		fingerprints[normalizeFingerprint(fp)] = struct{}{}
+	}
+
+	return &Handler{
+		name:         polName,
+		roots:        roots,
+		subjects:     toSet(cfg.Subjects),
+		sans:         toSet(cfg.SANs),
+		fingerprints: fingerprints,
+		fwdHeaders:   cfg.ForwardHeaders,
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	l := log.With().Str("handler_type", "MTLS").Str("handler_name", h.name).Logger()
+
+	chain, err := parseCertHeader(req.Header.Get(CertHeader))
+	if err != nil {
+		l.Debug().Err(err).Msg("Unable to parse client certificate")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	cert := chain[0]
+	audit.SetSubject(req.Context(), cert.Subject.String())
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         h.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		l.Debug().Err(err).Msg("Invalid client certificate")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if !h.matches(cert) {
+		l.Debug().Str("subject", cert.Subject.String()).Msg("Client certificate does not match any rule")
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	for name, field := range h.fwdHeaders {
+		if val := identityField(cert, field); val != "" {
+			rw.Header().Set(name, val)
+		}
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// matches reports whether the certificate matches at least one of the subject, SAN or fingerprint rules. A
+// certificate always matches when no rule is defined.
+func (h *Handler) matches(cert *x509.Certificate) bool {
+	if len(h.subjects) == 0 && len(h.sans) == 0 && len(h.fingerprints) == 0 {
+		return true
+	}
+
+	if _, ok := h.subjects[cert.Subject.String()]; ok {
+		return true
+	}
+	if _, ok := h.subjects[cert.Subject.CommonName]; ok {
+		return true
+	}
+
+	for _, san := range sans(cert) {
+		if _, ok := h.sans[san]; ok {
+			return true
+		}
+	}
+
+	_, ok := h.fingerprints[fingerprint(cert)]
+	return ok
+}
+
+// parseCertHeader parses the certificate chain forwarded by Traefik. Traefik forwards a comma-separated list of
+// URL-escaped PEM certificates, stripped of their delimiters and line breaks. The leaf certificate comes first.
+func parseCertHeader(value string) ([]*x509.Certificate, error) {
+	if value == "" {
+		return nil, errors.New("no client certificate")
+	}
+
+	value, err := url.QueryUnescape(value)
+	if err != nil {
+		return nil, fmt.Errorf("unescape header: %w", err)
+	}
+
+	var chain []*x509.Certificate
+	for _, raw := range strings.Split(value, ",") {
+		der, err := decodeCert(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate: %w", err)
+		}
+
+		chain = append(chain, cert)
+	}
+
+	return chain, nil
+}
+
+// decodeCert returns the DER bytes of the given certificate, which may be either a full PEM block or its bare
+// base64-encoded content.
+func decodeCert(raw string) ([]byte, error) {
+	raw = strings.TrimSpace(raw)
+
+	if block, _ := pem.Decode([]byte(raw)); block != nil {
+		return block.Bytes, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode certificate: %w", err)
+	}
+
+	return der, nil
+}
+
+func identityField(cert *x509.Certificate, field string) string {
+	switch field {
+	case FieldSubject:
+		return cert.Subject.String()
+	case FieldCommonName:
+		return cert.Subject.CommonName
+	case FieldIssuer:
+		return cert.Issuer.String()
+	case FieldSerialNumber:
+		return cert.SerialNumber.String()
+	case FieldFingerprint:
+		return fingerprint(cert)
+	case FieldSANs:
+		return strings.Join(sans(cert), ",")
+	default:
+		return ""
+	}
+}
+
+func sans(cert *x509.Certificate) []string {
+	var names []string
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint lowercases the given fingerprint and removes the colons it may be written with.
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+
+	return set
+}
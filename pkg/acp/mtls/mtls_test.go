@@ -0,0 +1,304 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewHandler(t *testing.T) {
+	ca := newCA(t, "ca")
+
+	tests := []struct {
+		desc     string
+		cfg      Config
+		caSecret *corev1.Secret
+		wantErr  assert.ErrorAssertionFunc
+	}{
+		{
+			desc:     "missing CA secret name",
+			cfg:      Config{},
+			caSecret: ca.secret(),
+			wantErr:  assert.Error,
+		},
+		{
+			desc:    "CA secret not found",
+			cfg:     Config{CASecret: "ca"},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "no certificate in CA secret",
+			cfg:  Config{CASecret: "ca"},
+			caSecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "ca"},
+				Data:       map[string][]byte{SecretCAKey: []byte("invalid")},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			desc:     "unsupported identity field",
+			cfg:      Config{CASecret: "ca", ForwardHeaders: map[string]string{"X-Foo": "foo"}},
+			caSecret: ca.secret(),
+			wantErr:  assert.Error,
+		},
+		{
+			desc:     "valid",
+			cfg:      Config{CASecret: "ca", ForwardHeaders: map[string]string{"X-Subject": FieldSubject}},
+			caSecret: ca.secret(),
+			wantErr:  assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&test.cfg, "my-policy", test.caSecret)
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	ca := newCA(t, "ca")
+	otherCA := newCA(t, "other-ca")
+
+	client := ca.issue(t, "client", []string{"client.example.com"}, x509.ExtKeyUsageClientAuth)
+	server := ca.issue(t, "server", nil, x509.ExtKeyUsageServerAuth)
+	untrusted := otherCA.issue(t, "client", []string{"client.example.com"}, x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		desc           string
+		cfg            Config
+		header         string
+		wantStatusCode int
+		wantHeaders    map[string]string
+	}{
+		{
+			desc:           "no certificate",
+			cfg:            Config{CASecret: "ca"},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "malformed certificate",
+			cfg:            Config{CASecret: "ca"},
+			header:         "invalid",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "certificate signed by an untrusted CA",
+			cfg:            Config{CASecret: "ca"},
+			header:         traefikHeader(untrusted),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "certificate not usable for client authentication",
+			cfg:            Config{CASecret: "ca"},
+			header:         traefikHeader(server),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "valid certificate without rules",
+			cfg:            Config{CASecret: "ca"},
+			header:         traefikHeader(client),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "valid certificate as full PEM",
+			cfg:            Config{CASecret: "ca"},
+			header:         url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: client.Raw}))),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "matching common name",
+			cfg:            Config{CASecret: "ca", Subjects: []string{"client"}},
+			header:         traefikHeader(client),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "matching subject",
+			cfg:            Config{CASecret: "ca", Subjects: []string{"CN=client,O=Acme"}},
+			header:         traefikHeader(client),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "matching SAN",
+			cfg:            Config{CASecret: "ca", Subjects: []string{"other"}, SANs: []string{"client.example.com"}},
+			header:         traefikHeader(client),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "matching fingerprint",
+			cfg:            Config{CASecret: "ca", Fingerprints: []string{colonFingerprint(client)}},
+			header:         traefikHeader(client),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "no matching rule",
+			cfg:            Config{CASecret: "ca", Subjects: []string{"other"}, SANs: []string{"other.example.com"}},
+			header:         traefikHeader(client),
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc: "forwarded identity",
+			cfg: Config{
+				CASecret: "ca",
+				ForwardHeaders: map[string]string{
+					"X-Subject":     FieldSubject,
+					"X-Common-Name": FieldCommonName,
+					"X-Issuer":      FieldIssuer,
+					"X-Sans":        FieldSANs,
+					"X-Fingerprint": FieldFingerprint,
+				},
+			},
+			header:         traefikHeader(client),
+			wantStatusCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"X-Subject":     "CN=client,O=Acme",
+				"X-Common-Name": "client",
+				"X-Issuer":      "CN=ca",
+				"X-Sans":        "client.example.com",
+				"X-Fingerprint": fingerprint(client),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHandler(&test.cfg, "my-policy", ca.secret())
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+			if test.header != "" {
+				req.Header.Set(CertHeader, test.header)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+			for name, value := range test.wantHeaders {
+				assert.Equal(t, value, rw.Header().Get(name), name)
+			}
+		})
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (c *testCA) issue(t *testing.T, cn string, dnsNames []string, usage x509.ExtKeyUsage) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Acme"}},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.cert, &key.PublicKey, c.key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func (c *testCA) secret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca"},
+		Data: map[string][]byte{
+			SecretCAKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}),
+		},
+	}
+}
+
+// traefikHeader encodes the certificate the way the Traefik passTLSClientCert middleware does.
+func traefikHeader(cert *x509.Certificate) string {
+	return url.QueryEscape(base64.StdEncoding.EncodeToString(cert.Raw))
+}
+
+func colonFingerprint(cert *x509.Certificate) string {
+	fp := fingerprint(cert)
+
+	var res string
+	for i := 0; i < len(fp); i += 2 {
+		if i > 0 {
+			res += ":"
+		}
+		res += fp[i : i+2]
+	}
+
+	return res
+}
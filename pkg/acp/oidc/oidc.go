@@ -0,0 +1,563 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/audit"
+	acpjwt "github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt/expr"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// stateTTL is the time a user has to authenticate against the provider.
+const stateTTL = 10 * time.Minute
+
+// Config configures an OIDC ACP handler.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// ClientSecretRef references the Secret key holding the client secret, instead of ClientSecret.
+	ClientSecretRef *acpjwt.SecretKeyRef
+	// RedirectURL is the URL the provider redirects to once the user is authenticated. It can either be a complete URL
+	// or a path, in which case it is resolved against the URL of the request being authenticated.
+	RedirectURL string
+	// Secret is used to encrypt the session and state cookies.
+	Secret string
+	// SecretRef references the Secret key holding the secret, instead of Secret.
+	SecretRef      *acpjwt.SecretKeyRef
+	Scopes         []string
+	AuthParams     map[string]string
+	Session        *Session
+	ForwardHeaders map[string]string
+	Claims         string
+}
+
+// Session configures the session cookie.
+type Session struct {
+	Name     string
+	Path     string
+	Domain   string
+	SameSite string
+	Secure   bool
+}
+
+// Handler is an OIDC ACP Handler. It authenticates users with the authorization code flow and keeps track of
+// authenticated users with an encrypted session cookie.
+type Handler struct {
+	name string
+
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  *url.URL
+	scopes       []string
+	authParams   map[string]string
+
+	cookies     cookieConfig
+	stateCookie string
+	codec       *cookieCodec
+
+	fwdHeaders           map[string]string
+	validateCustomClaims expr.Predicate
+
+	client *http.Client
+
+	providerMu sync.Mutex
+	provider   *provider
+	// discovering is the ongoing provider discovery, if any.
+	discovering *providerDiscovery
+
+	now func() time.Time
+}
+
+// NewHandler returns a new OIDC ACP Handler. The client secret and secret references are resolved from the given
+// Secrets.
+func NewHandler(cfg *Config, polName string, secrets map[string]*corev1.Secret) (*Handler, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.New("an issuer is required")
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("a client ID is required")
+	}
+	if cfg.RedirectURL == "" {
+		return nil, errors.New("a redirect URL is required")
+	}
+	if cfg.ClientSecret != "" && cfg.ClientSecretRef != nil {
+		return nil, errors.New("client secret and client secret reference are mutually exclusive")
+	}
+	if cfg.Secret != "" && cfg.SecretRef != nil {
+		return nil, errors.New("secret and secret reference are mutually exclusive")
+	}
+	if cfg.Secret == "" && cfg.SecretRef == nil {
+		return nil, errors.New("a secret is required")
+	}
+
+	clientSecret := cfg.ClientSecret
+	if cfg.ClientSecretRef != nil {
+		var err error
+		clientSecret, err = acpjwt.SecretValue(cfg.ClientSecretRef, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("client secret: %w", err)
+		}
+	}
+
+	secret := cfg.Secret
+	if cfg.SecretRef != nil {
+		var err error
+		secret, err = acpjwt.SecretValue(cfg.SecretRef, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("secret: %w", err)
+		}
+	}
+
+	redirectURL, err := url.Parse(cfg.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse redirect URL: %w", err)
+	}
+
+	var pred expr.Predicate
+	if cfg.Claims != "" {
+		pred, err = expr.Parse(cfg.Claims)
+		if err != nil {
+			return nil, fmt.Errorf("make predicate: %w", err)
+		}
+	}
+
+	codec, err := newCookieCodec(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	cookies, err := newCookieConfig(cfg.Session, polName)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	return &Handler{
+		name:                 polName,
+		issuer:               cfg.Issuer,
+		clientID:             cfg.ClientID,
+		clientSecret:         clientSecret,
+		redirectURL:          redirectURL,
+		scopes:               scopes,
+		authParams:           cfg.AuthParams,
+		cookies:              cookies,
+		stateCookie:          cookies.name + "_state",
+		codec:                codec,
+		fwdHeaders:           cfg.ForwardHeaders,
+		validateCustomClaims: pred,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			Timeout: 5 * time.Second,
+		},
+		now: time.Now,
+	}, nil
+}
+
+func newCookieConfig(cfg *Session, polName string) (cookieConfig, error) {
+	cookies := cookieConfig{
+		name:     "hub_oidc_" + polName,
+		path:     "/",
+		sameSite: http.SameSiteLaxMode,
+	}
+	if cfg == nil {
+		return cookies, nil
+	}
+
+	sameSite, err := parseSameSite(cfg.SameSite)
+	if err != nil {
+		return cookieConfig{}, err
+	}
+
+	cookies.sameSite = sameSite
+	cookies.domain = cfg.Domain
+	cookies.secure = cfg.Secure
+
+	if cfg.Name != "" {
+		cookies.name = cfg.Name
+	}
+	if cfg.Path != "" {
+		cookies.path = cfg.Path
+	}
+
+	return cookies, nil
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	l := log.With().Str("handler_type", "OIDC").Str("handler_name", h.name).Logger()
+
+	reqURL, err := forwardedURL(req)
+	if err != nil {
+		l.Error().Err(err).Msg("Unable to determine the authenticated request URL")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	redirectURL := reqURL.ResolveReference(h.redirectURL)
+	if reqURL.Path == redirectURL.Path && strings.EqualFold(reqURL.Host, redirectURL.Host) {
+		h.handleCallback(l.WithContext(req.Context()), rw, req, reqURL, redirectURL)
+		return
+	}
+
+	sess, ok := h.session(req)
+	if !ok {
+		h.redirectToProvider(l.WithContext(req.Context()), rw, req, reqURL, redirectURL)
+		return
+	}
+
+	if sub, ok := sess.Claims["sub"].(string); ok {
+		audit.SetSubject(req.Context(), sub)
+	}
+
+	if h.validateCustomClaims != nil {
+		if !h.validateCustomClaims(sess.Claims, expr.NewRequest(req)) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	hdrs, err := expr.PluckClaims(h.fwdHeaders, sess.Claims)
+	if err != nil {
+		l.Error().Err(err).Msg("Unable to set forwarded header")
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	for name, vals := range hdrs {
+		for _, val := range vals {
+			rw.Header().Add(name, val)
+		}
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// session returns the session attached to the given request, if any and not expired.
+func (h *Handler) session(req *http.Request) (*session, bool) {
+	cookie, err := req.Cookie(h.cookies.name)
+	if err != nil {
+		return nil, false
+	}
+
+	var sess session
+	if err = h.codec.decode(h.cookies.name, cookie.Value, &sess); err != nil {
+		log.Debug().Err(err).Str("handler_name", h.name).Msg("Invalid session cookie")
+		return nil, false
+	}
+
+	if h.now().Unix() >= sess.ExpiresAt {
+		return nil, false
+	}
+
+	return &sess, true
+}
+
+// redirectToProvider redirects the user to the provider authorization endpoint, remembering the request URL so the
+// user can be sent back to it once authenticated.
+func (h *Handler) redirectToProvider(ctx context.Context, rw http.ResponseWriter, req *http.Request, reqURL, redirectURL *url.URL) {
+	logger := log.Ctx(ctx)
+
+	prov, err := h.getProvider(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to discover OIDC provider")
+		http.Error(rw, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to generate state")
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to generate nonce")
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := h.now().Add(stateTTL)
+	value, err := h.codec.encode(h.stateCookie, authState{
+		State:       state,
+		Nonce:       nonce,
+		RedirectURL: reqURL.String(),
+		ExpiresAt:   expiresAt.Unix(),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to encode state cookie")
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	opts := []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("nonce", nonce)}
+	for k, v := range h.authParams {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+
+	http.SetCookie(rw, h.cookies.cookie(h.stateCookie, value, expiresAt))
+	http.Redirect(rw, req, h.oauth2Config(prov, redirectURL).AuthCodeURL(state, opts...), http.StatusFound)
+}
+
+// handleCallback handles the redirection from the provider once the user is authenticated. It exchanges the
+// authorization code for an ID token, and sets the session cookie out of its claims.
+func (h *Handler) handleCallback(ctx context.Context, rw http.ResponseWriter, req *http.Request, reqURL, redirectURL *url.URL) {
+	logger := log.Ctx(ctx)
+
+	state, err := h.authState(req)
+	if err != nil {
+		logger.Debug().Err(err).Msg("Invalid state cookie")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(rw, h.cookies.expiredCookie(h.stateCookie))
+
+	query := reqURL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		logger.Debug().Str("error", errCode).Str("error_description", query.Get("error_description")).Msg("Authentication failed")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if query.Get("state") != state.State {
+		logger.Debug().Msg("State mismatch")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prov, err := h.getProvider(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to discover OIDC provider")
+		http.Error(rw, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	tok, err := h.oauth2Config(prov, redirectURL).Exchange(context.WithValue(ctx, oauth2.HTTPClient, h.client), query.Get("code"))
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to exchange authorization code")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, ok := tok.Extra("id_token").(string)
+	if !ok {
+		logger.Error().Msg("No ID token in token response")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.verifyIDToken(ctx, prov, rawIDToken, state.Nonce)
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to verify ID token")
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	expiresAt := h.now().Add(time.Hour)
+	if exp, ok := claims["exp"].(json.Number); ok {
+		if v, err := exp.Int64(); err == nil {
+			expiresAt = time.Unix(v, 0)
+		}
+	}
+
+	value, err := h.codec.encode(h.cookies.name, session{Claims: claims, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to encode session cookie")
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(rw, h.cookies.cookie(h.cookies.name, value, expiresAt))
+	http.Redirect(rw, req, state.RedirectURL, http.StatusFound)
+}
+
+func (h *Handler) authState(req *http.Request) (*authState, error) {
+	cookie, err := req.Cookie(h.stateCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	var state authState
+	if err = h.codec.decode(h.stateCookie, cookie.Value, &state); err != nil {
+		return nil, err
+	}
+
+	if h.now().Unix() >= state.ExpiresAt {
+		return nil, errors.New("state expired")
+	}
+
+	return &state, nil
+}
+
+// verifyIDToken verifies the signature and the standard claims of the given ID token, and returns its claims.
+func (h *Handler) verifyIDToken(ctx context.Context, prov *provider, rawIDToken, nonce string) (jwt.MapClaims, error) {
+	p := &jwt.Parser{UseJSONNumber: true}
+	tok, err := p.Parse(rawIDToken, func(tok *jwt.Token) (interface{}, error) {
+		if strings.HasPrefix(tok.Method.Alg(), "HS") {
+			if h.clientSecret == "" {
+				return nil, errors.New("no client secret configured")
+			}
+			return []byte(h.clientSecret), nil
+		}
+
+		kid, _ := tok.Header["kid"].(string)
+
+		k, err := prov.keySet.Key(ctx, kid)
+		if err != nil {
+			return nil, fmt.Errorf("error searching for JSON web key: %w", err)
+		}
+		if k == nil {
+			return nil, fmt.Errorf("no key with id %q found", kid)
+		}
+
+		return k.Key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid ID token claims")
+	}
+
+	if !claims.VerifyIssuer(prov.issuer, true) {
+		return nil, errors.New("unexpected issuer")
+	}
+	if !claims.VerifyAudience(h.clientID, true) {
+		return nil, errors.New("unexpected audience")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func (h *Handler) oauth2Config(prov *provider, redirectURL *url.URL) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     h.clientID,
+		ClientSecret: h.clientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  prov.authURL,
+			TokenURL: prov.tokenURL,
+		},
+		RedirectURL: redirectURL.String(),
+		Scopes:      h.scopes,
+	}
+}
+
+// providerDiscovery is an ongoing provider discovery, shared by the requests waiting for it.
+type providerDiscovery struct {
+	done     chan struct{}
+	provider *provider
+	err      error
+}
+
+// getProvider returns the provider metadata, discovering it if not done yet. The discovery is made without holding the
+// lock, and is not bound to the request which triggered it as its result is shared with other requests.
+func (h *Handler) getProvider(ctx context.Context) (*provider, error) {
+	h.providerMu.Lock()
+	if h.provider != nil {
+		prov := h.provider
+		h.providerMu.Unlock()
+		return prov, nil
+	}
+
+	d := h.discovering
+	if d == nil {
+		d = &providerDiscovery{done: make(chan struct{})}
+		h.discovering = d
+
+		go func() {
+			prov, err := discover(context.Background(), h.client, h.issuer, h.name)
+
+			h.providerMu.Lock()
+			if err == nil {
+				h.provider = prov
+			}
+			h.discovering = nil
+			h.providerMu.Unlock()
+
+			d.provider, d.err = prov, err
+			close(d.done)
+		}()
+	}
+	h.providerMu.Unlock()
+
+	select {
+	case <-d.done:
+		return d.provider, d.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// forwardedURL returns the URL of the request being authenticated, as forwarded by Traefik.
+func forwardedURL(req *http.Request) (*url.URL, error) {
+	host := req.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		return nil, errors.New("missing X-Forwarded-Host header")
+	}
+
+	proto := req.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		proto = "http"
+	}
+
+	return url.Parse(proto + "://" + host + req.Header.Get("X-Forwarded-Uri"))
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,473 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/discovery"
+	acpjwt "github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
+	"gopkg.in/square/go-jose.v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewHandler(t *testing.T) {
+	secrets := map[string]*corev1.Secret{
+		"my-oidc": {Data: map[string][]byte{"client-secret": []byte("client-secret"), "secret": []byte("secret")}},
+	}
+
+	tests := []struct {
+		desc    string
+		cfg     Config
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			desc:    "missing issuer",
+			cfg:     Config{ClientID: "client", RedirectURL: "/callback", Secret: "secret"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "missing client ID",
+			cfg:     Config{Issuer: "https://auth.example.com", RedirectURL: "/callback", Secret: "secret"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "missing redirect URL",
+			cfg:     Config{Issuer: "https://auth.example.com", ClientID: "client", Secret: "secret"},
+			wantErr: assert.Error,
+		},
+		{
+			desc:    "missing secret",
+			cfg:     Config{Issuer: "https://auth.example.com", ClientID: "client", RedirectURL: "/callback"},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "invalid claims",
+			cfg: Config{
+				Issuer:      "https://auth.example.com",
+				ClientID:    "client",
+				RedirectURL: "/callback",
+				Secret:      "secret",
+				Claims:      "Unknown(`grp`)",
+			},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "invalid SameSite",
+			cfg: Config{
+				Issuer:      "https://auth.example.com",
+				ClientID:    "client",
+				RedirectURL: "/callback",
+				Secret:      "secret",
+				Session:     &Session{SameSite: "sometimes"},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "valid",
+			cfg: Config{
+				Issuer:      "https://auth.example.com",
+				ClientID:    "client",
+				RedirectURL: "/callback",
+				Secret:      "secret",
+				Session:     &Session{SameSite: "strict", Secure: true},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			desc: "client secret and client secret reference",
+			cfg: Config{
+				Issuer:          "https://auth.example.com",
+				ClientID:        "client",
+				ClientSecret:    "client-secret",
+				ClientSecretRef: &acpjwt.SecretKeyRef{Name: "my-oidc", Key: "client-secret"},
+				RedirectURL:     "/callback",
+				Secret:          "secret",
+			},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "secret and secret reference",
+			cfg: Config{
+				Issuer:      "https://auth.example.com",
+				ClientID:    "client",
+				RedirectURL: "/callback",
+				Secret:      "secret",
+				SecretRef:   &acpjwt.SecretKeyRef{Name: "my-oidc", Key: "secret"},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "unknown client secret Secret",
+			cfg: Config{
+				Issuer:          "https://auth.example.com",
+				ClientID:        "client",
+				ClientSecretRef: &acpjwt.SecretKeyRef{Name: "unknown", Key: "client-secret"},
+				RedirectURL:     "/callback",
+				Secret:          "secret",
+			},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "unknown secret key",
+			cfg: Config{
+				Issuer:      "https://auth.example.com",
+				ClientID:    "client",
+				RedirectURL: "/callback",
+				SecretRef:   &acpjwt.SecretKeyRef{Name: "my-oidc", Key: "unknown"},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			desc: "valid with secret references",
+			cfg: Config{
+				Issuer:          "https://auth.example.com",
+				ClientID:        "client",
+				ClientSecretRef: &acpjwt.SecretKeyRef{Name: "my-oidc", Key: "client-secret"},
+				RedirectURL:     "/callback",
+				SecretRef:       &acpjwt.SecretKeyRef{Name: "my-oidc", Key: "secret"},
+			},
+			wantErr: assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHandler(&test.cfg, "my-policy", secrets)
+			test.wantErr(t, err)
+		})
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	idp := newFakeProvider(t)
+
+	h, err := NewHandler(&Config{
+		Issuer:         idp.URL(),
+		ClientID:       "client",
+		ClientSecret:   "client-secret",
+		RedirectURL:    "/callback",
+		Secret:         "secret",
+		Scopes:         []string{"openid", "email"},
+		AuthParams:     map[string]string{"prompt": "login"},
+		ForwardHeaders: map[string]string{"X-Email": "email"},
+		Claims:         "Equals(`group`, `dev`)",
+	}, "my-policy", nil)
+	require.NoError(t, err)
+
+	// An unauthenticated user is redirected to the provider.
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, newForwardedRequest("/foo?bar=baz"))
+
+	require.Equal(t, http.StatusFound, rw.Code)
+
+	location, err := url.Parse(rw.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, idp.URL()+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "client", location.Query().Get("client_id"))
+	assert.Equal(t, "http://app.example.com/callback", location.Query().Get("redirect_uri"))
+	assert.Equal(t, "openid email", location.Query().Get("scope"))
+	assert.Equal(t, "login", location.Query().Get("prompt"))
+
+	stateCookie := findCookie(t, rw.Result().Cookies(), "hub_oidc_my-policy_state")
+
+	// The provider redirects to the callback, the code gets exchanged and a session is created.
+	idp.nonce = location.Query().Get("nonce")
+
+	req := newForwardedRequest("/callback?code=code&state=" + url.QueryEscape(location.Query().Get("state")))
+	req.AddCookie(stateCookie)
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	require.Equal(t, http.StatusFound, rw.Code)
+	assert.Equal(t, "http://app.example.com/foo?bar=baz", rw.Header().Get("Location"))
+
+	sessionCookie := findCookie(t, rw.Result().Cookies(), "hub_oidc_my-policy")
+
+	// The authenticated user is let through.
+	req = newForwardedRequest("/foo?bar=baz")
+	req.AddCookie(sessionCookie)
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "john@example.com", rw.Header().Get("X-Email"))
+}
+
+func TestHandler_getProvider_concurrentDiscovery(t *testing.T) {
+	release := make(chan struct{})
+	var discoveries int32
+
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&discoveries, 1)
+		<-release
+
+		_ = json.NewEncoder(rw).Encode(discovery.ProviderMetadata{
+			Issuer:   issuer,
+			AuthURL:  issuer + "/authorize",
+			TokenURL: issuer + "/token",
+			JWKsURL:  issuer + "/jwks",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	issuer = srv.URL
+
+	h, err := NewHandler(&Config{
+		Issuer:      issuer,
+		ClientID:    "client",
+		RedirectURL: "/callback",
+		Secret:      "secret",
+	}, "my-policy", nil)
+	require.NoError(t, err)
+
+	// Requests waiting for the provider to be discovered give up with their context and don't block each other.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = h.getProvider(ctx)
+		cancel()
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+
+	close(release)
+
+	prov, err := h.getProvider(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, issuer+"/authorize", prov.authURL)
+
+	prov, err = h.getProvider(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, issuer+"/authorize", prov.authURL)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&discoveries))
+}
+
+func TestHandler_ServeHTTP_callbackStateMismatch(t *testing.T) {
+	idp := newFakeProvider(t)
+
+	h, err := NewHandler(&Config{
+		Issuer:      idp.URL(),
+		ClientID:    "client",
+		RedirectURL: "/callback",
+		Secret:      "secret",
+	}, "my-policy", nil)
+	require.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, newForwardedRequest("/"))
+	require.Equal(t, http.StatusFound, rw.Code)
+
+	req := newForwardedRequest("/callback?code=code&state=forged")
+	req.AddCookie(findCookie(t, rw.Result().Cookies(), "hub_oidc_my-policy_state"))
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestHandler_ServeHTTP_session(t *testing.T) {
+	// The provider is not available, making the redirection to the provider fail.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+
+	h, err := NewHandler(&Config{
+		Issuer:         srv.URL,
+		ClientID:       "client",
+		RedirectURL:    "/callback",
+		Secret:         "secret",
+		ForwardHeaders: map[string]string{"X-Email": "email"},
+		Claims:         "Equals(`group`, `dev`)",
+	}, "my-policy", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc           string
+		cookie         func(t *testing.T) *http.Cookie
+		wantStatusCode int
+		wantHeader     string
+	}{
+		{
+			desc: "valid session",
+			cookie: func(t *testing.T) *http.Cookie {
+				t.Helper()
+				return sessionCookie(t, h, map[string]interface{}{"email": "john@example.com", "group": "dev"}, time.Now().Add(time.Hour))
+			},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     "john@example.com",
+		},
+		{
+			desc: "claims not matching",
+			cookie: func(t *testing.T) *http.Cookie {
+				t.Helper()
+				return sessionCookie(t, h, map[string]interface{}{"email": "john@example.com", "group": "ops"}, time.Now().Add(time.Hour))
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			desc: "expired session",
+			cookie: func(t *testing.T) *http.Cookie {
+				t.Helper()
+				return sessionCookie(t, h, map[string]interface{}{"group": "dev"}, time.Now().Add(-time.Minute))
+			},
+			wantStatusCode: http.StatusBadGateway,
+		},
+		{
+			desc: "tampered session",
+			cookie: func(t *testing.T) *http.Cookie {
+				t.Helper()
+				return &http.Cookie{Name: "hub_oidc_my-policy", Value: "tampered"}
+			},
+			wantStatusCode: http.StatusBadGateway,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			req := newForwardedRequest("/")
+			req.AddCookie(test.cookie(t))
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.wantStatusCode, rw.Code)
+			assert.Equal(t, test.wantHeader, rw.Header().Get("X-Email"))
+		})
+	}
+}
+
+func sessionCookie(t *testing.T, h *Handler, claims map[string]interface{}, expiresAt time.Time) *http.Cookie {
+	t.Helper()
+
+	value, err := h.codec.encode(h.cookies.name, session{Claims: claims, ExpiresAt: expiresAt.Unix()})
+	require.NoError(t, err)
+
+	return &http.Cookie{Name: h.cookies.name, Value: value}
+}
+
+func newForwardedRequest(uri string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://auth-server/my-policy", nil)
+	req.Header.Set("X-Forwarded-Proto", "http")
+	req.Header.Set("X-Forwarded-Host", "app.example.com")
+	req.Header.Set("X-Forwarded-Uri", uri)
+
+	return req
+}
+
+func findCookie(t *testing.T, cookies []*http.Cookie, name string) *http.Cookie {
+	t.Helper()
+
+	for _, c := range cookies {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	require.Failf(t, "cookie not found", "no cookie named %q", name)
+
+	return nil
+}
+
+type fakeProvider struct {
+	srv   *httptest.Server
+	key   *rsa.PrivateKey
+	nonce string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p := &fakeProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(rw).Encode(discovery.ProviderMetadata{
+			Issuer:   p.URL(),
+			AuthURL:  p.URL() + "/authorize",
+			TokenURL: p.URL() + "/token",
+			JWKsURL:  p.URL() + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(rw http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(rw).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "kid", Algorithm: "RS256", Use: "sig"}},
+		})
+	})
+	mux.HandleFunc("/token", func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil || req.Form.Get("code") != "code" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   p.URL(),
+			"aud":   "client",
+			"sub":   "john",
+			"email": "john@example.com",
+			"group": "dev",
+			"nonce": p.nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		tok.Header["kid"] = "kid"
+
+		idToken, err := tok.SignedString(key)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+
+	return p
+}
+
+func (p *fakeProvider) URL() string {
+	return p.srv.URL
+}
@@ -0,0 +1,54 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/traefik/hub-agent-kubernetes/pkg/acp/discovery"
+	acpjwt "github.com/traefik/hub-agent-kubernetes/pkg/acp/jwt"
+)
+
+// provider holds the OpenID provider metadata required to authenticate users.
+type provider struct {
+	issuer   string
+	authURL  string
+	tokenURL string
+	keySet   acpjwt.KeySet
+}
+
+// discover fetches the metadata of the OpenID provider identified by the given issuer, for the given ACP.
+func discover(ctx context.Context, client *http.Client, issuer, polName string) (*provider, error) {
+	md, err := discovery.Discover(ctx, client, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if md.AuthURL == "" || md.TokenURL == "" || md.JWKsURL == "" {
+		return nil, errors.New("incomplete provider metadata")
+	}
+
+	return &provider{
+		issuer:   md.Issuer,
+		authURL:  md.AuthURL,
+		tokenURL: md.TokenURL,
+		keySet:   acpjwt.NewRemoteKeySet(polName, md.JWKsURL),
+	}, nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package oidc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// session is the content of the session cookie.
+type session struct {
+	Claims    map[string]interface{} `json:"claims"`
+	ExpiresAt int64                  `json:"exp"`
+}
+
+// authState is the content of the state cookie, set while the user authenticates against the provider.
+type authState struct {
+	State       string `json:"state"`
+	Nonce       string `json:"nonce"`
+	RedirectURL string `json:"redirectUrl"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+// cookieCodec encrypts and authenticates cookie values.
+type cookieCodec struct {
+	aead cipher.AEAD
+}
+
+func newCookieCodec(secret string) (*cookieCodec, error) {
+	key := sha256.Sum256([]byte(secret))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create AEAD: %w", err)
+	}
+
+	return &cookieCodec{aead: aead}, nil
+}
+
+// encode encrypts the given value. The cookie name is used as additional data so a value cannot be moved from one
+// cookie to another.
+func (c *cookieCodec) encode(name string, v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("marshal cookie value: %w", err)
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(c.aead.Seal(nonce, nonce, b, []byte(name))), nil
+}
+
+// decode decrypts the given cookie value into v.
+func (c *cookieCodec) decode(name, value string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("decode cookie value: %w", err)
+	}
+
+	if len(b) < c.aead.NonceSize() {
+		return errors.New("cookie value too short")
+	}
+
+	nonce, ciphertext := b[:c.aead.NonceSize()], b[c.aead.NonceSize():]
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return fmt.Errorf("decrypt cookie value: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(plaintext))
+	dec.UseNumber()
+
+	return dec.Decode(v)
+}
+
+// cookieConfig holds the attributes of the cookies set by the handler.
+type cookieConfig struct {
+	name     string
+	path     string
+	domain   string
+	sameSite http.SameSite
+	secure   bool
+}
+
+func (c cookieConfig) cookie(name, value string, expiresAt time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     c.path,
+		Domain:   c.domain,
+		Expires:  expiresAt,
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: c.sameSite,
+	}
+}
+
+func (c cookieConfig) expiredCookie(name string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Path:     c.path,
+		Domain:   c.domain,
+		MaxAge:   -1,
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: c.sameSite,
+	}
+}
+
+func parseSameSite(s string) (http.SameSite, error) {
+	switch s {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unsupported SameSite value %q", s)
+	}
+}
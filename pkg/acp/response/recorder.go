@@ -0,0 +1,73 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package response
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Recorder records the response of an ACP handler, so it can be inspected before being replayed.
+type Recorder struct {
+	code   int
+	header http.Header
+	body   bytes.Buffer
+}
+
+// NewRecorder returns a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		code:   http.StatusOK,
+		header: make(http.Header),
+	}
+}
+
+// Code returns the recorded status code.
+func (r *Recorder) Code() int {
+	return r.code
+}
+
+// Authorized returns whether the recorded response authorizes the request, that is whether its status code is 2xx.
+func (r *Recorder) Authorized() bool {
+	return r.code >= 200 && r.code < 300
+}
+
+// Header returns the recorded headers.
+func (r *Recorder) Header() http.Header {
+	return r.header
+}
+
+// Write records the given body bytes.
+func (r *Recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+// WriteHeader records the given status code.
+func (r *Recorder) WriteHeader(code int) {
+	r.code = code
+}
+
+// Replay writes the recorded response to the given response writer.
+func (r *Recorder) Replay(rw http.ResponseWriter) {
+	for name, values := range r.header {
+		rw.Header()[name] = values
+	}
+
+	rw.WriteHeader(r.code)
+	_, _ = rw.Write(r.body.Bytes())
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package tokencache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// LoadFunc loads the value of a token. It returns the time until which the value can be cached, a zero time meaning it
+// must not be cached.
+type LoadFunc func(ctx context.Context) (value interface{}, expiresAt time.Time, err error)
+
+type entry struct {
+	key       [sha256.Size]byte
+	value     interface{}
+	expiresAt time.Time
+}
+
+// inflight is an ongoing load, shared by the requests waiting for it.
+type inflight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Cache is an LRU cache of values derived from tokens, such as their validation. Tokens are stored hashed so they are
+// not kept in memory.
+type Cache struct {
+	mu         sync.Mutex
+	entries    map[[sha256.Size]byte]*list.Element
+	lru        *list.List
+	maxEntries int
+	loading    map[[sha256.Size]byte]*inflight
+
+	now func() time.Time
+}
+
+// New returns a cache holding at most the given number of entries, above which the least recently used ones are
+// evicted. Entries expire according to the given clock.
+func New(maxEntries int, now func() time.Time) *Cache {
+	return &Cache{
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		loading:    make(map[[sha256.Size]byte]*inflight),
+		now:        now,
+	}
+}
+
+// Get returns the cached value of the given token.
+func (c *Cache) Get(token string) (interface{}, bool) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.get(key)
+}
+
+// Set caches the value of the given token until the given time.
+func (c *Cache) Set(token string, value interface{}, expiresAt time.Time) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, expiresAt)
+}
+
+// Load returns the cached value of the given token, loading it with the given function if needed. Concurrent loads of
+// the same token are collapsed into a single one, which is not bound to the context of the request which triggered it
+// as its result is shared with other requests. Errors are not cached.
+func (c *Cache) Load(ctx context.Context, token string, load LoadFunc) (interface{}, error) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	if value, ok := c.get(key); ok {
+		c.mu.Unlock()
+		return value, nil
+	}
+
+	call, ok := c.loading[key]
+	if !ok {
+		call = &inflight{done: make(chan struct{})}
+		c.loading[key] = call
+
+		go func() {
+			value, expiresAt, err := load(context.Background())
+
+			c.mu.Lock()
+			delete(c.loading, key)
+			if err == nil && !expiresAt.IsZero() {
+				c.set(key, value, expiresAt)
+			}
+			c.mu.Unlock()
+
+			call.value, call.err = value, err
+			close(call.done)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// get returns the cached value of the given key. It must be called with the lock held.
+func (c *Cache) get(key [sha256.Size]byte) (interface{}, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expiresAt) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return e.value, true
+}
+
+// set caches the value of the given key. It must be called with the lock held.
+func (c *Cache) set(key [sha256.Size]byte, value interface{}, expiresAt time.Time) {
+	if elem, ok := c.entries[key]; ok {
+		e := elem.Value.(*entry)
+		e.value = value
+		e.expiresAt = expiresAt
+
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+
+	if c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package tokencache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+
+	c := New(2, func() time.Time { return now })
+
+	c.Set("a", "forbidden", now.Add(time.Minute))
+	c.Set("b", "ok", now.Add(time.Minute))
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "forbidden", v)
+
+	// "b" is the least recently used entry, so it gets evicted.
+	c.Set("c", "ok", now.Add(time.Second))
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+}
+
+func TestCache_Load(t *testing.T) {
+	c := New(10, time.Now)
+
+	release := make(chan struct{})
+	var loads int32
+	load := func(ctx context.Context) (interface{}, time.Time, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+
+		return "value", time.Now().Add(time.Minute), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			v, err := c.Load(context.Background(), "token", load)
+			assert.NoError(t, err)
+			assert.Equal(t, "value", v)
+		}()
+	}
+
+	// A request giving up does not wait for the ongoing load.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.Load(ctx, "token", load)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	wg.Wait()
+
+	v, err := c.Load(context.Background(), "token", load)
+	require.NoError(t, err)
+	assert.Equal(t, "value", v)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestCache_Load_notCached(t *testing.T) {
+	c := New(10, time.Now)
+
+	var loads int32
+	failing := func(ctx context.Context) (interface{}, time.Time, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, time.Time{}, errors.New("boom")
+	}
+	uncacheable := func(ctx context.Context) (interface{}, time.Time, error) {
+		atomic.AddInt32(&loads, 1)
+		return "value", time.Time{}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Load(context.Background(), "failing", failing)
+		assert.Error(t, err)
+
+		v, err := c.Load(context.Background(), "uncacheable", uncacheable)
+		assert.NoError(t, err)
+		assert.Equal(t, "value", v)
+	}
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(&loads))
+}
@@ -187,7 +187,7 @@ func needUpdate(a ACP, policy *hubv1alpha1.AccessControlPolicy) bool {
 }
 
 func buildAccessControlPolicySpec(a ACP) hubv1alpha1.AccessControlPolicySpec {
-	spec := hubv1alpha1.AccessControlPolicySpec{}
+	spec := hubv1alpha1.AccessControlPolicySpec{Enforcement: a.Enforcement}
 	switch {
 	case a.JWT != nil:
 		spec.JWT = &hubv1alpha1.AccessControlPolicyJWT{
@@ -200,15 +200,142 @@ func buildAccessControlPolicySpec(a ACP) hubv1alpha1.AccessControlPolicySpec {
 			ForwardHeaders:             a.JWT.ForwardHeaders,
 			TokenQueryKey:              a.JWT.TokenQueryKey,
 			Claims:                     a.JWT.Claims,
+			Issuer:                     a.JWT.Issuer,
+			Issuers:                    a.JWT.Issuers,
+			Audiences:                  a.JWT.Audiences,
+			RequiredClaims:             a.JWT.RequiredClaims,
+			Algorithms:                 a.JWT.Algorithms,
+		}
+		if ref := a.JWT.SigningSecretRef; ref != nil {
+			spec.JWT.SigningSecretRef = &hubv1alpha1.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+		if ref := a.JWT.PublicKeyRef; ref != nil {
+			spec.JWT.PublicKeyRef = &hubv1alpha1.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+		if a.JWT.Leeway != 0 {
+			spec.JWT.Leeway = &metav1.Duration{Duration: a.JWT.Leeway}
+		}
+		if a.JWT.CacheTTL != 0 {
+			spec.JWT.CacheTTL = &metav1.Duration{Duration: a.JWT.CacheTTL}
+		}
+		for _, src := range a.JWT.TokenSources {
+			spec.JWT.TokenSources = append(spec.JWT.TokenSources, hubv1alpha1.JWTTokenSource{Type: src.Type, Name: src.Name, Prefix: src.Prefix})
+		}
+		for _, r := range a.JWT.Rules {
+			spec.JWT.Rules = append(spec.JWT.Rules, hubv1alpha1.JWTRule{Match: r.Match, Claims: r.Claims})
+		}
+		if a.JWT.Deny != nil {
+			spec.JWT.Deny = &hubv1alpha1.JWTDeny{
+				StatusCode:  a.JWT.Deny.StatusCode,
+				ContentType: a.JWT.Deny.ContentType,
+				Body:        a.JWT.Deny.Body,
+				RedirectURL: a.JWT.Deny.RedirectURL,
+			}
+		}
+		if a.JWT.Revocation != nil {
+			spec.JWT.Revocation = &hubv1alpha1.JWTRevocation{
+				ConfigMap: a.JWT.Revocation.ConfigMap,
+				Secret:    a.JWT.Revocation.Secret,
+				URL:       a.JWT.Revocation.URL,
+			}
+			if a.JWT.Revocation.RefreshInterval != 0 {
+				spec.JWT.Revocation.RefreshInterval = &metav1.Duration{Duration: a.JWT.Revocation.RefreshInterval}
+			}
 		}
 
 	case a.BasicAuth != nil:
 		spec.BasicAuth = &hubv1alpha1.AccessControlPolicyBasicAuth{
 			Users:                    a.BasicAuth.Users,
+			UsersSecret:              a.BasicAuth.UsersSecret,
 			Realm:                    a.BasicAuth.Realm,
 			StripAuthorizationHeader: a.BasicAuth.StripAuthorizationHeader,
 			ForwardUsernameHeader:    a.BasicAuth.ForwardUsernameHeader,
 		}
+		if a.BasicAuth.Lockout != nil {
+			spec.BasicAuth.Lockout = &hubv1alpha1.BasicAuthLockout{
+				MaxFailures:       a.BasicAuth.Lockout.MaxFailures,
+				TrustedProxyDepth: a.BasicAuth.Lockout.TrustedProxyDepth,
+			}
+			if a.BasicAuth.Lockout.Duration != 0 {
+				spec.BasicAuth.Lockout.Duration = &metav1.Duration{Duration: a.BasicAuth.Lockout.Duration}
+			}
+			if a.BasicAuth.Lockout.MaxDuration != 0 {
+				spec.BasicAuth.Lockout.MaxDuration = &metav1.Duration{Duration: a.BasicAuth.Lockout.MaxDuration}
+			}
+		}
+
+	case a.OIDC != nil:
+		var session *hubv1alpha1.AccessControlPolicyOIDCSession
+		if a.OIDC.Session != nil {
+			session = &hubv1alpha1.AccessControlPolicyOIDCSession{
+				Name:     a.OIDC.Session.Name,
+				Path:     a.OIDC.Session.Path,
+				Domain:   a.OIDC.Session.Domain,
+				SameSite: a.OIDC.Session.SameSite,
+				Secure:   a.OIDC.Session.Secure,
+			}
+		}
+
+		spec.OIDC = &hubv1alpha1.AccessControlPolicyOIDC{
+			Issuer:         a.OIDC.Issuer,
+			ClientID:       a.OIDC.ClientID,
+			ClientSecret:   a.OIDC.ClientSecret,
+			RedirectURL:    a.OIDC.RedirectURL,
+			Secret:         a.OIDC.Secret,
+			Scopes:         a.OIDC.Scopes,
+			AuthParams:     a.OIDC.AuthParams,
+			Session:        session,
+			ForwardHeaders: a.OIDC.ForwardHeaders,
+			Claims:         a.OIDC.Claims,
+		}
+		if ref := a.OIDC.ClientSecretRef; ref != nil {
+			spec.OIDC.ClientSecretRef = &hubv1alpha1.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+		if ref := a.OIDC.SecretRef; ref != nil {
+			spec.OIDC.SecretRef = &hubv1alpha1.SecretKeyRef{Name: ref.Name, Key: ref.Key}
+		}
+
+	case a.APIKey != nil:
+		spec.APIKey = &hubv1alpha1.AccessControlPolicyAPIKey{
+			KeyHeader:      a.APIKey.KeyHeader,
+			KeyQuery:       a.APIKey.KeyQuery,
+			SecretSelector: a.APIKey.SecretSelector,
+			ForwardHeaders: a.APIKey.ForwardHeaders,
+		}
+
+	case a.MTLS != nil:
+		spec.MTLS = &hubv1alpha1.AccessControlPolicyMTLS{
+			CASecret:       a.MTLS.CASecret,
+			Subjects:       a.MTLS.Subjects,
+			SANs:           a.MTLS.SANs,
+			Fingerprints:   a.MTLS.Fingerprints,
+			ForwardHeaders: a.MTLS.ForwardHeaders,
+		}
+
+	case a.Introspection != nil:
+		spec.Introspection = &hubv1alpha1.AccessControlPolicyIntrospection{
+			URL:                      a.Introspection.URL,
+			ClientCredentialsSecret:  a.Introspection.ClientCredentialsSecret,
+			Scopes:                   a.Introspection.Scopes,
+			Audiences:                a.Introspection.Audiences,
+			StripAuthorizationHeader: a.Introspection.StripAuthorizationHeader,
+			ForwardHeaders:           a.Introspection.ForwardHeaders,
+			Claims:                   a.Introspection.Claims,
+		}
+
+	case a.IPAllowList != nil:
+		spec.IPAllowList = &hubv1alpha1.AccessControlPolicyIPAllowList{
+			Allow:             a.IPAllowList.Allow,
+			Deny:              a.IPAllowList.Deny,
+			TrustedProxyDepth: a.IPAllowList.TrustedProxyDepth,
+			ConfigMap:         a.IPAllowList.ConfigMap,
+		}
+
+	case a.Composite != nil:
+		spec.Composite = &hubv1alpha1.AccessControlPolicyComposite{
+			AllOf: a.Composite.AllOf,
+			AnyOf: a.Composite.AnyOf,
+		}
 	}
 
 	return spec
@@ -46,8 +46,15 @@ type AccessControlPolicy struct {
 
 // AccessControlPolicySpec configures an access control policy.
 type AccessControlPolicySpec struct {
-	JWT       *AccessControlPolicyJWT       `json:"jwt,omitempty"`
-	BasicAuth *AccessControlPolicyBasicAuth `json:"basicAuth,omitempty"`
+	JWT           *AccessControlPolicyJWT           `json:"jwt,omitempty"`
+	BasicAuth     *AccessControlPolicyBasicAuth     `json:"basicAuth,omitempty"`
+	OIDC          *AccessControlPolicyOIDC          `json:"oidc,omitempty"`
+	APIKey        *AccessControlPolicyAPIKey        `json:"apiKey,omitempty"`
+	MTLS          *AccessControlPolicyMTLS          `json:"mtls,omitempty"`
+	Introspection *AccessControlPolicyIntrospection `json:"introspection,omitempty"`
+	IPAllowList   *AccessControlPolicyIPAllowList   `json:"ipAllowList,omitempty"`
+	Composite     *AccessControlPolicyComposite     `json:"composite,omitempty"`
+	Enforcement   string                            `json:"enforcement,omitempty"`
 }
 
 // Hash return AccessControlPolicySpec hash.
@@ -68,27 +75,154 @@ type AccessControlPolicyJWT struct {
 	SigningSecret              string            `json:"signingSecret,omitempty"`
 	SigningSecretBase64Encoded bool              `json:"signingSecretBase64Encoded,omitempty"`
 	PublicKey                  string            `json:"publicKey,omitempty"`
+	SigningSecretRef           *SecretKeyRef     `json:"signingSecretRef,omitempty"`
+	PublicKeyRef               *SecretKeyRef     `json:"publicKeyRef,omitempty"`
 	JWKsFile                   string            `json:"jwksFile,omitempty"`
 	JWKsURL                    string            `json:"jwksUrl,omitempty"`
 	StripAuthorizationHeader   bool              `json:"stripAuthorizationHeader,omitempty"`
 	ForwardHeaders             map[string]string `json:"forwardHeaders,omitempty"`
 	TokenQueryKey              string            `json:"tokenQueryKey,omitempty"`
+	TokenSources               []JWTTokenSource  `json:"tokenSources,omitempty"`
 	Claims                     string            `json:"claims,omitempty"`
+	Issuer                     string            `json:"issuer,omitempty"`
+	Issuers                    []string          `json:"issuers,omitempty"`
+	Audiences                  []string          `json:"audiences,omitempty"`
+	Leeway                     *metav1.Duration  `json:"leeway,omitempty"`
+	RequiredClaims             []string          `json:"requiredClaims,omitempty"`
+	Algorithms                 []string          `json:"algorithms,omitempty"`
+	Rules                      []JWTRule         `json:"rules,omitempty"`
+	CacheTTL                   *metav1.Duration  `json:"cacheTtl,omitempty"`
+	Deny                       *JWTDeny          `json:"deny,omitempty"`
+	Revocation                 *JWTRevocation    `json:"revocation,omitempty"`
+}
+
+// SecretKeyRef references a key of a Secret.
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// JWTTokenSource is a place tokens are looked for in requests.
+type JWTTokenSource struct {
+	Type   string `json:"type,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// JWTRule authorizes the requests matching an expression based on their token claims.
+type JWTRule struct {
+	Match  string `json:"match,omitempty"`
+	Claims string `json:"claims,omitempty"`
+}
+
+// JWTDeny configures the response sent when a request is denied.
+type JWTDeny struct {
+	StatusCode  int    `json:"statusCode,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+	RedirectURL string `json:"redirectUrl,omitempty"`
+}
+
+// JWTRevocation configures the revocation of tokens before they expire.
+type JWTRevocation struct {
+	ConfigMap       string           `json:"configMap,omitempty"`
+	Secret          string           `json:"secret,omitempty"`
+	URL             string           `json:"url,omitempty"`
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
 }
 
 // AccessControlPolicyBasicAuth holds the HTTP basic authentication configuration.
 type AccessControlPolicyBasicAuth struct {
-	Users                    []string `json:"users,omitempty"`
-	Realm                    string   `json:"realm,omitempty"`
-	StripAuthorizationHeader bool     `json:"stripAuthorizationHeader,omitempty"`
-	ForwardUsernameHeader    string   `json:"forwardUsernameHeader,omitempty"`
+	Users                    []string          `json:"users,omitempty"`
+	UsersSecret              string            `json:"usersSecret,omitempty"`
+	Realm                    string            `json:"realm,omitempty"`
+	StripAuthorizationHeader bool              `json:"stripAuthorizationHeader,omitempty"`
+	ForwardUsernameHeader    string            `json:"forwardUsernameHeader,omitempty"`
+	Lockout                  *BasicAuthLockout `json:"lockout,omitempty"`
+}
+
+// BasicAuthLockout configures the lockout of the usernames and client IPs failing to authenticate too many times in a
+// row.
+type BasicAuthLockout struct {
+	MaxFailures       int              `json:"maxFailures,omitempty"`
+	Duration          *metav1.Duration `json:"duration,omitempty"`
+	MaxDuration       *metav1.Duration `json:"maxDuration,omitempty"`
+	TrustedProxyDepth int              `json:"trustedProxyDepth,omitempty"`
+}
+
+// AccessControlPolicyOIDC holds the OIDC authentication configuration.
+type AccessControlPolicyOIDC struct {
+	Issuer          string                          `json:"issuer,omitempty"`
+	ClientID        string                          `json:"clientId,omitempty"`
+	ClientSecret    string                          `json:"clientSecret,omitempty"`
+	ClientSecretRef *SecretKeyRef                   `json:"clientSecretRef,omitempty"`
+	RedirectURL     string                          `json:"redirectUrl,omitempty"`
+	Secret          string                          `json:"secret,omitempty"`
+	SecretRef       *SecretKeyRef                   `json:"secretRef,omitempty"`
+	Scopes          []string                        `json:"scopes,omitempty"`
+	AuthParams      map[string]string               `json:"authParams,omitempty"`
+	Session         *AccessControlPolicyOIDCSession `json:"session,omitempty"`
+	ForwardHeaders  map[string]string               `json:"forwardHeaders,omitempty"`
+	Claims          string                          `json:"claims,omitempty"`
+}
+
+// AccessControlPolicyOIDCSession configures the OIDC session cookie.
+type AccessControlPolicyOIDCSession struct {
+	Name     string `json:"name,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	SameSite string `json:"sameSite,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// AccessControlPolicyAPIKey holds the API key authentication configuration.
+type AccessControlPolicyAPIKey struct {
+	KeyHeader      string            `json:"keyHeader,omitempty"`
+	KeyQuery       string            `json:"keyQuery,omitempty"`
+	SecretSelector string            `json:"secretSelector,omitempty"`
+	ForwardHeaders map[string]string `json:"forwardHeaders,omitempty"`
+}
+
+// AccessControlPolicyMTLS holds the client certificate authentication configuration.
+type AccessControlPolicyMTLS struct {
+	CASecret       string            `json:"caSecret,omitempty"`
+	Subjects       []string          `json:"subjects,omitempty"`
+	SANs           []string          `json:"sans,omitempty"`
+	Fingerprints   []string          `json:"fingerprints,omitempty"`
+	ForwardHeaders map[string]string `json:"forwardHeaders,omitempty"`
+}
+
+// AccessControlPolicyIntrospection holds the OAuth2 token introspection configuration.
+type AccessControlPolicyIntrospection struct {
+	URL                      string            `json:"url,omitempty"`
+	ClientCredentialsSecret  string            `json:"clientCredentialsSecret,omitempty"`
+	Scopes                   []string          `json:"scopes,omitempty"`
+	Audiences                []string          `json:"audiences,omitempty"`
+	StripAuthorizationHeader bool              `json:"stripAuthorizationHeader,omitempty"`
+	ForwardHeaders           map[string]string `json:"forwardHeaders,omitempty"`
+	Claims                   string            `json:"claims,omitempty"`
+}
+
+// AccessControlPolicyIPAllowList holds the IP allow list configuration.
+type AccessControlPolicyIPAllowList struct {
+	Allow             []string `json:"allow,omitempty"`
+	Deny              []string `json:"deny,omitempty"`
+	TrustedProxyDepth int      `json:"trustedProxyDepth,omitempty"`
+	ConfigMap         string   `json:"configMap,omitempty"`
+}
+
+// AccessControlPolicyComposite holds the composite policy configuration.
+type AccessControlPolicyComposite struct {
+	AllOf []string `json:"allOf,omitempty"`
+	AnyOf []string `json:"anyOf,omitempty"`
 }
 
 // AccessControlPolicyStatus is the status of the access control policy.
 type AccessControlPolicyStatus struct {
-	Version  string      `json:"version,omitempty"`
-	SyncedAt metav1.Time `json:"syncedAt,omitempty"`
-	SpecHash string      `json:"specHash,omitempty"`
+	Version    string             `json:"version,omitempty"`
+	SyncedAt   metav1.Time        `json:"syncedAt,omitempty"`
+	SpecHash   string             `json:"specHash,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -22,6 +22,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -53,6 +54,29 @@ func (in *AccessControlPolicy) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlPolicyAPIKey) DeepCopyInto(out *AccessControlPolicyAPIKey) {
+	*out = *in
+	if in.ForwardHeaders != nil {
+		in, out := &in.ForwardHeaders, &out.ForwardHeaders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlPolicyAPIKey.
+func (in *AccessControlPolicyAPIKey) DeepCopy() *AccessControlPolicyAPIKey {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlPolicyAPIKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AccessControlPolicyBasicAuth) DeepCopyInto(out *AccessControlPolicyBasicAuth) {
 	*out = *in
@@ -61,6 +85,11 @@ func (in *AccessControlPolicyBasicAuth) DeepCopyInto(out *AccessControlPolicyBas
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Lockout != nil {
+		in, out := &in.Lockout, &out.Lockout
+		*out = new(BasicAuthLockout)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -74,9 +103,104 @@ func (in *AccessControlPolicyBasicAuth) DeepCopy() *AccessControlPolicyBasicAuth
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlPolicyComposite) DeepCopyInto(out *AccessControlPolicyComposite) {
+	*out = *in
+	if in.AllOf != nil {
+		in, out := &in.AllOf, &out.AllOf
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AnyOf != nil {
+		in, out := &in.AnyOf, &out.AnyOf
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlPolicyComposite.
+func (in *AccessControlPolicyComposite) DeepCopy() *AccessControlPolicyComposite {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlPolicyComposite)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlPolicyIPAllowList) DeepCopyInto(out *AccessControlPolicyIPAllowList) {
+	*out = *in
+	if in.Allow != nil {
+		in, out := &in.Allow, &out.Allow
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Deny != nil {
+		in, out := &in.Deny, &out.Deny
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlPolicyIPAllowList.
+func (in *AccessControlPolicyIPAllowList) DeepCopy() *AccessControlPolicyIPAllowList {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlPolicyIPAllowList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlPolicyIntrospection) DeepCopyInto(out *AccessControlPolicyIntrospection) {
+	*out = *in
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ForwardHeaders != nil {
+		in, out := &in.ForwardHeaders, &out.ForwardHeaders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlPolicyIntrospection.
+func (in *AccessControlPolicyIntrospection) DeepCopy() *AccessControlPolicyIntrospection {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlPolicyIntrospection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AccessControlPolicyJWT) DeepCopyInto(out *AccessControlPolicyJWT) {
 	*out = *in
+	if in.SigningSecretRef != nil {
+		in, out := &in.SigningSecretRef, &out.SigningSecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.PublicKeyRef != nil {
+		in, out := &in.PublicKeyRef, &out.PublicKeyRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
 	if in.ForwardHeaders != nil {
 		in, out := &in.ForwardHeaders, &out.ForwardHeaders
 		*out = make(map[string]string, len(*in))
@@ -84,6 +208,56 @@ func (in *AccessControlPolicyJWT) DeepCopyInto(out *AccessControlPolicyJWT) {
 			(*out)[key] = val
 		}
 	}
+	if in.TokenSources != nil {
+		in, out := &in.TokenSources, &out.TokenSources
+		*out = make([]JWTTokenSource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Issuers != nil {
+		in, out := &in.Issuers, &out.Issuers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Leeway != nil {
+		in, out := &in.Leeway, &out.Leeway
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RequiredClaims != nil {
+		in, out := &in.RequiredClaims, &out.RequiredClaims
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Algorithms != nil {
+		in, out := &in.Algorithms, &out.Algorithms
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]JWTRule, len(*in))
+		copy(*out, *in)
+	}
+	if in.CacheTTL != nil {
+		in, out := &in.CacheTTL, &out.CacheTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Deny != nil {
+		in, out := &in.Deny, &out.Deny
+		*out = new(JWTDeny)
+		**out = **in
+	}
+	if in.Revocation != nil {
+		in, out := &in.Revocation, &out.Revocation
+		*out = new(JWTRevocation)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -130,6 +304,110 @@ func (in *AccessControlPolicyList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlPolicyMTLS) DeepCopyInto(out *AccessControlPolicyMTLS) {
+	*out = *in
+	if in.Subjects != nil {
+		in, out := &in.Subjects, &out.Subjects
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SANs != nil {
+		in, out := &in.SANs, &out.SANs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Fingerprints != nil {
+		in, out := &in.Fingerprints, &out.Fingerprints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ForwardHeaders != nil {
+		in, out := &in.ForwardHeaders, &out.ForwardHeaders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlPolicyMTLS.
+func (in *AccessControlPolicyMTLS) DeepCopy() *AccessControlPolicyMTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlPolicyMTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlPolicyOIDC) DeepCopyInto(out *AccessControlPolicyOIDC) {
+	*out = *in
+	if in.ClientSecretRef != nil {
+		in, out := &in.ClientSecretRef, &out.ClientSecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AuthParams != nil {
+		in, out := &in.AuthParams, &out.AuthParams
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Session != nil {
+		in, out := &in.Session, &out.Session
+		*out = new(AccessControlPolicyOIDCSession)
+		**out = **in
+	}
+	if in.ForwardHeaders != nil {
+		in, out := &in.ForwardHeaders, &out.ForwardHeaders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlPolicyOIDC.
+func (in *AccessControlPolicyOIDC) DeepCopy() *AccessControlPolicyOIDC {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlPolicyOIDC)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessControlPolicyOIDCSession) DeepCopyInto(out *AccessControlPolicyOIDCSession) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessControlPolicyOIDCSession.
+func (in *AccessControlPolicyOIDCSession) DeepCopy() *AccessControlPolicyOIDCSession {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessControlPolicyOIDCSession)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AccessControlPolicySpec) DeepCopyInto(out *AccessControlPolicySpec) {
 	*out = *in
@@ -143,6 +421,36 @@ func (in *AccessControlPolicySpec) DeepCopyInto(out *AccessControlPolicySpec) {
 		*out = new(AccessControlPolicyBasicAuth)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.OIDC != nil {
+		in, out := &in.OIDC, &out.OIDC
+		*out = new(AccessControlPolicyOIDC)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.APIKey != nil {
+		in, out := &in.APIKey, &out.APIKey
+		*out = new(AccessControlPolicyAPIKey)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MTLS != nil {
+		in, out := &in.MTLS, &out.MTLS
+		*out = new(AccessControlPolicyMTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Introspection != nil {
+		in, out := &in.Introspection, &out.Introspection
+		*out = new(AccessControlPolicyIntrospection)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IPAllowList != nil {
+		in, out := &in.IPAllowList, &out.IPAllowList
+		*out = new(AccessControlPolicyIPAllowList)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Composite != nil {
+		in, out := &in.Composite, &out.Composite
+		*out = new(AccessControlPolicyComposite)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -160,6 +468,13 @@ func (in *AccessControlPolicySpec) DeepCopy() *AccessControlPolicySpec {
 func (in *AccessControlPolicyStatus) DeepCopyInto(out *AccessControlPolicyStatus) {
 	*out = *in
 	in.SyncedAt.DeepCopyInto(&out.SyncedAt)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -173,6 +488,32 @@ func (in *AccessControlPolicyStatus) DeepCopy() *AccessControlPolicyStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BasicAuthLockout) DeepCopyInto(out *BasicAuthLockout) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxDuration != nil {
+		in, out := &in.MaxDuration, &out.MaxDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BasicAuthLockout.
+func (in *BasicAuthLockout) DeepCopy() *BasicAuthLockout {
+	if in == nil {
+		return nil
+	}
+	out := new(BasicAuthLockout)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EdgeIngress) DeepCopyInto(out *EdgeIngress) {
 	*out = *in
@@ -380,3 +721,88 @@ func (in *IngressClassSpec) DeepCopy() *IngressClassSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JWTDeny) DeepCopyInto(out *JWTDeny) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JWTDeny.
+func (in *JWTDeny) DeepCopy() *JWTDeny {
+	if in == nil {
+		return nil
+	}
+	out := new(JWTDeny)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JWTRevocation) DeepCopyInto(out *JWTRevocation) {
+	*out = *in
+	if in.RefreshInterval != nil {
+		in, out := &in.RefreshInterval, &out.RefreshInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JWTRevocation.
+func (in *JWTRevocation) DeepCopy() *JWTRevocation {
+	if in == nil {
+		return nil
+	}
+	out := new(JWTRevocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JWTRule) DeepCopyInto(out *JWTRule) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JWTRule.
+func (in *JWTRule) DeepCopy() *JWTRule {
+	if in == nil {
+		return nil
+	}
+	out := new(JWTRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JWTTokenSource) DeepCopyInto(out *JWTTokenSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JWTTokenSource.
+func (in *JWTTokenSource) DeepCopy() *JWTTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(JWTTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyRef) DeepCopyInto(out *SecretKeyRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyRef.
+func (in *SecretKeyRef) DeepCopy() *SecretKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -36,9 +36,25 @@ type Middleware struct {
 
 // MiddlewareSpec holds the Middleware configuration.
 type MiddlewareSpec struct {
-	ForwardAuth      *ForwardAuth      `json:"forwardAuth,omitempty"`
-	StripPrefixRegex *StripPrefixRegex `json:"stripPrefixRegex,omitempty"`
-	AddPrefix        *AddPrefix        `json:"addPrefix,omitempty"`
+	ForwardAuth       *ForwardAuth       `json:"forwardAuth,omitempty"`
+	StripPrefixRegex  *StripPrefixRegex  `json:"stripPrefixRegex,omitempty"`
+	AddPrefix         *AddPrefix         `json:"addPrefix,omitempty"`
+	PassTLSClientCert *PassTLSClientCert `json:"passTLSClientCert,omitempty"`
+	Chain             *Chain             `json:"chain,omitempty"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// PassTLSClientCert holds the TLS client certificate forwarding configuration.
+type PassTLSClientCert struct {
+	PEM bool `json:"pem,omitempty" toml:"pem,omitempty" yaml:"pem,omitempty" export:"true"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// Chain holds the chain configuration.
+type Chain struct {
+	Middlewares []MiddlewareRef `json:"middlewares,omitempty" toml:"middlewares,omitempty" yaml:"middlewares,omitempty" export:"true"`
 }
 
 // +k8s:deepcopy-gen=true
@@ -0,0 +1,185 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package tlsreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reloader serves TLS from certificate files, and reloads them when they change, like when a mounted Secret is
+// rotated. Changes are checked for at most once every check interval, when a TLS handshake happens.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	// Interval at which we should check the mod time of the files.
+	checkInterval time.Duration
+
+	mu     sync.RWMutex
+	config *tls.Config
+	// Mod times of the files the current configuration has been loaded from.
+	modTimes map[string]time.Time
+	// Time at which we last checked the mod times of the files.
+	lastCheck time.Time
+}
+
+// NewReloader returns a Reloader serving the certificate and key stored in the given files. If a client CA file is
+// given, the certificates presented by clients must be signed by one of the CAs it holds. Clients are not required to
+// present one though, so that probes can still be served: handlers must check the certificate of the requests they
+// require it for.
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		clientCAFile:  clientCAFile,
+		checkInterval: 5 * time.Second,
+	}
+
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.load(modTimes); err != nil {
+		return nil, err
+	}
+	r.lastCheck = time.Now()
+
+	return r, nil
+}
+
+// TLSConfig returns a TLS configuration serving the current certificates.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.update()
+
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return r.config, nil
+		},
+	}
+}
+
+func (r *Reloader) isExpired() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastCheck.Add(r.checkInterval).Before(time.Now())
+}
+
+func (r *Reloader) update() {
+	if !r.isExpired() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lastCheck.Add(r.checkInterval).After(time.Now()) {
+		return
+	}
+	r.lastCheck = time.Now()
+
+	modTimes, err := r.stat()
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to check TLS certificates, using previous ones")
+		return
+	}
+
+	var changed bool
+	for file, modTime := range modTimes {
+		if !r.modTimes[file].Equal(modTime) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err = r.load(modTimes); err != nil {
+		log.Error().Err(err).Msg("Unable to reload TLS certificates, using previous ones")
+		return
+	}
+
+	log.Info().Str("cert_file", r.certFile).Msg("TLS certificates reloaded")
+}
+
+func (r *Reloader) stat() (map[string]time.Time, error) {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("stat TLS file: %w", err)
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// load loads the certificates. It must be called with the lock held, or before the Reloader is used.
+func (r *Reloader) load(modTimes map[string]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in client CA file")
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	r.config = config
+	r.modTimes = modTimes
+
+	return nil
+}
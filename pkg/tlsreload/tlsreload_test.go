@@ -0,0 +1,243 @@
+/*
+Copyright (C) 2022 Traefik Labs
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published
+by the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package tlsreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader_reloadsCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	ca := newCA(t)
+	ca.writeCert(t, "auth-server-1", x509.ExtKeyUsageServerAuth, certFile, keyFile)
+
+	r, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	r.checkInterval = 0
+
+	addr := serve(t, r.TLSConfig())
+
+	assert.Equal(t, "auth-server-1", handshake(t, addr, ca, nil))
+
+	ca.writeCert(t, "auth-server-2", x509.ExtKeyUsageServerAuth, certFile, keyFile)
+	touch(t, certFile, keyFile)
+
+	assert.Equal(t, "auth-server-2", handshake(t, addr, ca, nil))
+
+	// Invalid certificates are not loaded.
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+	touch(t, keyFile)
+
+	assert.Equal(t, "auth-server-2", handshake(t, addr, ca, nil))
+}
+
+func TestReloader_verifiesClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	clientCAFile := filepath.Join(dir, "ca.crt")
+	clientCertFile := filepath.Join(dir, "client.crt")
+	clientKeyFile := filepath.Join(dir, "client.key")
+
+	ca := newCA(t)
+	ca.writeCert(t, "auth-server", x509.ExtKeyUsageServerAuth, certFile, keyFile)
+	ca.writeCert(t, "traefik", x509.ExtKeyUsageClientAuth, clientCertFile, clientKeyFile)
+	require.NoError(t, os.WriteFile(clientCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600))
+
+	r, err := NewReloader(certFile, keyFile, clientCAFile)
+	require.NoError(t, err)
+
+	addr := serve(t, r.TLSConfig())
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, "auth-server", handshake(t, addr, ca, &clientCert))
+	assert.Equal(t, "auth-server", handshake(t, addr, ca, nil))
+
+	otherCA := newCA(t)
+	otherCA.writeCert(t, "intruder", x509.ExtKeyUsageClientAuth, clientCertFile, clientKeyFile)
+	otherCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:      ca.pool(),
+		ServerName:   "localhost",
+		Certificates: []tls.Certificate{otherCert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err == nil {
+		// With TLS 1.3, the client certificate is checked after the handshake of the client completes.
+		_, err = conn.Read(make([]byte, 1))
+		_ = conn.Close()
+	}
+	assert.Error(t, err)
+}
+
+func TestNewReloader_invalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	_, err := NewReloader(certFile, keyFile, "")
+	assert.Error(t, err)
+
+	newCA(t).writeCert(t, "auth-server", x509.ExtKeyUsageServerAuth, certFile, keyFile)
+
+	_, err = NewReloader(certFile, keyFile, keyFile)
+	assert.Error(t, err)
+}
+
+// serve accepts TLS connections with the given configuration, and returns the address it listens on.
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				if err := conn.(*tls.Conn).Handshake(); err == nil {
+					_, _ = conn.Write([]byte("ok"))
+				}
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// handshake connects to the given address, and returns the common name of the certificate served.
+func handshake(t *testing.T, addr string, ca *testCA, clientCert *tls.Certificate) string {
+	t.Helper()
+
+	cfg := &tls.Config{RootCAs: ca.pool(), ServerName: "localhost", MinVersion: tls.VersionTLS12}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	conn, err := tls.Dial("tcp", addr, cfg)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Read(make([]byte, 2))
+	require.NoError(t, err)
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// touch changes the mod time of the given files, as they may be written faster than the precision of mod times.
+func touch(t *testing.T, files ...string) {
+	t.Helper()
+
+	modTime := time.Now().Add(time.Minute)
+	for _, file := range files {
+		require.NoError(t, os.Chtimes(file, modTime, modTime))
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (c *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+
+	return pool
+}
+
+// writeCert issues a certificate for localhost and writes it, along with its key, to the given files.
+func (c *testCA) writeCert(t *testing.T, cn string, usage x509.ExtKeyUsage, certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.cert, &key.PublicKey, c.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
@@ -32,9 +32,10 @@ func (f *Fetcher) getAccessControlPolicies(clusterID string) (map[string]*Access
 	result := make(map[string]*AccessControlPolicy)
 	for _, policy := range policies {
 		acp := &AccessControlPolicy{
-			Name:      policy.Name,
-			Namespace: policy.Namespace,
-			ClusterID: clusterID,
+			Name:        policy.Name,
+			Namespace:   policy.Namespace,
+			ClusterID:   clusterID,
+			Enforcement: policy.Spec.Enforcement,
 		}
 
 		switch {
@@ -49,6 +50,47 @@ func (f *Fetcher) getAccessControlPolicies(clusterID string) (map[string]*Access
 				JWKsFile:                   policy.Spec.JWT.JWKsFile,
 				JWKsURL:                    policy.Spec.JWT.JWKsURL,
 				Claims:                     policy.Spec.JWT.Claims,
+				Issuer:                     policy.Spec.JWT.Issuer,
+				Issuers:                    policy.Spec.JWT.Issuers,
+				Audiences:                  policy.Spec.JWT.Audiences,
+				RequiredClaims:             policy.Spec.JWT.RequiredClaims,
+				Algorithms:                 policy.Spec.JWT.Algorithms,
+			}
+			if ref := policy.Spec.JWT.SigningSecretRef; ref != nil {
+				acp.JWT.SigningSecretRef = &SecretKeyRef{Name: ref.Name, Key: ref.Key}
+			}
+			if ref := policy.Spec.JWT.PublicKeyRef; ref != nil {
+				acp.JWT.PublicKeyRef = &SecretKeyRef{Name: ref.Name, Key: ref.Key}
+			}
+			if policy.Spec.JWT.Leeway != nil {
+				acp.JWT.Leeway = policy.Spec.JWT.Leeway.Duration.String()
+			}
+			if policy.Spec.JWT.CacheTTL != nil {
+				acp.JWT.CacheTTL = policy.Spec.JWT.CacheTTL.Duration.String()
+			}
+			for _, src := range policy.Spec.JWT.TokenSources {
+				acp.JWT.TokenSources = append(acp.JWT.TokenSources, JWTTokenSource{Type: src.Type, Name: src.Name, Prefix: src.Prefix})
+			}
+			for _, r := range policy.Spec.JWT.Rules {
+				acp.JWT.Rules = append(acp.JWT.Rules, JWTRule{Match: r.Match, Claims: r.Claims})
+			}
+			if policy.Spec.JWT.Deny != nil {
+				acp.JWT.Deny = &JWTDeny{
+					StatusCode:  policy.Spec.JWT.Deny.StatusCode,
+					ContentType: policy.Spec.JWT.Deny.ContentType,
+					Body:        policy.Spec.JWT.Deny.Body,
+					RedirectURL: policy.Spec.JWT.Deny.RedirectURL,
+				}
+			}
+			if rev := policy.Spec.JWT.Revocation; rev != nil {
+				acp.JWT.Revocation = &JWTRevocation{
+					ConfigMap: rev.ConfigMap,
+					Secret:    rev.Secret,
+					URL:       rev.URL,
+				}
+				if rev.RefreshInterval != nil {
+					acp.JWT.Revocation.RefreshInterval = rev.RefreshInterval.Duration.String()
+				}
 			}
 
 			// TODO: policy.Spec.JWT.JWKsFile can be a huge file, maybe if it's too long we should truncate it.
@@ -59,10 +101,99 @@ func (f *Fetcher) getAccessControlPolicies(clusterID string) (map[string]*Access
 			acp.Method = "basicauth"
 			acp.BasicAuth = &AccessControlPolicyBasicAuth{
 				Users:                    removePassword(policy.Spec.BasicAuth.Users),
+				UsersSecret:              policy.Spec.BasicAuth.UsersSecret,
 				Realm:                    policy.Spec.BasicAuth.Realm,
 				StripAuthorizationHeader: policy.Spec.BasicAuth.StripAuthorizationHeader,
 				ForwardUsernameHeader:    policy.Spec.BasicAuth.ForwardUsernameHeader,
 			}
+			if lockout := policy.Spec.BasicAuth.Lockout; lockout != nil {
+				acp.BasicAuth.Lockout = &BasicAuthLockout{
+					MaxFailures:       lockout.MaxFailures,
+					TrustedProxyDepth: lockout.TrustedProxyDepth,
+				}
+				if lockout.Duration != nil {
+					acp.BasicAuth.Lockout.Duration = lockout.Duration.Duration.String()
+				}
+				if lockout.MaxDuration != nil {
+					acp.BasicAuth.Lockout.MaxDuration = lockout.MaxDuration.Duration.String()
+				}
+			}
+		case policy.Spec.OIDC != nil:
+			acp.Method = "oidc"
+			acp.OIDC = &AccessControlPolicyOIDC{
+				Issuer:         policy.Spec.OIDC.Issuer,
+				ClientID:       policy.Spec.OIDC.ClientID,
+				RedirectURL:    policy.Spec.OIDC.RedirectURL,
+				Scopes:         policy.Spec.OIDC.Scopes,
+				AuthParams:     policy.Spec.OIDC.AuthParams,
+				ForwardHeaders: policy.Spec.OIDC.ForwardHeaders,
+				Claims:         policy.Spec.OIDC.Claims,
+			}
+
+			if session := policy.Spec.OIDC.Session; session != nil {
+				acp.OIDC.Session = &AccessControlPolicyOIDCSession{
+					Name:     session.Name,
+					Path:     session.Path,
+					Domain:   session.Domain,
+					SameSite: session.SameSite,
+					Secure:   session.Secure,
+				}
+			}
+
+			if policy.Spec.OIDC.ClientSecret != "" {
+				acp.OIDC.ClientSecret = "redacted"
+			}
+			if policy.Spec.OIDC.Secret != "" {
+				acp.OIDC.Secret = "redacted"
+			}
+			if ref := policy.Spec.OIDC.ClientSecretRef; ref != nil {
+				acp.OIDC.ClientSecretRef = &SecretKeyRef{Name: ref.Name, Key: ref.Key}
+			}
+			if ref := policy.Spec.OIDC.SecretRef; ref != nil {
+				acp.OIDC.SecretRef = &SecretKeyRef{Name: ref.Name, Key: ref.Key}
+			}
+		case policy.Spec.APIKey != nil:
+			acp.Method = "apikey"
+			acp.APIKey = &AccessControlPolicyAPIKey{
+				KeyHeader:      policy.Spec.APIKey.KeyHeader,
+				KeyQuery:       policy.Spec.APIKey.KeyQuery,
+				SecretSelector: policy.Spec.APIKey.SecretSelector,
+				ForwardHeaders: policy.Spec.APIKey.ForwardHeaders,
+			}
+		case policy.Spec.MTLS != nil:
+			acp.Method = "mtls"
+			acp.MTLS = &AccessControlPolicyMTLS{
+				CASecret:       policy.Spec.MTLS.CASecret,
+				Subjects:       policy.Spec.MTLS.Subjects,
+				SANs:           policy.Spec.MTLS.SANs,
+				Fingerprints:   policy.Spec.MTLS.Fingerprints,
+				ForwardHeaders: policy.Spec.MTLS.ForwardHeaders,
+			}
+		case policy.Spec.Introspection != nil:
+			acp.Method = "introspection"
+			acp.Introspection = &AccessControlPolicyIntrospection{
+				URL:                      policy.Spec.Introspection.URL,
+				ClientCredentialsSecret:  policy.Spec.Introspection.ClientCredentialsSecret,
+				Scopes:                   policy.Spec.Introspection.Scopes,
+				Audiences:                policy.Spec.Introspection.Audiences,
+				StripAuthorizationHeader: policy.Spec.Introspection.StripAuthorizationHeader,
+				ForwardHeaders:           policy.Spec.Introspection.ForwardHeaders,
+				Claims:                   policy.Spec.Introspection.Claims,
+			}
+		case policy.Spec.IPAllowList != nil:
+			acp.Method = "ipallowlist"
+			acp.IPAllowList = &AccessControlPolicyIPAllowList{
+				Allow:             policy.Spec.IPAllowList.Allow,
+				Deny:              policy.Spec.IPAllowList.Deny,
+				TrustedProxyDepth: policy.Spec.IPAllowList.TrustedProxyDepth,
+				ConfigMap:         policy.Spec.IPAllowList.ConfigMap,
+			}
+		case policy.Spec.Composite != nil:
+			acp.Method = "composite"
+			acp.Composite = &AccessControlPolicyComposite{
+				AllOf: policy.Spec.Composite.AllOf,
+				AnyOf: policy.Spec.Composite.AnyOf,
+			}
 		default:
 			continue
 		}
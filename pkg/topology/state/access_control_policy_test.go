@@ -19,7 +19,9 @@ package state
 
 import (
 	"context"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -60,6 +62,22 @@ func TestFetcher_GetAccessControlPolicies(t *testing.T) {
 							ForwardHeaders:             map[string]string{"Titi": "toto", "Toto": "titi"},
 							TokenQueryKey:              "token",
 							Claims:                     "iss=titi",
+							Issuer:                     "https://issuer.example.com",
+							Issuers:                    []string{"https://issuer.example.com"},
+							Audiences:                  []string{"my-api"},
+							Leeway:                     &metav1.Duration{Duration: 30 * time.Second},
+							RequiredClaims:             []string{"sub"},
+							Algorithms:                 []string{"RS256", "EdDSA"},
+							Rules: []hubv1alpha1.JWTRule{
+								{Match: "Method(`POST`)", Claims: "Contains(`groups`, `admin`)"},
+							},
+							CacheTTL: &metav1.Duration{Duration: 5 * time.Minute},
+							Deny: &hubv1alpha1.JWTDeny{
+								StatusCode:  http.StatusUnauthorized,
+								ContentType: "application/json",
+								Body:        `{"error": {{ json .Error }}}`,
+								RedirectURL: "https://login.example.com",
+							},
 						},
 					},
 				},
@@ -80,6 +98,22 @@ func TestFetcher_GetAccessControlPolicies(t *testing.T) {
 						ForwardHeaders:             map[string]string{"Titi": "toto", "Toto": "titi"},
 						TokenQueryKey:              "token",
 						Claims:                     "iss=titi",
+						Issuer:                     "https://issuer.example.com",
+						Issuers:                    []string{"https://issuer.example.com"},
+						Audiences:                  []string{"my-api"},
+						Leeway:                     "30s",
+						RequiredClaims:             []string{"sub"},
+						Algorithms:                 []string{"RS256", "EdDSA"},
+						Rules: []JWTRule{
+							{Match: "Method(`POST`)", Claims: "Contains(`groups`, `admin`)"},
+						},
+						CacheTTL: "5m0s",
+						Deny: &JWTDeny{
+							StatusCode:  http.StatusUnauthorized,
+							ContentType: "application/json",
+							Body:        `{"error": {{ json .Error }}}`,
+							RedirectURL: "https://login.example.com",
+						},
 					},
 				},
 			},
@@ -111,6 +145,53 @@ func TestFetcher_GetAccessControlPolicies(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "JWT access control policy with secret references, token sources and revocation",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						JWT: &hubv1alpha1.AccessControlPolicyJWT{
+							SigningSecretRef: &hubv1alpha1.SecretKeyRef{Name: "my-jwt", Key: "signing-secret"},
+							PublicKeyRef:     &hubv1alpha1.SecretKeyRef{Name: "my-jwt", Key: "public-key"},
+							TokenSources: []hubv1alpha1.JWTTokenSource{
+								{Type: "cookie", Name: "access_token"},
+								{Type: "header", Name: "X-Auth-Token", Prefix: "Token "},
+							},
+							Revocation: &hubv1alpha1.JWTRevocation{
+								ConfigMap:       "my-revocations",
+								URL:             "https://idp.example.com/revocations",
+								RefreshInterval: &metav1.Duration{Duration: 30 * time.Second},
+							},
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "jwt",
+					JWT: &AccessControlPolicyJWT{
+						SigningSecretRef: &SecretKeyRef{Name: "my-jwt", Key: "signing-secret"},
+						PublicKeyRef:     &SecretKeyRef{Name: "my-jwt", Key: "public-key"},
+						TokenSources: []JWTTokenSource{
+							{Type: "cookie", Name: "access_token"},
+							{Type: "header", Name: "X-Auth-Token", Prefix: "Token "},
+						},
+						Revocation: &JWTRevocation{
+							ConfigMap:       "my-revocations",
+							URL:             "https://idp.example.com/revocations",
+							RefreshInterval: "30s",
+						},
+					},
+				},
+			},
+		},
 		{
 			desc: "Basic Auth access control policy",
 			objects: []runtime.Object{
@@ -122,9 +203,15 @@ func TestFetcher_GetAccessControlPolicies(t *testing.T) {
 					Spec: hubv1alpha1.AccessControlPolicySpec{
 						BasicAuth: &hubv1alpha1.AccessControlPolicyBasicAuth{
 							Users:                    []string{"toto:secret", "titi:secret"},
+							UsersSecret:              "my-users",
 							Realm:                    "realm",
 							StripAuthorizationHeader: true,
+							Lockout: &hubv1alpha1.BasicAuthLockout{
+								MaxFailures: 5,
+								Duration:    &metav1.Duration{Duration: time.Minute},
+							},
 						},
+						Enforcement: "report-only",
 					},
 				},
 			},
@@ -136,8 +223,251 @@ func TestFetcher_GetAccessControlPolicies(t *testing.T) {
 					Method:    "basicauth",
 					BasicAuth: &AccessControlPolicyBasicAuth{
 						Users:                    "toto:redacted,titi:redacted",
+						UsersSecret:              "my-users",
 						Realm:                    "realm",
 						StripAuthorizationHeader: true,
+						Lockout: &BasicAuthLockout{
+							MaxFailures: 5,
+							Duration:    "1m0s",
+						},
+					},
+					Enforcement: "report-only",
+				},
+			},
+		},
+		{
+			desc: "OIDC access control policy",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						OIDC: &hubv1alpha1.AccessControlPolicyOIDC{
+							Issuer:         "https://auth.example.com",
+							ClientID:       "client",
+							ClientSecret:   "secret",
+							RedirectURL:    "/callback",
+							Secret:         "cookie-secret",
+							Scopes:         []string{"openid", "email"},
+							Session:        &hubv1alpha1.AccessControlPolicyOIDCSession{Name: "session", Secure: true},
+							ForwardHeaders: map[string]string{"Email": "email"},
+							Claims:         "Equals(`group`, `dev`)",
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "oidc",
+					OIDC: &AccessControlPolicyOIDC{
+						Issuer:         "https://auth.example.com",
+						ClientID:       "client",
+						ClientSecret:   "redacted",
+						RedirectURL:    "/callback",
+						Secret:         "redacted",
+						Scopes:         []string{"openid", "email"},
+						Session:        &AccessControlPolicyOIDCSession{Name: "session", Secure: true},
+						ForwardHeaders: map[string]string{"Email": "email"},
+						Claims:         "Equals(`group`, `dev`)",
+					},
+				},
+			},
+		},
+		{
+			desc: "OIDC access control policy with secret references",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						OIDC: &hubv1alpha1.AccessControlPolicyOIDC{
+							Issuer:          "https://auth.example.com",
+							ClientID:        "client",
+							ClientSecretRef: &hubv1alpha1.SecretKeyRef{Name: "my-oidc", Key: "client-secret"},
+							SecretRef:       &hubv1alpha1.SecretKeyRef{Name: "my-oidc", Key: "secret"},
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "oidc",
+					OIDC: &AccessControlPolicyOIDC{
+						Issuer:          "https://auth.example.com",
+						ClientID:        "client",
+						ClientSecretRef: &SecretKeyRef{Name: "my-oidc", Key: "client-secret"},
+						SecretRef:       &SecretKeyRef{Name: "my-oidc", Key: "secret"},
+					},
+				},
+			},
+		},
+		{
+			desc: "API key access control policy",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						APIKey: &hubv1alpha1.AccessControlPolicyAPIKey{
+							KeyHeader:      "X-Token",
+							SecretSelector: "app=my-app",
+							ForwardHeaders: map[string]string{"Owner": "owner"},
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "apikey",
+					APIKey: &AccessControlPolicyAPIKey{
+						KeyHeader:      "X-Token",
+						SecretSelector: "app=my-app",
+						ForwardHeaders: map[string]string{"Owner": "owner"},
+					},
+				},
+			},
+		},
+		{
+			desc: "mTLS access control policy",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						MTLS: &hubv1alpha1.AccessControlPolicyMTLS{
+							CASecret:       "my-ca",
+							Subjects:       []string{"client"},
+							SANs:           []string{"client.example.com"},
+							ForwardHeaders: map[string]string{"Subject": "subject"},
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "mtls",
+					MTLS: &AccessControlPolicyMTLS{
+						CASecret:       "my-ca",
+						Subjects:       []string{"client"},
+						SANs:           []string{"client.example.com"},
+						ForwardHeaders: map[string]string{"Subject": "subject"},
+					},
+				},
+			},
+		},
+		{
+			desc: "Introspection access control policy",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						Introspection: &hubv1alpha1.AccessControlPolicyIntrospection{
+							URL:                     "https://auth.example.com/introspect",
+							ClientCredentialsSecret: "my-creds",
+							Scopes:                  []string{"read"},
+							Audiences:               []string{"api"},
+							ForwardHeaders:          map[string]string{"User": "sub"},
+							Claims:                  "Equals(`group`, `dev`)",
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "introspection",
+					Introspection: &AccessControlPolicyIntrospection{
+						URL:                     "https://auth.example.com/introspect",
+						ClientCredentialsSecret: "my-creds",
+						Scopes:                  []string{"read"},
+						Audiences:               []string{"api"},
+						ForwardHeaders:          map[string]string{"User": "sub"},
+						Claims:                  "Equals(`group`, `dev`)",
+					},
+				},
+			},
+		},
+		{
+			desc: "IP allow list access control policy",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						IPAllowList: &hubv1alpha1.AccessControlPolicyIPAllowList{
+							Allow:             []string{"10.0.0.0/8"},
+							Deny:              []string{"10.0.0.1"},
+							TrustedProxyDepth: 1,
+							ConfigMap:         "my-ranges",
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "ipallowlist",
+					IPAllowList: &AccessControlPolicyIPAllowList{
+						Allow:             []string{"10.0.0.0/8"},
+						Deny:              []string{"10.0.0.1"},
+						TrustedProxyDepth: 1,
+						ConfigMap:         "my-ranges",
+					},
+				},
+			},
+		},
+		{
+			desc: "Composite access control policy",
+			objects: []runtime.Object{
+				&hubv1alpha1.AccessControlPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "myacp",
+						Namespace: "myns",
+					},
+					Spec: hubv1alpha1.AccessControlPolicySpec{
+						Composite: &hubv1alpha1.AccessControlPolicyComposite{
+							AnyOf: []string{"myjwtacp", "mybasicacp"},
+						},
+					},
+				},
+			},
+			want: map[string]*AccessControlPolicy{
+				"myacp@myns": {
+					Name:      "myacp",
+					Namespace: "myns",
+					ClusterID: "cluster-id",
+					Method:    "composite",
+					Composite: &AccessControlPolicyComposite{
+						AnyOf: []string{"myjwtacp", "mybasicacp"},
 					},
 				},
 			},